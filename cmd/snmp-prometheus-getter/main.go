@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/config"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/service"
@@ -16,8 +18,20 @@ func main() {
 	// Parse command line flags
 	configFile := flag.String("config", "config.toml", "Path to configuration file")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	discover := flag.Bool("discover", false, "Sweep the discovery subnets, save disabled configurations for new devices and exit")
+	convert := flag.Bool("convert", false, "Print the configuration file as TOML in the canonical layout and exit")
+	watch := flag.Duration("watch", config.DefaultWatchInterval, "How often to check the configuration file for changes (0 disables)")
 	flag.Parse()
 
+	if *convert {
+		if err := convertConfiguration(*configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "converting configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	// Set up logging
 	var logger *slog.Logger
 	switch *logLevel {
@@ -58,9 +72,76 @@ func main() {
 		cancel()
 	}()
 
-	// Start service
+	if *discover {
+		err := svc.Discover(ctx)
+		svc.Close()
+
+		if err != nil {
+			logger.Error("discovering devices", "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	// Reload the configuration on SIGHUP and when the file changes
+	go reloadConfiguration(ctx, svc, *configFile, *watch, logger)
+
+	// Run the service until interrupted; Start returns once it has drained
 	if err := svc.Start(ctx); err != nil {
 		logger.Error("starting service", "error", err)
 		os.Exit(1)
 	}
 }
+
+// reloadConfiguration reloads the service configuration on SIGHUP and, when
+// watch is positive, whenever the file changes.
+func reloadConfiguration(ctx context.Context, svc *service.Service, path string, watch time.Duration, logger *slog.Logger) {
+	reload := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	if watch > 0 {
+		go config.WatchFile(ctx, path, watch, trigger)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			logger.Info("received signal", "signal", syscall.SIGHUP)
+			trigger()
+		case <-reload:
+			if err := svc.Reload(path); err != nil {
+				logger.Error("reloading configuration", "error", err)
+			}
+		}
+	}
+}
+
+// convertConfiguration prints a configuration file, in any supported format
+// or the legacy YAML layout, as canonical TOML.
+func convertConfiguration(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	out, err := config.ConvertBootstrapConfiguration(path, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(out)
+
+	return err
+}
@@ -0,0 +1,328 @@
+// Package breaker implements circuit breakers that stop calls to a failing
+// dependency until it recovers.
+//
+// A breaker starts closed. After FailureThreshold consecutive failures it
+// opens and rejects calls for OpenTimeout, then turns half-open and lets a
+// single probe through at a time. SuccessThreshold successful probes close
+// it again; a failed probe opens it for another OpenTimeout.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults used for unset configuration values.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = time.Minute
+	DefaultSuccessThreshold = 1
+)
+
+// ErrOpen is returned by Allow while a breaker rejects calls.
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is the state of a breaker.
+type State int
+
+// Breaker states.
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+// String returns the name of the state as used in logs and metrics.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// Config controls the breakers of a set. Zero values select the defaults.
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens a breaker.
+	FailureThreshold int
+	// OpenTimeout is how long an open breaker rejects calls before probing.
+	OpenTimeout time.Duration
+	// SuccessThreshold is the number of successful probes that closes a breaker.
+	SuccessThreshold int
+}
+
+// Validate checks the configuration.
+func (c Config) Validate() error {
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold cannot be negative")
+	}
+
+	if c.OpenTimeout < 0 {
+		return fmt.Errorf("open timeout cannot be negative")
+	}
+
+	if c.SuccessThreshold < 0 {
+		return fmt.Errorf("success threshold cannot be negative")
+	}
+
+	return nil
+}
+
+// setDefaults fills in unset values.
+func (c *Config) setDefaults() {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultFailureThreshold
+	}
+
+	if c.OpenTimeout == 0 {
+		c.OpenTimeout = DefaultOpenTimeout
+	}
+
+	if c.SuccessThreshold == 0 {
+		c.SuccessThreshold = DefaultSuccessThreshold
+	}
+}
+
+// Observer is notified of every change of state of a breaker.
+type Observer func(key string, from, to State)
+
+// Set holds a breaker per key, such as an endpoint URL or device ID. Breakers
+// are created closed on first use. It is safe for concurrent use.
+type Set struct {
+	mu       sync.Mutex
+	cfg      Config
+	breakers map[string]*breaker
+	observer Observer
+	now      func() time.Time
+}
+
+// breaker is the state of one key.
+type breaker struct {
+	state     State
+	failures  int
+	successes int
+	openedAt  time.Time
+	// probing is set while a half-open breaker's probe is in progress.
+	probing bool
+}
+
+// transition is a change of state to report to the observer.
+type transition struct {
+	key      string
+	from, to State
+}
+
+// WithObserver registers an observer for changes of state.
+func WithObserver(observer Observer) func(*Set) {
+	return func(s *Set) {
+		s.observer = observer
+	}
+}
+
+// New creates a set of breakers.
+func New(cfg Config, opts ...func(*Set)) *Set {
+	cfg.setDefaults()
+
+	s := &Set{
+		cfg:      cfg,
+		breakers: make(map[string]*breaker),
+		now:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// SetConfig replaces the configuration. Breakers keep their state; the new
+// thresholds apply from their next call.
+func (s *Set) SetConfig(cfg Config) {
+	cfg.setDefaults()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg = cfg
+}
+
+// Allow reports whether a call for key may go ahead, returning ErrOpen if
+// not. Every allowed call must be followed by Success, Failure or Release.
+func (s *Set) Allow(key string) error {
+	s.mu.Lock()
+
+	b := s.get(key)
+
+	var (
+		err     error
+		changes []transition
+	)
+
+	switch b.state {
+	case Closed:
+	case Open:
+		if s.now().Sub(b.openedAt) < s.cfg.OpenTimeout {
+			err = ErrOpen
+			break
+		}
+
+		changes = s.set(key, b, HalfOpen)
+		b.probing = true
+	case HalfOpen:
+		if b.probing {
+			err = ErrOpen
+			break
+		}
+
+		b.probing = true
+	}
+
+	s.mu.Unlock()
+	s.notify(changes)
+
+	return err
+}
+
+// Success records a successful call.
+func (s *Set) Success(key string) {
+	s.mu.Lock()
+
+	b := s.get(key)
+
+	var changes []transition
+
+	switch b.state {
+	case Closed:
+		b.failures = 0
+	case HalfOpen:
+		b.probing = false
+		b.successes++
+
+		if b.successes >= s.cfg.SuccessThreshold {
+			changes = s.set(key, b, Closed)
+		}
+	case Open:
+		// A call allowed before the breaker opened says nothing about now.
+	}
+
+	s.mu.Unlock()
+	s.notify(changes)
+}
+
+// Failure records a failed call.
+func (s *Set) Failure(key string) {
+	s.mu.Lock()
+
+	b := s.get(key)
+
+	var changes []transition
+
+	switch b.state {
+	case Closed:
+		b.failures++
+
+		if b.failures >= s.cfg.FailureThreshold {
+			changes = s.set(key, b, Open)
+		}
+	case HalfOpen:
+		changes = s.set(key, b, Open)
+	case Open:
+	}
+
+	s.mu.Unlock()
+	s.notify(changes)
+}
+
+// Release records an allowed call that ended without an outcome, such as one
+// that was cancelled, so that a half-open breaker can probe again.
+func (s *Set) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.breakers[key]; ok {
+		b.probing = false
+	}
+}
+
+// State returns the state of the breaker for key.
+func (s *Set) State(key string) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.breakers[key]; ok {
+		return b.state
+	}
+
+	return Closed
+}
+
+// Retain drops the breakers of keys not in keys. Dropped breakers that were
+// not closed are reported as closing.
+func (s *Set) Retain(keys map[string]bool) {
+	s.mu.Lock()
+
+	var changes []transition
+
+	for key, b := range s.breakers {
+		if keys[key] {
+			continue
+		}
+
+		if b.state != Closed {
+			changes = append(changes, transition{key: key, from: b.state, to: Closed})
+		}
+
+		delete(s.breakers, key)
+	}
+
+	s.mu.Unlock()
+	s.notify(changes)
+}
+
+// get returns the breaker for key, creating it closed. s.mu must be held.
+func (s *Set) get(key string) *breaker {
+	b, ok := s.breakers[key]
+	if !ok {
+		b = &breaker{}
+		s.breakers[key] = b
+	}
+
+	return b
+}
+
+// set moves a breaker to a new state and returns the transition to report.
+// s.mu must be held.
+func (s *Set) set(key string, b *breaker, state State) []transition {
+	from := b.state
+
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.probing = false
+
+	if state == Open {
+		b.openedAt = s.now()
+	}
+
+	return []transition{{key: key, from: from, to: state}}
+}
+
+// notify reports transitions to the observer, outside s.mu so that the
+// observer may call back into the set.
+func (s *Set) notify(changes []transition) {
+	if s.observer == nil {
+		return
+	}
+
+	for _, t := range changes {
+		s.observer(t.key, t.from, t.to)
+	}
+}
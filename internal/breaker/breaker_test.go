@@ -0,0 +1,156 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestSet(t *testing.T, cfg Config) (*Set, *clock, *[]string) {
+	t.Helper()
+
+	var transitions []string
+
+	c := &clock{now: time.Unix(0, 0)}
+	s := New(cfg, WithObserver(func(key string, from, to State) {
+		transitions = append(transitions, key+":"+from.String()+">"+to.String())
+	}))
+	s.now = c.Now
+
+	return s, c, &transitions
+}
+
+func TestSet_OpensAfterConsecutiveFailures(t *testing.T) {
+	s, _, transitions := newTestSet(t, Config{FailureThreshold: 3, OpenTimeout: time.Minute})
+
+	for _, ok := range []bool{false, false, true, false, false} {
+		if err := s.Allow("a"); err != nil {
+			t.Fatalf("Allow() = %v, want nil while closed", err)
+		}
+
+		if ok {
+			s.Success("a")
+		} else {
+			s.Failure("a")
+		}
+	}
+
+	if got := s.State("a"); got != Closed {
+		t.Fatalf("State() = %v, want closed: a success resets the count", got)
+	}
+
+	s.Failure("a")
+
+	if got := s.State("a"); got != Open {
+		t.Fatalf("State() = %v, want open", got)
+	}
+
+	if err := s.Allow("a"); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() = %v, want ErrOpen", err)
+	}
+
+	if err := s.Allow("b"); err != nil {
+		t.Errorf("Allow() = %v for another key, want nil", err)
+	}
+
+	if len(*transitions) != 1 || (*transitions)[0] != "a:closed>open" {
+		t.Errorf("transitions = %v, want [a:closed>open]", *transitions)
+	}
+}
+
+func TestSet_HalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     func(s *Set)
+		wantState State
+	}{
+		{name: "successful probe closes", probe: func(s *Set) { s.Success("a") }, wantState: Closed},
+		{name: "failed probe reopens", probe: func(s *Set) { s.Failure("a") }, wantState: Open},
+		{name: "released probe stays half-open", probe: func(s *Set) { s.Release("a") }, wantState: HalfOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c, _ := newTestSet(t, Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+			s.Failure("a")
+
+			c.now = c.now.Add(59 * time.Second)
+			if err := s.Allow("a"); !errors.Is(err, ErrOpen) {
+				t.Fatalf("Allow() = %v before the open timeout, want ErrOpen", err)
+			}
+
+			c.now = c.now.Add(time.Second)
+			if err := s.Allow("a"); err != nil {
+				t.Fatalf("Allow() = %v after the open timeout, want nil", err)
+			}
+
+			if got := s.State("a"); got != HalfOpen {
+				t.Fatalf("State() = %v, want half_open", got)
+			}
+
+			// Only one probe at a time.
+			if err := s.Allow("a"); !errors.Is(err, ErrOpen) {
+				t.Fatalf("Allow() = %v during a probe, want ErrOpen", err)
+			}
+
+			tt.probe(s)
+
+			if got := s.State("a"); got != tt.wantState {
+				t.Errorf("State() = %v, want %v", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestSet_SuccessThreshold(t *testing.T) {
+	s, c, _ := newTestSet(t, Config{FailureThreshold: 1, OpenTimeout: time.Second, SuccessThreshold: 2})
+
+	s.Failure("a")
+	c.now = c.now.Add(time.Second)
+
+	for i := 0; i < 2; i++ {
+		if got := s.State("a"); i > 0 && got != HalfOpen {
+			t.Fatalf("State() = %v after %d successful probes, want half_open", got, i)
+		}
+
+		if err := s.Allow("a"); err != nil {
+			t.Fatalf("Allow() = %v, want nil", err)
+		}
+
+		s.Success("a")
+	}
+
+	if got := s.State("a"); got != Closed {
+		t.Errorf("State() = %v, want closed", got)
+	}
+}
+
+func TestSet_Retain(t *testing.T) {
+	s, _, transitions := newTestSet(t, Config{FailureThreshold: 1})
+
+	s.Failure("a")
+	s.Failure("b")
+	s.Retain(map[string]bool{"b": true})
+
+	if got := s.State("a"); got != Closed {
+		t.Errorf("State() = %v for a dropped key, want closed", got)
+	}
+
+	if got := s.State("b"); got != Open {
+		t.Errorf("State() = %v for a retained key, want open", got)
+	}
+
+	if got := (*transitions)[len(*transitions)-1]; got != "a:open>closed" {
+		t.Errorf("last transition = %s, want a:open>closed", got)
+	}
+}
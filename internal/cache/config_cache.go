@@ -14,14 +14,16 @@ type ConfigCache struct {
 	mu      sync.RWMutex
 	ttl     time.Duration
 	updated time.Time
+	// generation counts the changes to configs.
+	generation uint64
 }
 
 // New creates a new configuration cache with the specified TTL.
+// A new cache starts out expired so that the first refresh always loads.
 func New(ttl time.Duration) *ConfigCache {
 	return &ConfigCache{
 		configs: make(map[string]elasticsearch.Config),
 		ttl:     ttl,
-		updated: time.Now(),
 	}
 }
 
@@ -59,6 +61,7 @@ func (c *ConfigCache) Set(config *elasticsearch.Config) {
 
 	c.configs[config.ID] = *config
 	c.updated = time.Now()
+	c.generation++
 }
 
 // SetAll replaces all configurations in the cache.
@@ -72,6 +75,7 @@ func (c *ConfigCache) SetAll(configs []elasticsearch.Config) {
 	}
 
 	c.updated = time.Now()
+	c.generation++
 }
 
 // Delete removes a configuration from the cache.
@@ -81,6 +85,7 @@ func (c *ConfigCache) Delete(id string) {
 
 	delete(c.configs, id)
 	c.updated = time.Now()
+	c.generation++
 }
 
 // Clear removes all configurations from the cache.
@@ -90,6 +95,7 @@ func (c *ConfigCache) Clear() {
 
 	c.configs = make(map[string]elasticsearch.Config)
 	c.updated = time.Now()
+	c.generation++
 }
 
 // IsExpired checks if the cache has expired.
@@ -108,6 +114,16 @@ func (c *ConfigCache) LastUpdated() time.Time {
 	return c.updated
 }
 
+// Generation returns a number that changes whenever the cached
+// configurations do. Unlike LastUpdated, it is unchanged by a sync that finds
+// nothing new.
+func (c *ConfigCache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.generation
+}
+
 // Count returns the number of configurations in the cache.
 func (c *ConfigCache) Count() int {
 	c.mu.RLock()
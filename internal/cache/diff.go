@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+// Diff describes how the cached configurations changed in a sync.
+type Diff struct {
+	// Added are enabled configurations that were not cached before.
+	Added []elasticsearch.Config
+	// Changed are enabled configurations whose stored revision changed.
+	Changed []elasticsearch.Config
+	// Disabled are new or changed configurations that are not enabled.
+	Disabled []elasticsearch.Config
+	// Removed are the IDs of configurations that are no longer stored.
+	Removed []string
+}
+
+// Empty reports whether the sync changed nothing.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Disabled) == 0 && len(d.Removed) == 0
+}
+
+// Stale returns the IDs of the stored configurations that are not cached or
+// whose update time differs from the cached copy, and so must be fetched.
+func (c *ConfigCache) Stale(versions []elasticsearch.ConfigVersion) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var stale []string
+
+	for id, updated := range latest(versions) {
+		config, ok := c.configs[id]
+		if !ok || !config.UpdatedAt.Equal(updated) {
+			stale = append(stale, id)
+		}
+	}
+
+	return stale
+}
+
+// Apply stores the fetched configurations and drops those missing from
+// versions, the full list of stored revisions. Cached configurations that are
+// stored but were not fetched are kept as they are.
+func (c *ConfigCache) Apply(versions []elasticsearch.ConfigVersion, fetched []elasticsearch.Config) Diff {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var diff Diff
+
+	stored := latest(versions)
+
+	for id := range c.configs {
+		if _, ok := stored[id]; !ok {
+			delete(c.configs, id)
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	for _, config := range newest(fetched) {
+		cached, ok := c.configs[config.ID]
+		if ok && cached.UpdatedAt.Equal(config.UpdatedAt) {
+			continue
+		}
+
+		c.configs[config.ID] = config
+
+		switch {
+		case !config.Enabled:
+			diff.Disabled = append(diff.Disabled, config)
+		case ok:
+			diff.Changed = append(diff.Changed, config)
+		default:
+			diff.Added = append(diff.Added, config)
+		}
+	}
+
+	// The cache is as fresh as the store whether or not anything changed.
+	c.updated = time.Now()
+
+	if !diff.Empty() {
+		c.generation++
+	}
+
+	return diff
+}
+
+// latest returns the most recent update time of each stored configuration.
+// The same ID may be stored more than once; the newest revision wins.
+func latest(versions []elasticsearch.ConfigVersion) map[string]time.Time {
+	stored := make(map[string]time.Time, len(versions))
+
+	for _, v := range versions {
+		if updated, ok := stored[v.ID]; !ok || v.UpdatedAt.After(updated) {
+			stored[v.ID] = v.UpdatedAt
+		}
+	}
+
+	return stored
+}
+
+// newest returns the most recent revision of each configuration.
+func newest(configs []elasticsearch.Config) map[string]elasticsearch.Config {
+	byID := make(map[string]elasticsearch.Config, len(configs))
+
+	for _, config := range configs {
+		if existing, ok := byID[config.ID]; !ok || config.UpdatedAt.After(existing.UpdatedAt) {
+			byID[config.ID] = config
+		}
+	}
+
+	return byID
+}
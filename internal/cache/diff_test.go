@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+func TestConfigCache_Apply(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+
+	c := New(time.Minute)
+	c.SetAll([]elasticsearch.Config{
+		{ID: "unchanged", Enabled: true, UpdatedAt: t0},
+		{ID: "changed", Enabled: true, UpdatedAt: t0},
+		{ID: "disabled", Enabled: true, UpdatedAt: t0},
+		{ID: "removed", Enabled: true, UpdatedAt: t0},
+	})
+
+	versions := []elasticsearch.ConfigVersion{
+		{ID: "unchanged", UpdatedAt: t0},
+		{ID: "changed", UpdatedAt: t1},
+		{ID: "disabled", UpdatedAt: t1},
+		{ID: "added", UpdatedAt: t0},
+		// A duplicate document with an older revision is ignored.
+		{ID: "added", UpdatedAt: t0.Add(-time.Hour)},
+	}
+
+	stale := c.Stale(versions)
+	slices.Sort(stale)
+
+	if want := []string{"added", "changed", "disabled"}; !slices.Equal(stale, want) {
+		t.Fatalf("Stale() = %v, want %v", stale, want)
+	}
+
+	diff := c.Apply(versions, []elasticsearch.Config{
+		{ID: "changed", Enabled: true, UpdatedAt: t1},
+		{ID: "disabled", Enabled: false, UpdatedAt: t1},
+		{ID: "added", Enabled: true, UpdatedAt: t0},
+	})
+
+	if len(diff.Added) != 1 || diff.Added[0].ID != "added" {
+		t.Errorf("unexpected added %+v", diff.Added)
+	}
+
+	if len(diff.Changed) != 1 || diff.Changed[0].ID != "changed" {
+		t.Errorf("unexpected changed %+v", diff.Changed)
+	}
+
+	if len(diff.Disabled) != 1 || diff.Disabled[0].ID != "disabled" {
+		t.Errorf("unexpected disabled %+v", diff.Disabled)
+	}
+
+	if !slices.Equal(diff.Removed, []string{"removed"}) {
+		t.Errorf("unexpected removed %v", diff.Removed)
+	}
+
+	if _, ok := c.Get("removed"); ok || c.Count() != 4 {
+		t.Errorf("expected removed configuration to be dropped, %d cached", c.Count())
+	}
+
+	// A second sync with the same revisions changes nothing.
+	updated, generation := c.LastUpdated(), c.Generation()
+
+	if stale := c.Stale(versions); len(stale) != 0 {
+		t.Errorf("expected nothing stale, got %v", stale)
+	}
+
+	if diff := c.Apply(versions, nil); !diff.Empty() {
+		t.Errorf("expected an empty diff, got %+v", diff)
+	}
+
+	if !c.LastUpdated().After(updated) {
+		t.Errorf("expected an empty sync to refresh the cache, last updated %v", c.LastUpdated())
+	}
+
+	if c.Generation() != generation {
+		t.Errorf("expected an empty sync to keep generation %d, got %d", generation, c.Generation())
+	}
+}
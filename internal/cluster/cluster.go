@@ -0,0 +1,274 @@
+// Package cluster partitions devices between getter instances that share a
+// configuration index. Instances hold leases in a membership index and each
+// polls the devices that hash to it on a ring of the live members.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+const (
+	// DefaultIndex is the membership index used when none is configured.
+	DefaultIndex = "snmp-getter-members"
+	// DefaultHeartbeatInterval is how often an instance renews its lease.
+	DefaultHeartbeatInterval = 10 * time.Second
+	// DefaultLeaseDuration is how long a lease lasts without renewal.
+	DefaultLeaseDuration = 30 * time.Second
+)
+
+// Store holds the leases of the getter instances.
+type Store interface {
+	Renew(ctx context.Context, member *elasticsearch.Member) error
+	Members(ctx context.Context, now time.Time) ([]elasticsearch.Member, error)
+	Leave(ctx context.Context, name string) error
+}
+
+// Config controls cluster membership. Zero durations select the defaults.
+type Config struct {
+	// Name identifies the instance and must be unique within the cluster.
+	Name              string
+	HeartbeatInterval time.Duration
+	// LeaseDuration must be at least twice the heartbeat interval, so that a
+	// single missed renewal does not hand the instance's devices over.
+	LeaseDuration time.Duration
+}
+
+// Validate checks the configuration.
+func (c Config) Validate() error {
+	c.setDefaults()
+
+	if c.Name == "" {
+		return fmt.Errorf("instance name must be specified")
+	}
+
+	if c.HeartbeatInterval < time.Second {
+		return fmt.Errorf("heartbeat interval must be at least 1 second")
+	}
+
+	if c.LeaseDuration < 2*c.HeartbeatInterval {
+		return fmt.Errorf("lease duration must be at least twice the heartbeat interval")
+	}
+
+	return nil
+}
+
+// setDefaults fills in unset durations.
+func (c *Config) setDefaults() {
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = DefaultLeaseDuration
+	}
+}
+
+// Coordinator maintains this instance's lease and decides which devices it
+// owns.
+//
+// Devices are handed over in two steps so that none is polled twice: when
+// the membership changes an instance stops polling the devices it loses at
+// once, but only starts polling the devices it gains after a settle period
+// that gives every other instance time to notice the change. An instance
+// that cannot renew its lease stops polling before the lease expires, so its
+// devices are picked up by the others rather than dropped.
+type Coordinator struct {
+	cfg     Config
+	store   Store
+	logger  *slog.Logger
+	now     func() time.Time
+	started time.Time
+	changed chan struct{}
+
+	mu sync.RWMutex
+	// stable is the ring every member has had time to observe.
+	stable *Ring
+	// current is the ring of the members seen on the last renewal.
+	current     *Ring
+	settleUntil time.Time
+	// leaseUntil is when this instance stops owning devices unless renewed.
+	leaseUntil time.Time
+}
+
+// WithClock sets the clock used for leases.
+func WithClock(now func() time.Time) func(*Coordinator) {
+	return func(c *Coordinator) {
+		c.now = now
+	}
+}
+
+// New creates a coordinator.
+func New(cfg Config, store Store, logger *slog.Logger, opts ...func(*Coordinator)) (*Coordinator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.setDefaults()
+
+	c := &Coordinator{
+		cfg:     cfg,
+		store:   store,
+		logger:  logger,
+		now:     time.Now,
+		changed: make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.started = c.now()
+
+	return c, nil
+}
+
+// Run renews the lease every heartbeat interval until the context is
+// cancelled. The lease is kept until Leave, so that the devices are not
+// handed over while their collections are still draining.
+func (c *Coordinator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		c.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Changed is signalled whenever the set of devices this instance owns may
+// have changed.
+func (c *Coordinator) Changed() <-chan struct{} {
+	return c.changed
+}
+
+// Owns reports whether this instance should poll a device.
+func (c *Coordinator) Owns(id string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.now().Before(c.leaseUntil) || c.current.Owner(id) != c.cfg.Name {
+		return false
+	}
+
+	// While settling, only keep devices that were already ours.
+	return c.stable == c.current || c.stable.Owner(id) == c.cfg.Name
+}
+
+// Members returns the names of the live members.
+func (c *Coordinator) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.current.Members()
+}
+
+// tick renews the lease and refreshes the membership.
+func (c *Coordinator) tick(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.HeartbeatInterval)
+	defer cancel()
+
+	now := c.now()
+	member := elasticsearch.Member{
+		Name:      c.cfg.Name,
+		StartedAt: c.started,
+		RenewedAt: now,
+		ExpiresAt: now.Add(c.cfg.LeaseDuration),
+	}
+
+	err := c.store.Renew(ctx, &member)
+
+	var members []elasticsearch.Member
+	if err == nil {
+		members, err = c.store.Members(ctx, now)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.logger.Warn("renewing cluster lease", "error", err)
+
+		if c.current != nil && !now.Before(c.leaseUntil) {
+			c.logger.Error("cluster lease lost, releasing all devices", "instance", c.cfg.Name)
+
+			// Rejoin from scratch, as others may have taken over our devices.
+			c.stable, c.current = nil, nil
+			c.notify()
+		}
+
+		return
+	}
+
+	// Stop one heartbeat before the lease expires, before anyone else can
+	// take over.
+	c.leaseUntil = now.Add(c.cfg.LeaseDuration - c.cfg.HeartbeatInterval)
+
+	names := []string{c.cfg.Name}
+
+	for _, m := range members {
+		if m.Name == c.cfg.Name && !m.StartedAt.Equal(c.started) {
+			c.logger.Warn("another instance is using the same name", "instance", c.cfg.Name)
+		}
+
+		names = append(names, m.Name)
+	}
+
+	ring := NewRing(names)
+
+	switch {
+	case !ring.Equal(c.current):
+		// stable keeps the last agreed ring, also when the membership
+		// changes again before settling.
+		c.current = ring
+		c.settleUntil = now.Add(2 * c.cfg.HeartbeatInterval)
+
+		c.logger.Info("cluster membership changed", "members", ring.Members())
+		c.notify()
+	case c.stable != c.current && !now.Before(c.settleUntil):
+		c.stable = c.current
+
+		c.logger.Info("cluster membership settled", "members", ring.Members())
+		c.notify()
+	}
+}
+
+// Leave gives up the lease so that other instances take over at once. It
+// does nothing if this instance never held a lease.
+func (c *Coordinator) Leave() {
+	c.mu.Lock()
+	held := !c.leaseUntil.IsZero()
+	c.stable, c.current = nil, nil
+	c.leaseUntil = time.Time{}
+	c.mu.Unlock()
+
+	if !held {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.HeartbeatInterval)
+	defer cancel()
+
+	if err := c.store.Leave(ctx, c.cfg.Name); err != nil {
+		c.logger.Warn("leaving cluster", "error", err)
+	}
+}
+
+// notify signals a possible ownership change without blocking. The caller
+// must hold c.mu.
+func (c *Coordinator) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
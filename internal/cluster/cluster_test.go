@@ -0,0 +1,265 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+// memoryStore is a membership index shared by the instances of a test.
+type memoryStore struct {
+	mu      sync.Mutex
+	members map[string]elasticsearch.Member
+	down    map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		members: make(map[string]elasticsearch.Member),
+		down:    make(map[string]bool),
+	}
+}
+
+func (s *memoryStore) Renew(_ context.Context, member *elasticsearch.Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down[member.Name] {
+		return fmt.Errorf("connection refused")
+	}
+
+	s.members[member.Name] = *member
+
+	return nil
+}
+
+func (s *memoryStore) Members(_ context.Context, now time.Time) ([]elasticsearch.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var live []elasticsearch.Member
+
+	for _, m := range s.members {
+		if m.ExpiresAt.After(now) {
+			live = append(live, m)
+		}
+	}
+
+	return live, nil
+}
+
+func (s *memoryStore) Leave(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.members, name)
+
+	return nil
+}
+
+func TestRing(t *testing.T) {
+	before := NewRing([]string{"a", "b", "c"})
+	after := NewRing([]string{"a", "b", "c", "d"})
+
+	counts := make(map[string]int)
+	moved := 0
+
+	for i := range 3000 {
+		id := fmt.Sprintf("device-%d", i)
+		counts[before.Owner(id)]++
+
+		if owner := after.Owner(id); owner != before.Owner(id) {
+			moved++
+
+			if owner != "d" {
+				t.Fatalf("device %s moved between existing members", id)
+			}
+		}
+	}
+
+	for member, n := range counts {
+		if n < 700 || n > 1300 {
+			t.Errorf("member %s owns %d of 3000 devices", member, n)
+		}
+	}
+
+	if moved < 450 || moved > 1050 {
+		t.Errorf("expected about a quarter of the devices to move, got %d", moved)
+	}
+
+	if NewRing(nil).Owner("device-1") != "" {
+		t.Error("expected an empty ring to own nothing")
+	}
+}
+
+func TestCoordinator(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return now
+	}
+
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now = now.Add(d)
+	}
+
+	store := newMemoryStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := Config{HeartbeatInterval: 10 * time.Second, LeaseDuration: 30 * time.Second}
+
+	newCoordinator := func(name string) *Coordinator {
+		cfg := cfg
+		cfg.Name = name
+
+		c, err := New(cfg, store, logger, WithClock(clock))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		return c
+	}
+
+	a := newCoordinator("a")
+	b := newCoordinator("b")
+
+	devices := make([]string, 200)
+	for i := range devices {
+		devices[i] = fmt.Sprintf("device-%d", i)
+	}
+
+	// owned counts devices per instance and fails if any is polled twice.
+	owned := func(instances ...*Coordinator) map[string]int {
+		counts := make(map[string]int)
+
+		for _, id := range devices {
+			owners := 0
+
+			for _, c := range instances {
+				if c.Owns(id) {
+					owners++
+					counts[c.cfg.Name]++
+				}
+			}
+
+			if owners > 1 {
+				t.Fatalf("device %s is owned by %d instances", id, owners)
+			}
+		}
+
+		return counts
+	}
+
+	ctx := context.Background()
+	heartbeat := func(instances ...*Coordinator) {
+		advance(cfg.HeartbeatInterval)
+
+		for _, c := range instances {
+			c.tick(ctx)
+		}
+	}
+
+	// A new instance polls nothing until it has settled.
+	a.tick(ctx)
+
+	if counts := owned(a); counts["a"] != 0 {
+		t.Fatalf("expected nothing owned before settling, got %v", counts)
+	}
+
+	heartbeat(a)
+	heartbeat(a)
+
+	if counts := owned(a); counts["a"] != len(devices) {
+		t.Fatalf("expected a single instance to own every device, got %v", counts)
+	}
+
+	// A second instance joins; a gives up b's share at once and b takes it
+	// over after settling.
+	heartbeat(b, a)
+
+	if counts := owned(a, b); counts["b"] != 0 || counts["a"] == len(devices) {
+		t.Fatalf("expected a to shed devices before b picks them up, got %v", counts)
+	}
+
+	heartbeat(b, a)
+	heartbeat(b, a)
+
+	if counts := owned(a, b); counts["a"]+counts["b"] != len(devices) || counts["b"] == 0 {
+		t.Fatalf("expected the devices to be split, got %v", counts)
+	}
+
+	// b loses Elasticsearch: it stops polling before its lease expires, and
+	// a takes over once the lease has gone.
+	store.mu.Lock()
+	store.down["b"] = true
+	store.mu.Unlock()
+
+	for range 5 {
+		heartbeat(b, a)
+		owned(a, b)
+	}
+
+	if counts := owned(a, b); counts["a"] != len(devices) || counts["b"] != 0 {
+		t.Fatalf("expected a to own every device after b died, got %v", counts)
+	}
+
+	// b comes back and rejoins.
+	store.mu.Lock()
+	store.down["b"] = false
+	store.mu.Unlock()
+
+	for range 3 {
+		heartbeat(b, a)
+		owned(a, b)
+	}
+
+	if counts := owned(a, b); counts["a"]+counts["b"] != len(devices) || counts["b"] == 0 {
+		t.Fatalf("expected b to rejoin, got %v", counts)
+	}
+
+	// Leaving hands devices over without waiting for the lease to expire.
+	b.Leave()
+
+	for range 3 {
+		heartbeat(a)
+	}
+
+	if counts := owned(a, b); counts["a"] != len(devices) {
+		t.Fatalf("expected a to own every device after b left, got %v", counts)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "defaults", cfg: Config{Name: "getter01"}},
+		{name: "no name", cfg: Config{}, wantErr: true},
+		{name: "short heartbeat", cfg: Config{Name: "getter01", HeartbeatInterval: time.Millisecond}, wantErr: true},
+		{name: "short lease", cfg: Config{Name: "getter01", HeartbeatInterval: 20 * time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// replicas is the number of points each member places on the ring. More
+// points spread devices more evenly across members.
+const replicas = 128
+
+// point is a position on the ring owned by a member.
+type point struct {
+	hash   uint64
+	member string
+}
+
+// Ring assigns devices to members by consistent hashing, so that a member
+// joining or leaving only moves the devices it gains or loses.
+type Ring struct {
+	members []string
+	points  []point
+}
+
+// NewRing creates a ring over the given member names.
+func NewRing(members []string) *Ring {
+	r := &Ring{members: slices.Clone(members)}
+	slices.Sort(r.members)
+	r.members = slices.Compact(r.members)
+
+	for _, member := range r.members {
+		for i := range replicas {
+			r.points = append(r.points, point{hash: hash(member + "#" + strconv.Itoa(i)), member: member})
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].member < r.points[j].member
+		}
+
+		return r.points[i].hash < r.points[j].hash
+	})
+
+	return r
+}
+
+// Owner returns the member a device belongs to, or an empty string when the
+// ring has no members.
+func (r *Ring) Owner(id string) string {
+	if r == nil || len(r.points) == 0 {
+		return ""
+	}
+
+	h := hash(id)
+
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.points[i].member
+}
+
+// Members returns the sorted member names.
+func (r *Ring) Members() []string {
+	if r == nil {
+		return nil
+	}
+
+	return slices.Clone(r.members)
+}
+
+// Equal reports whether both rings have the same members.
+func (r *Ring) Equal(other *Ring) bool {
+	return slices.Equal(r.Members(), other.Members())
+}
+
+// hash returns a 64-bit position on the ring.
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -76,7 +76,7 @@ func (c *Collector) CollectMetrics(ctx context.Context, cfg elasticsearch.Config
 	}
 
 	// Validate response.
-	if err := c.validateResponse(metrics); err != nil {
+	if err := c.validateResponse(metrics.Body); err != nil {
 		return fmt.Errorf("invalid response from exporter: %w", err)
 	}
 
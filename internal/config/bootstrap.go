@@ -2,10 +2,21 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/pelletier/go-toml/v2"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/breaker"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cluster"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/discovery"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/exporter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/sink"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/spool"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/trap"
 )
 
 // BootstrapConfiguration represents the initial configuration needed to start the service.
@@ -16,6 +27,17 @@ type BootstrapConfiguration struct {
 	Timing        TimingSettings        `toml:"timing"`
 	Backoff       BackoffSettings       `toml:"backoff"`
 	Metrics       MetricsSettings       `toml:"metrics"`
+	Health        HealthSettings        `toml:"health"`
+	Traps         TrapSettings          `toml:"traps"`
+	Discovery     DiscoverySettings     `toml:"discovery"`
+	Cluster       ClusterSettings       `toml:"cluster"`
+	Spool         SpoolSettings         `toml:"spool"`
+	Breakers      BreakerSettings       `toml:"circuit_breakers"`
+	Status        StatusSettings        `toml:"status"`
+	// Sinks lists further outputs documents are written to besides Elasticsearch.
+	Sinks []SinkSettings `toml:"sinks"`
+	// Exporters defines probe types or overrides the built-in ones, keyed by type name.
+	Exporters map[string]ProbeSettings `toml:"exporters"`
 }
 
 // InstanceSettings contains instance identification and basic settings.
@@ -26,10 +48,35 @@ type InstanceSettings struct {
 
 // ElasticsearchSettings contains the connection details for Elasticsearch.
 type ElasticsearchSettings struct {
-	Hosts           []string     `toml:"hosts"`
-	Index           string       `toml:"index"`
-	CertificateHash string       `toml:"certificate_hash"`
-	Auth            AuthSettings `toml:"auth"`
+	Hosts           []string       `toml:"hosts"`
+	Index           string         `toml:"index"`
+	CertificateHash string         `toml:"certificate_hash"`
+	Auth            AuthSettings   `toml:"auth"`
+	Output          OutputSettings `toml:"output"`
+}
+
+// OutputSettings controls how metrics documents are written.
+// Zero values select the Default* constants.
+type OutputSettings struct {
+	// DocumentMode is "sample" (one document per sample, the default) or
+	// "scrape" (one document per device scrape with a nested samples array).
+	DocumentMode string `toml:"document_mode"`
+	// HistogramMode is "flattened" (Prometheus-style _bucket/_sum/_count
+	// samples, the default) or "native" (Elasticsearch histogram fields).
+	HistogramMode string `toml:"histogram_mode"`
+	// IndexPrefix names the daily metrics indices (prefix-YYYY.MM.DD).
+	IndexPrefix   string   `toml:"index_prefix"`
+	BatchSize     int      `toml:"batch_size"`
+	FlushInterval Duration `toml:"flush_interval"`
+	Workers       int      `toml:"workers"`
+}
+
+// ProbeSettings describes the probe endpoint of a multi-target exporter type.
+// For built-in types, a non-empty path replaces the default and params are
+// merged over the default templates; an empty template removes a parameter.
+type ProbeSettings struct {
+	Path   string            `toml:"path"`
+	Params map[string]string `toml:"params"`
 }
 
 // AuthSettings contains authentication details.
@@ -47,8 +94,11 @@ type ConcurrencySettings struct {
 // TimingSettings controls various timeouts and intervals.
 type TimingSettings struct {
 	ConfigReloadInterval Duration `toml:"config_reload_interval"`
-	ScrapeTimeout       Duration `toml:"scrape_timeout"`
-	WriteTimeout        Duration `toml:"write_timeout"`
+	ScrapeTimeout        Duration `toml:"scrape_timeout"`
+	WriteTimeout         Duration `toml:"write_timeout"`
+	// ShutdownTimeout bounds each stage of shutdown: waiting for collections
+	// in progress, then flushing pending documents.
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
 }
 
 // BackoffSettings controls retry behaviour.
@@ -60,11 +110,299 @@ type BackoffSettings struct {
 }
 
 // MetricsSettings controls the collector's own metrics endpoint.
+// The endpoint is disabled when Port is 0.
 type MetricsSettings struct {
 	Port int    `toml:"port"`
 	Path string `toml:"path"`
 }
 
+// HealthSettings controls the liveness and readiness checks.
+// Zero values select the built-in defaults.
+type HealthSettings struct {
+	UnavailableThreshold Duration `toml:"unavailable_threshold"`
+	StallThreshold       Duration `toml:"stall_threshold"`
+}
+
+// TrapSettings controls the SNMP trap and inform receiver. Zero values select
+// the trap package defaults.
+type TrapSettings struct {
+	Enabled       bool   `toml:"enabled"`
+	ListenAddress string `toml:"listen_address"`
+	// Communities lists the SNMPv1 and v2c communities accepted; empty accepts any.
+	Communities []string           `toml:"communities"`
+	QueueSize   int                `toml:"queue_size"`
+	Users       []TrapUserSettings `toml:"users"`
+}
+
+// TrapUserSettings is an SNMPv3 user traps are accepted from. EngineID is the
+// hex encoded engine ID of the sending agent.
+type TrapUserSettings struct {
+	SecurityName  string `toml:"security_name"`
+	SecurityLevel string `toml:"security_level"`
+	AuthProtocol  string `toml:"auth_protocol"`
+	AuthPassword  string `toml:"auth_password"`
+	PrivProtocol  string `toml:"priv_protocol"`
+	PrivPassword  string `toml:"priv_password"`
+	EngineID      string `toml:"engine_id"`
+}
+
+// ReceiverConfig returns the trap receiver configuration.
+func (t *TrapSettings) ReceiverConfig() trap.Config {
+	cfg := trap.Config{
+		ListenAddress: t.ListenAddress,
+		Communities:   t.Communities,
+		QueueSize:     t.QueueSize,
+	}
+
+	for _, user := range t.Users {
+		cfg.Users = append(cfg.Users, trap.User{
+			USM: snmp.USM{
+				SecurityName:  user.SecurityName,
+				SecurityLevel: user.SecurityLevel,
+				AuthProtocol:  user.AuthProtocol,
+				AuthPassword:  user.AuthPassword,
+				PrivProtocol:  user.PrivProtocol,
+				PrivPassword:  user.PrivPassword,
+			},
+			EngineID: user.EngineID,
+		})
+	}
+
+	return cfg
+}
+
+// ClusterSettings controls sharding of the device fleet between getter
+// instances. Instances are told apart by their instance name, which must be
+// unique. Zero values select the cluster package defaults.
+type ClusterSettings struct {
+	Enabled bool `toml:"enabled"`
+	// Index holds the instance leases and must differ from the configuration index.
+	Index             string   `toml:"index"`
+	HeartbeatInterval Duration `toml:"heartbeat_interval"`
+	LeaseDuration     Duration `toml:"lease_duration"`
+}
+
+// CoordinatorConfig returns the cluster configuration for the named instance.
+func (c *ClusterSettings) CoordinatorConfig(name string) cluster.Config {
+	return cluster.Config{
+		Name:              name,
+		HeartbeatInterval: c.HeartbeatInterval.Duration,
+		LeaseDuration:     c.LeaseDuration.Duration,
+	}
+}
+
+// MembersIndex returns the index holding the instance leases.
+func (c *ClusterSettings) MembersIndex() string {
+	if c.Index == "" {
+		return cluster.DefaultIndex
+	}
+
+	return c.Index
+}
+
+// SpoolSettings controls the on-disk buffer metrics are written through.
+// Zero values select the spool package defaults.
+type SpoolSettings struct {
+	Enabled       bool     `toml:"enabled"`
+	Dir           string   `toml:"dir"`
+	SegmentSizeMB int64    `toml:"segment_size_mb"`
+	MaxSizeMB     int64    `toml:"max_size_mb"`
+	MaxAge        Duration `toml:"max_age"`
+}
+
+// SpoolConfig returns the spool configuration.
+func (s *SpoolSettings) SpoolConfig() spool.Config {
+	return spool.Config{
+		Dir:         s.Dir,
+		SegmentSize: s.SegmentSizeMB << 20,
+		MaxSize:     s.MaxSizeMB << 20,
+		MaxAge:      s.MaxAge.Duration,
+	}
+}
+
+// BreakerSettings controls the circuit breakers that skip collections from
+// failing exporters and devices. Exporters and devices each have their own
+// breakers, sharing these thresholds. Zero values select the breaker package
+// defaults.
+type BreakerSettings struct {
+	FailureThreshold int      `toml:"failure_threshold"`
+	OpenTimeout      Duration `toml:"open_timeout"`
+	SuccessThreshold int      `toml:"success_threshold"`
+}
+
+// BreakerConfig returns the circuit breaker configuration.
+func (b *BreakerSettings) BreakerConfig() breaker.Config {
+	return breaker.Config{
+		FailureThreshold: b.FailureThreshold,
+		OpenTimeout:      b.OpenTimeout.Duration,
+		SuccessThreshold: b.SuccessThreshold,
+	}
+}
+
+// StatusSettings controls the device status documents written to
+// Elasticsearch after every collection, one per device.
+type StatusSettings struct {
+	Enabled bool `toml:"enabled"`
+	// Index holds the status documents and must differ from the configuration
+	// index and the metrics indices.
+	Index string `toml:"index"`
+}
+
+// StatusIndex returns the index holding the status documents.
+func (s *StatusSettings) StatusIndex() string {
+	if s.Index == "" {
+		return elasticsearch.DefaultStatusIndex
+	}
+
+	return s.Index
+}
+
+// SinkSettings configures an output documents are written to. Only the
+// settings of its type apply; zero values select the sink package defaults.
+// Elasticsearch is always written to; an elasticsearch sink only sets its
+// filter.
+type SinkSettings struct {
+	Name string `toml:"name"`
+	// Type is "elasticsearch", "remote_write", "file" or "stdout".
+	Type string `toml:"type"`
+	// Kinds restricts the sink to "metric" or "alert" events; empty accepts both.
+	Kinds   []string `toml:"kinds"`
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+	// QueueSize is the number of writes queued for the sink before further
+	// writes are dropped.
+	QueueSize int `toml:"queue_size"`
+
+	// Remote write settings.
+	URL      string            `toml:"url"`
+	Username string            `toml:"username"`
+	Password string            `toml:"password"`
+	Headers  map[string]string `toml:"headers"`
+	Timeout  Duration          `toml:"timeout"`
+
+	// File settings.
+	Path       string `toml:"path"`
+	MaxSizeMB  int64  `toml:"max_size_mb"`
+	MaxBackups int    `toml:"max_backups"`
+}
+
+// Filter returns the sink's document filter.
+func (s *SinkSettings) Filter() (*sink.Filter, error) {
+	return sink.NewFilter(s.Kinds, s.Include, s.Exclude)
+}
+
+// RemoteWriteConfig returns the remote write configuration of the sink.
+func (s *SinkSettings) RemoteWriteConfig() sink.RemoteWriteConfig {
+	return sink.RemoteWriteConfig{
+		URL:      s.URL,
+		Username: s.Username,
+		Password: s.Password,
+		Headers:  s.Headers,
+		Timeout:  s.Timeout.Duration,
+	}
+}
+
+// FileConfig returns the file configuration of the sink.
+func (s *SinkSettings) FileConfig() sink.FileConfig {
+	return sink.FileConfig{
+		Path:       s.Path,
+		MaxSize:    s.MaxSizeMB << 20,
+		MaxBackups: s.MaxBackups,
+	}
+}
+
+// DiscoverySettings controls the subnet sweep run with the -discover flag.
+// Discovered devices are saved disabled, using the collector settings and
+// tags given here unless a rule matching their sysObjectID overrides them.
+type DiscoverySettings struct {
+	Subnets            []string                `toml:"subnets"`
+	Port               int                     `toml:"port"`
+	Timeout            Duration                `toml:"timeout"`
+	Retries            int                     `toml:"retries"`
+	Concurrency        int                     `toml:"concurrency"`
+	Backend            string                  `toml:"backend"`
+	CollectorHostname  string                  `toml:"collector_hostname"`
+	Modules            []string                `toml:"modules"`
+	Include            []string                `toml:"include"`
+	CollectionInterval string                  `toml:"collection_interval"`
+	Environment        string                  `toml:"environment"`
+	Location           string                  `toml:"location"`
+	Role               string                  `toml:"role"`
+	Credentials        []DiscoveryCredential   `toml:"credentials"`
+	Rules              []DiscoveryRuleSettings `toml:"rules"`
+}
+
+// DiscoveryCredential is a candidate credential tried against every address.
+type DiscoveryCredential struct {
+	Name          string `toml:"name"`
+	Version       string `toml:"version"`
+	Community     string `toml:"community"`
+	AuthName      string `toml:"auth_name"`
+	SecurityName  string `toml:"security_name"`
+	SecurityLevel string `toml:"security_level"`
+	AuthProtocol  string `toml:"auth_protocol"`
+	AuthPassword  string `toml:"auth_password"`
+	PrivProtocol  string `toml:"priv_protocol"`
+	PrivPassword  string `toml:"priv_password"`
+}
+
+// DiscoveryRuleSettings classifies devices by sysObjectID prefix.
+type DiscoveryRuleSettings struct {
+	Prefix  string   `toml:"prefix"`
+	Type    string   `toml:"type"`
+	Role    string   `toml:"role"`
+	Modules []string `toml:"modules"`
+}
+
+// DiscoveryConfig returns the discovery configuration.
+func (d *DiscoverySettings) DiscoveryConfig() discovery.Config {
+	cfg := discovery.Config{
+		Subnets:     d.Subnets,
+		Port:        d.Port,
+		Timeout:     d.Timeout.Duration,
+		Retries:     d.Retries,
+		Concurrency: d.Concurrency,
+		Template: elasticsearch.Config{
+			CollectorSettings: elasticsearch.CollectorSettings{
+				Backend:            d.Backend,
+				Hostname:           d.CollectorHostname,
+				Version:            "v1.0.0",
+				Modules:            d.Modules,
+				CollectionInterval: d.CollectionInterval,
+				Metrics:            elasticsearch.MetricsSettings{Include: d.Include},
+			},
+			Tags: elasticsearch.Tags{
+				Environment: d.Environment,
+				Location:    d.Location,
+				Role:        d.Role,
+			},
+		},
+	}
+
+	for _, c := range d.Credentials {
+		cfg.Credentials = append(cfg.Credentials, discovery.Credential{
+			Name:      c.Name,
+			Version:   c.Version,
+			Community: c.Community,
+			AuthName:  c.AuthName,
+			USM: snmp.USM{
+				SecurityName:  c.SecurityName,
+				SecurityLevel: c.SecurityLevel,
+				AuthProtocol:  c.AuthProtocol,
+				AuthPassword:  c.AuthPassword,
+				PrivProtocol:  c.PrivProtocol,
+				PrivPassword:  c.PrivPassword,
+			},
+		})
+	}
+
+	for _, r := range d.Rules {
+		cfg.Rules = append(cfg.Rules, discovery.Rule(r))
+	}
+
+	return cfg
+}
+
 // Duration is a wrapper around time.Duration for TOML parsing.
 type Duration struct {
 	time.Duration
@@ -83,18 +421,65 @@ func (d Duration) MarshalText() ([]byte, error) {
 	return []byte(d.Duration.String()), nil
 }
 
-// LoadBootstrapConfiguration loads the bootstrap configuration from a TOML file.
+// DefaultConfiguration returns the settings used for anything the
+// configuration file and environment leave unset.
+func DefaultConfiguration() BootstrapConfiguration {
+	return BootstrapConfiguration{
+		Instance: InstanceSettings{
+			LogLevel: DefaultLogLevel,
+		},
+		Concurrency: ConcurrencySettings{
+			MaxScrapers: DefaultMaximumDataCollectors,
+			MaxWriters:  DefaultMaximumDataWriters,
+		},
+		Timing: TimingSettings{
+			ConfigReloadInterval: Duration{DefaultConfigReloadInterval},
+			ScrapeTimeout:        Duration{DefaultScrapeTimeout},
+			WriteTimeout:         Duration{DefaultWriteTimeout},
+			ShutdownTimeout:      Duration{DefaultShutdownTimeout},
+		},
+		Backoff: BackoffSettings{
+			InitialInterval: Duration{DefaultRetryWaitSeconds * time.Second},
+			MaxInterval:     Duration{DefaultMaxRetryInterval},
+			MaxRetries:      DefaultMaximumRetryAttempts,
+			Multiplier:      DefaultRetryMultiplier,
+		},
+		Metrics: MetricsSettings{
+			Path: DefaultMetricsPath,
+		},
+	}
+}
+
+// LoadBootstrapConfiguration loads the bootstrap configuration in layers:
+// the defaults, the configuration file, secret files it references and
+// finally SNMPGETTER_* environment variables (see applyOverrides). The file
+// may be TOML, YAML or JSON, chosen by extension; keys that are not part of
+// the configuration are rejected.
 func LoadBootstrapConfiguration(path string) (*BootstrapConfiguration, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading configuration file: %w", err)
 	}
 
-	var config BootstrapConfiguration
-	if err := toml.Unmarshal(data, &config); err != nil {
+	raw, err := decodeFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	settings, secrets, err := splitSecrets(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	config := DefaultConfiguration()
+	if err := decodeSettings(settings, &config); err != nil {
 		return nil, fmt.Errorf("parsing configuration: %w", err)
 	}
 
+	if err := applyOverrides(&config, secrets); err != nil {
+		return nil, fmt.Errorf("applying overrides: %w", err)
+	}
+
 	if err := validateConfiguration(&config); err != nil {
 		return nil, fmt.Errorf("validating configuration: %w", err)
 	}
@@ -116,12 +501,38 @@ func validateConfiguration(cfg *BootstrapConfiguration) error {
 		return fmt.Errorf("Elasticsearch index must be specified")
 	}
 
-	if cfg.Concurrency.MaxScrapers < 1 {
-		return fmt.Errorf("max scrapers must be at least 1")
+	if err := validateOutput(&cfg.Elasticsearch); err != nil {
+		return err
+	}
+
+	switch cfg.Instance.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		return fmt.Errorf("invalid log level: %s", cfg.Instance.LogLevel)
+	}
+
+	if cfg.Concurrency.MaxScrapers < MinimumDataCollectors || cfg.Concurrency.MaxScrapers > MaximumDataCollectors {
+		return fmt.Errorf("max scrapers must be between %d and %d", MinimumDataCollectors, MaximumDataCollectors)
+	}
+
+	if cfg.Concurrency.MaxWriters < MinimumDataWriters || cfg.Concurrency.MaxWriters > MaximumDataWriters {
+		return fmt.Errorf("max writers must be between %d and %d", MinimumDataWriters, MaximumDataWriters)
 	}
 
-	if cfg.Concurrency.MaxWriters < 1 {
-		return fmt.Errorf("max writers must be at least 1")
+	if cfg.Backoff.MaxRetries < MinimumRetryAttempts || cfg.Backoff.MaxRetries > MaximumRetryAttempts {
+		return fmt.Errorf("max retries must be between %d and %d", MinimumRetryAttempts, MaximumRetryAttempts)
+	}
+
+	if wait := cfg.Backoff.InitialInterval.Duration; wait < MinimumRetryWaitSeconds*time.Second || wait > MaximumRetryWaitSeconds*time.Second {
+		return fmt.Errorf("initial retry interval must be between %ds and %ds", MinimumRetryWaitSeconds, MaximumRetryWaitSeconds)
+	}
+
+	if cfg.Backoff.MaxInterval.Duration < cfg.Backoff.InitialInterval.Duration {
+		return fmt.Errorf("max retry interval cannot be less than the initial interval")
+	}
+
+	if cfg.Backoff.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be at least 1")
 	}
 
 	if cfg.Timing.ConfigReloadInterval.Duration < time.Second {
@@ -136,5 +547,202 @@ func validateConfiguration(cfg *BootstrapConfiguration) error {
 		return fmt.Errorf("write timeout must be at least 1 second")
 	}
 
+	if cfg.Timing.ShutdownTimeout.Duration < time.Second {
+		return fmt.Errorf("shutdown timeout must be at least 1 second")
+	}
+
+	if cfg.Metrics.Port < 0 || cfg.Metrics.Port > 65535 {
+		return fmt.Errorf("invalid metrics port: %d", cfg.Metrics.Port)
+	}
+
+	if err := validateTraps(&cfg.Traps); err != nil {
+		return err
+	}
+
+	if cfg.Cluster.Enabled {
+		if err := cfg.Cluster.CoordinatorConfig(cfg.Instance.Name).Validate(); err != nil {
+			return fmt.Errorf("invalid cluster settings: %w", err)
+		}
+
+		if cfg.Cluster.MembersIndex() == cfg.Elasticsearch.Index {
+			return fmt.Errorf("cluster index must differ from the configuration index")
+		}
+	}
+
+	if cfg.Spool.Enabled {
+		if err := cfg.Spool.SpoolConfig().Validate(); err != nil {
+			return fmt.Errorf("invalid spool settings: %w", err)
+		}
+	}
+
+	if cfg.Status.Enabled {
+		prefix := cfg.Elasticsearch.Output.IndexPrefix
+		if prefix == "" {
+			prefix = DefaultMetricsIndexPrefix
+		}
+
+		index := cfg.Status.StatusIndex()
+
+		if index == cfg.Elasticsearch.Index || index == cfg.Cluster.MembersIndex() || strings.HasPrefix(index, prefix+"-") {
+			return fmt.Errorf("status index must differ from the configuration, cluster and metrics indices")
+		}
+	}
+
+	if err := cfg.Breakers.BreakerConfig().Validate(); err != nil {
+		return fmt.Errorf("invalid circuit breaker settings: %w", err)
+	}
+
+	if err := validateSinks(cfg.Sinks); err != nil {
+		return err
+	}
+
+	// Discovery is optional; only check it once subnets are configured.
+	if len(cfg.Discovery.Subnets) > 0 {
+		if err := cfg.Discovery.DiscoveryConfig().Validate(); err != nil {
+			return fmt.Errorf("invalid discovery settings: %w", err)
+		}
+	}
+
+	for name, probe := range cfg.Probes() {
+		if err := probe.Validate(); err != nil {
+			return fmt.Errorf("exporter %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Probes returns the built-in exporter probe types merged with the configured ones.
+func (c *BootstrapConfiguration) Probes() map[string]exporter.Probe {
+	probes := exporter.DefaultProbes()
+
+	for name, settings := range c.Exporters {
+		probe := probes[name]
+		if settings.Path != "" {
+			probe.Path = settings.Path
+		}
+
+		if probe.Params == nil {
+			probe.Params = make(map[string]string, len(settings.Params))
+		}
+
+		for param, text := range settings.Params {
+			probe.Params[param] = text
+		}
+
+		probes[name] = probe
+	}
+
+	return probes
+}
+
+// validateOutput validates the metrics output settings.
+func validateOutput(es *ElasticsearchSettings) error {
+	documentMode, err := schema.ParseDocumentMode(es.Output.DocumentMode)
+	if err != nil {
+		return err
+	}
+
+	histogramMode, err := schema.ParseHistogramMode(es.Output.HistogramMode)
+	if err != nil {
+		return err
+	}
+
+	// Elasticsearch histogram fields cannot be held in arrays of samples.
+	if histogramMode == schema.HistogramModeNative && documentMode != schema.DocumentModeSample {
+		return fmt.Errorf("native histogram mode requires the sample document mode")
+	}
+
+	if es.Output.IndexPrefix != "" && es.Output.IndexPrefix == es.Index {
+		return fmt.Errorf("metrics index prefix must differ from the configuration index")
+	}
+
+	if es.Output.BatchSize < 0 {
+		return fmt.Errorf("batch size cannot be negative")
+	}
+
+	if es.Output.FlushInterval.Duration < 0 {
+		return fmt.Errorf("flush interval cannot be negative")
+	}
+
+	if es.Output.Workers < 0 {
+		return fmt.Errorf("output workers cannot be negative")
+	}
+
+	return nil
+}
+
+// validateTraps validates the trap receiver settings.
+func validateTraps(t *TrapSettings) error {
+	if !t.Enabled {
+		return nil
+	}
+
+	if t.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(t.ListenAddress); err != nil {
+			return fmt.Errorf("invalid trap listen address: %w", err)
+		}
+	}
+
+	if t.QueueSize < 0 {
+		return fmt.Errorf("trap queue size cannot be negative")
+	}
+
+	for _, user := range t.ReceiverConfig().Users {
+		if _, err := user.USM.SecurityParameters(user.EngineID); err != nil {
+			return fmt.Errorf("trap user %s: %w", user.USM.SecurityName, err)
+		}
+	}
+
+	return nil
+}
+
+// validateSinks validates the output sinks.
+func validateSinks(sinks []SinkSettings) error {
+	names := make(map[string]bool, len(sinks))
+	seenElasticsearch := false
+
+	for i := range sinks {
+		s := &sinks[i]
+
+		if s.Name == "" {
+			return fmt.Errorf("sink %d: name must be specified", i+1)
+		}
+
+		if names[s.Name] {
+			return fmt.Errorf("duplicate sink name: %s", s.Name)
+		}
+
+		names[s.Name] = true
+
+		switch s.Type {
+		case sink.TypeElasticsearch:
+			if seenElasticsearch {
+				return fmt.Errorf("sink %s: only one elasticsearch sink may be configured", s.Name)
+			}
+
+			seenElasticsearch = true
+		case sink.TypeStdout:
+		case sink.TypeRemoteWrite:
+			if s.URL == "" {
+				return fmt.Errorf("sink %s: remote write URL must be specified", s.Name)
+			}
+		case sink.TypeFile:
+			if s.Path == "" {
+				return fmt.Errorf("sink %s: file path must be specified", s.Name)
+			}
+		default:
+			return fmt.Errorf("sink %s: unknown type: %s", s.Name, s.Type)
+		}
+
+		if s.MaxSizeMB < 0 || s.MaxBackups < 0 || s.Timeout.Duration < 0 || s.QueueSize < 0 {
+			return fmt.Errorf("sink %s: limits cannot be negative", s.Name)
+		}
+
+		if _, err := s.Filter(); err != nil {
+			return fmt.Errorf("sink %s: %w", s.Name, err)
+		}
+	}
+
 	return nil
 }
@@ -80,3 +80,98 @@ path = "/metrics"
 		t.Error("Expected error when loading nonexistent configuration file")
 	}
 }
+
+func TestBootstrapConfiguration_Probes(t *testing.T) {
+	cfg := BootstrapConfiguration{
+		Exporters: map[string]ProbeSettings{
+			"snmp":  {Params: map[string]string{"version": ""}},
+			"redis": {Path: "/scrape", Params: map[string]string{"target": "redis://{{.Host}}:{{.Port}}"}},
+		},
+	}
+
+	probes := cfg.Probes()
+
+	snmp := probes["snmp"]
+	if snmp.Path != "/snmp" || snmp.Params["target"] != "{{.Target}}" || snmp.Params["version"] != "" {
+		t.Errorf("expected the snmp override to merge over the defaults, got %+v", snmp)
+	}
+
+	redis, ok := probes["redis"]
+	if !ok || redis.Path != "/scrape" || len(redis.Params) != 1 {
+		t.Errorf("expected the redis probe type to be added, got %+v", redis)
+	}
+
+	if _, ok := probes["blackbox"]; !ok {
+		t.Error("expected built-in probe types to be kept")
+	}
+}
+
+func TestValidateTraps(t *testing.T) {
+	user := TrapUserSettings{
+		SecurityName:  "trapuser",
+		SecurityLevel: "authPriv",
+		AuthProtocol:  "SHA",
+		AuthPassword:  "authpassword",
+		PrivProtocol:  "AES",
+		PrivPassword:  "privpassword",
+		EngineID:      "80001f8880e9630000d61ff449",
+	}
+
+	badEngine := user
+	badEngine.EngineID = "not-hex"
+
+	tests := []struct {
+		name    string
+		traps   TrapSettings
+		wantErr bool
+	}{
+		{name: "disabled", traps: TrapSettings{ListenAddress: "bad"}},
+		{name: "defaults", traps: TrapSettings{Enabled: true}},
+		{name: "v3 user", traps: TrapSettings{Enabled: true, ListenAddress: ":1162", Users: []TrapUserSettings{user}}},
+		{name: "invalid address", traps: TrapSettings{Enabled: true, ListenAddress: "1162"}, wantErr: true},
+		{name: "negative queue", traps: TrapSettings{Enabled: true, QueueSize: -1}, wantErr: true},
+		{name: "invalid engine ID", traps: TrapSettings{Enabled: true, Users: []TrapUserSettings{badEngine}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTraps(&tt.traps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTraps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		sinks   []SinkSettings
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "all types", sinks: []SinkSettings{
+			{Name: "es", Type: "elasticsearch", Kinds: []string{"metric"}},
+			{Name: "prometheus", Type: "remote_write", URL: "http://prometheus:9090/api/v1/write", Include: []string{"if*"}},
+			{Name: "archive", Type: "file", Path: "/tmp/metrics.ndjson"},
+			{Name: "console", Type: "stdout", Kinds: []string{"alert"}},
+		}},
+		{name: "missing name", sinks: []SinkSettings{{Type: "stdout"}}, wantErr: true},
+		{name: "duplicate name", sinks: []SinkSettings{{Name: "a", Type: "stdout"}, {Name: "a", Type: "stdout"}}, wantErr: true},
+		{name: "unknown type", sinks: []SinkSettings{{Name: "kafka", Type: "kafka"}}, wantErr: true},
+		{name: "missing URL", sinks: []SinkSettings{{Name: "prometheus", Type: "remote_write"}}, wantErr: true},
+		{name: "missing path", sinks: []SinkSettings{{Name: "archive", Type: "file"}}, wantErr: true},
+		{name: "two elasticsearch", sinks: []SinkSettings{{Name: "a", Type: "elasticsearch"}, {Name: "b", Type: "elasticsearch"}}, wantErr: true},
+		{name: "unknown kind", sinks: []SinkSettings{{Name: "a", Type: "stdout", Kinds: []string{"log"}}}, wantErr: true},
+		{name: "invalid pattern", sinks: []SinkSettings{{Name: "a", Type: "stdout", Include: []string{"/(/"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSinks(tt.sinks)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSinks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
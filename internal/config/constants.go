@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Logging levels.
 const (
 	LogLevelDebug = "debug"
@@ -10,10 +12,30 @@ const (
 
 // Default values for application settings.
 const (
-	DefaultMaximumDataCollectors   = 5
-	DefaultMaximumDataWriters      = 3
-	DefaultMaximumRetryAttempts    = 3
-	DefaultRetryWaitSeconds        = 5
+	DefaultMaximumDataCollectors = 5
+	DefaultMaximumDataWriters    = 3
+	DefaultMaximumRetryAttempts  = 3
+	DefaultRetryWaitSeconds      = 5
+)
+
+// Default values for settings left out of the configuration file.
+const (
+	DefaultLogLevel             = LogLevelInfo
+	DefaultConfigReloadInterval = 5 * time.Minute
+	DefaultScrapeTimeout        = 30 * time.Second
+	DefaultWriteTimeout         = 10 * time.Second
+	DefaultShutdownTimeout      = 30 * time.Second
+	DefaultMaxRetryInterval     = time.Minute
+	DefaultRetryMultiplier      = 2.0
+	DefaultMetricsPath          = "/metrics"
+)
+
+// Default values for metrics output.
+const (
+	DefaultMetricsIndexPrefix = "snmp-metrics"
+	DefaultBatchSize          = 500
+	DefaultFlushInterval      = 5 * time.Second
+	DefaultBulkWorkers        = 2
 )
 
 // Minimum values for configuration validation.
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeFile decodes a configuration file into tables of settings, choosing
+// the format by extension: .yaml or .yml, .json, and TOML otherwise. Files in
+// the legacy YAML layout are migrated to the canonical one.
+func decodeFile(path string, data []byte) (map[string]any, error) {
+	var (
+		raw map[string]any
+		err error
+	)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&raw)
+	default:
+		err = toml.Unmarshal(data, &raw)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	normalised, err := normalise(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ = normalised.(map[string]any)
+	if raw == nil {
+		raw = map[string]any{}
+	}
+
+	if isLegacy(raw) {
+		return migrateLegacy(raw)
+	}
+
+	return raw, nil
+}
+
+// normalise converts decoded YAML and JSON values to the types TOML decodes
+// to, so that every format is read by the same decoder.
+func normalise(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			// YAML keys without a value are left unset.
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+
+			n, err := normalise(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			v[key] = n
+		}
+
+		return v, nil
+	case []any:
+		for i, value := range v {
+			n, err := normalise(value)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = n
+		}
+
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+
+		return v.Float64()
+	case int:
+		return int64(v), nil
+	case nil:
+		return nil, errors.New("lists cannot hold empty values")
+	default:
+		return v, nil
+	}
+}
+
+// decodeSettings decodes tables of settings over cfg, rejecting keys that
+// are not part of the configuration.
+func decodeSettings(raw map[string]any, cfg *BootstrapConfiguration) error {
+	data, err := toml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	err = toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(cfg)
+
+	var strict *toml.StrictMissingError
+	if errors.As(err, &strict) {
+		keys := make([]string, len(strict.Errors))
+		for i := range strict.Errors {
+			keys[i] = strings.Join(strict.Errors[i].Key(), ".")
+		}
+
+		return fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+
+	return err
+}
+
+// ConvertBootstrapConfiguration returns a configuration file, in any
+// supported format or layout, as TOML in the canonical layout. Secrets and
+// environment overrides are not applied.
+func ConvertBootstrapConfiguration(path string, data []byte) ([]byte, error) {
+	raw, err := decodeFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	settings, _, err := splitSecrets(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	cfg := BootstrapConfiguration{}
+	if err := decodeSettings(settings, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	return toml.Marshal(raw)
+}
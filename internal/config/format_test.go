@@ -0,0 +1,181 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestLoadBootstrapConfiguration_Formats(t *testing.T) {
+	secret := writeFile(t, "password", "secret\n")
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "toml", file: "config.toml", content: `
+[elasticsearch]
+hosts = ["http://es:9200"]
+index = "service_configuration"
+
+[elasticsearch.auth]
+password_file = "` + secret + `"
+
+[timing]
+scrape_timeout = "45s"
+
+[[sinks]]
+name = "console"
+type = "stdout"
+`},
+		{name: "yaml", file: "config.yaml", content: `
+elasticsearch:
+  hosts: [http://es:9200]
+  index: service_configuration
+  auth:
+    password_file: ` + secret + `
+timing:
+  scrape_timeout: 45s
+sinks:
+  - name: console
+    type: stdout
+`},
+		{name: "json", file: "config.json", content: `{
+  "elasticsearch": {
+    "hosts": ["http://es:9200"],
+    "index": "service_configuration",
+    "auth": {"password_file": "` + secret + `"}
+  },
+  "timing": {"scrape_timeout": "45s"},
+  "sinks": [{"name": "console", "type": "stdout"}]
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadBootstrapConfiguration(writeFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadBootstrapConfiguration() error = %v", err)
+			}
+
+			if cfg.Elasticsearch.Hosts[0] != "http://es:9200" || cfg.Elasticsearch.Auth.Password != "secret" {
+				t.Errorf("elasticsearch = %+v", cfg.Elasticsearch)
+			}
+
+			if cfg.Timing.ScrapeTimeout.Duration != 45*time.Second || cfg.Concurrency.MaxScrapers != DefaultMaximumDataCollectors {
+				t.Errorf("timing = %+v, concurrency = %+v", cfg.Timing, cfg.Concurrency)
+			}
+
+			if len(cfg.Sinks) != 1 || cfg.Sinks[0].Type != "stdout" {
+				t.Errorf("sinks = %+v", cfg.Sinks)
+			}
+		})
+	}
+}
+
+func TestLoadBootstrapConfiguration_UnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		key     string
+	}{
+		{name: "toml", file: "config.toml", content: "[elasticsearch]\nhosts = [\"http://es:9200\"]\nindex = \"c\"\nindx = \"c\"\n", key: "elasticsearch.indx"},
+		{name: "yaml", file: "config.yml", content: "elasticsearch:\n  hosts: [http://es:9200]\n  index: c\nconcurency:\n  max_scrapers: 2\n", key: "concurency"},
+		{name: "json", file: "config.json", content: `{"elasticsearch": {"hosts": ["http://es:9200"], "index": "c", "auth": {"passwd": "x"}}}`, key: "elasticsearch.auth.passwd"},
+		{name: "unknown secret reference", file: "config.toml", content: "[elasticsearch]\nhosts = [\"http://es:9200\"]\nindex = \"c\"\ntoken_file = \"/run/secrets/token\"\n", key: "elasticsearch.token_file"},
+		{name: "mixed layouts", file: "config.yaml", content: "config_elasticsearch:\n  hosts: [http://es:9200]\n  index: c\nconcurrency:\n  max_scrapers: 2\n", key: "concurrency.max_scrapers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadBootstrapConfiguration(writeFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("LoadBootstrapConfiguration() error = %v, want unknown key %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadBootstrapConfiguration_ExporterParamFile(t *testing.T) {
+	cfg, err := LoadBootstrapConfiguration(writeFile(t, "config.toml", `
+[elasticsearch]
+hosts = ["http://es:9200"]
+index = "service_configuration"
+
+[exporters.json.params]
+config_file = "/etc/json_exporter.yml"
+`))
+	if err != nil {
+		t.Fatalf("LoadBootstrapConfiguration() error = %v", err)
+	}
+
+	if cfg.Exporters["json"].Params["config_file"] != "/etc/json_exporter.yml" {
+		t.Errorf("exporter params = %v, want config_file kept", cfg.Exporters["json"].Params)
+	}
+}
+
+const legacyConfig = `
+config_elasticsearch:
+  hosts:
+    - https://elasticsearch.hedgehog.internal:9200
+  index: service_configuration
+  auth:
+    username: hedgehog_config_reader
+    password: ""
+app_settings:
+  log_level: "warn"
+  config_refresh_minutes: 10
+  concurrency:
+    max_concurrent_scrapers: 8
+    max_concurrent_writers: 4
+  retry:
+    max_attempts: 2
+    delay_seconds: 3
+`
+
+func TestLoadBootstrapConfiguration_Legacy(t *testing.T) {
+	cfg, err := LoadBootstrapConfiguration(writeFile(t, "config.yaml", legacyConfig))
+	if err != nil {
+		t.Fatalf("LoadBootstrapConfiguration() error = %v", err)
+	}
+
+	if cfg.Elasticsearch.Index != "service_configuration" || cfg.Elasticsearch.Auth.Username != "hedgehog_config_reader" {
+		t.Errorf("elasticsearch = %+v", cfg.Elasticsearch)
+	}
+
+	if cfg.Instance.LogLevel != LogLevelWarn || cfg.Timing.ConfigReloadInterval.Duration != 10*time.Minute {
+		t.Errorf("instance = %+v, timing = %+v", cfg.Instance, cfg.Timing)
+	}
+
+	if cfg.Concurrency.MaxScrapers != 8 || cfg.Concurrency.MaxWriters != 4 {
+		t.Errorf("concurrency = %+v", cfg.Concurrency)
+	}
+
+	if cfg.Backoff.MaxRetries != 2 || cfg.Backoff.InitialInterval.Duration != 3*time.Second {
+		t.Errorf("backoff = %+v", cfg.Backoff)
+	}
+
+	if _, err := LoadBootstrapConfiguration(writeFile(t, "config.yaml", legacyConfig+"  retry_forever: true\n")); err == nil {
+		t.Error("LoadBootstrapConfiguration() accepted an unknown legacy key")
+	}
+}
+
+func TestConvertBootstrapConfiguration(t *testing.T) {
+	out, err := ConvertBootstrapConfiguration("config.yaml", []byte(legacyConfig))
+	if err != nil {
+		t.Fatalf("ConvertBootstrapConfiguration() error = %v", err)
+	}
+
+	var cfg BootstrapConfiguration
+	if err := toml.NewDecoder(strings.NewReader(string(out))).DisallowUnknownFields().Decode(&cfg); err != nil {
+		t.Fatalf("decoding converted configuration: %v\n%s", err, out)
+	}
+
+	if cfg.Concurrency.MaxScrapers != 8 || cfg.Timing.ConfigReloadInterval.Duration != 10*time.Minute {
+		t.Errorf("converted configuration = %s", out)
+	}
+}
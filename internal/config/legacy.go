@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Top-level keys of the legacy YAML layout of config.yaml.
+const (
+	legacyElasticsearch = "config_elasticsearch"
+	legacyAppSettings   = "app_settings"
+)
+
+// legacyKeys maps the settings of the legacy layout to their canonical keys.
+// Values that need converting are handled by legacyValue.
+var legacyKeys = map[string]string{
+	"config_elasticsearch.hosts":                       "elasticsearch.hosts",
+	"config_elasticsearch.index":                       "elasticsearch.index",
+	"config_elasticsearch.certificate_hash":            "elasticsearch.certificate_hash",
+	"config_elasticsearch.auth.username":               "elasticsearch.auth.username",
+	"config_elasticsearch.auth.password":               "elasticsearch.auth.password",
+	"config_elasticsearch.auth.password_file":          "elasticsearch.auth.password_file",
+	"app_settings.log_level":                           "instance.log_level",
+	"app_settings.config_refresh_minutes":              "timing.config_reload_interval",
+	"app_settings.concurrency.max_concurrent_scrapers": "concurrency.max_scrapers",
+	"app_settings.concurrency.max_concurrent_writers":  "concurrency.max_writers",
+	"app_settings.retry.max_attempts":                  "backoff.max_retries",
+	"app_settings.retry.delay_seconds":                 "backoff.initial_interval",
+}
+
+// isLegacy reports whether a decoded file uses the legacy layout.
+func isLegacy(raw map[string]any) bool {
+	_, es := raw[legacyElasticsearch]
+	_, app := raw[legacyAppSettings]
+
+	return es || app
+}
+
+// migrateLegacy converts a file in the legacy layout to the canonical one.
+// The layouts cannot be mixed, and keys the legacy layout did not have are
+// rejected.
+func migrateLegacy(raw map[string]any) (map[string]any, error) {
+	out := map[string]any{}
+
+	var unknown []string
+
+	var migrate func(table map[string]any, path []string) error
+
+	migrate = func(table map[string]any, path []string) error {
+		for key, value := range table {
+			keyPath := append(append([]string(nil), path...), key)
+			legacy := strings.Join(keyPath, ".")
+
+			if sub, ok := value.(map[string]any); ok {
+				if err := migrate(sub, keyPath); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			canonical, ok := legacyKeys[legacy]
+			if !ok {
+				unknown = append(unknown, legacy)
+				continue
+			}
+
+			converted, err := legacyValue(legacy, value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", legacy, err)
+			}
+
+			setKey(out, strings.Split(canonical, "."), converted)
+		}
+
+		return nil
+	}
+
+	if err := migrate(raw, nil); err != nil {
+		return nil, err
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys in legacy layout: %s", strings.Join(unknown, ", "))
+	}
+
+	return out, nil
+}
+
+// legacyValue converts a legacy setting to its canonical form. The refresh
+// period and retry delay were plain numbers of minutes and seconds.
+func legacyValue(key string, value any) (any, error) {
+	var unit string
+
+	switch key {
+	case "app_settings.config_refresh_minutes":
+		unit = "m"
+	case "app_settings.retry.delay_seconds":
+		unit = "s"
+	default:
+		return value, nil
+	}
+
+	n, ok := value.(int64)
+	if !ok {
+		return nil, fmt.Errorf("must be a whole number")
+	}
+
+	return fmt.Sprintf("%d%s", n, unit), nil
+}
+
+// setKey sets a value in nested tables, creating the tables as needed.
+func setKey(table map[string]any, path []string, value any) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := table[name].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			table[name] = next
+		}
+
+		table = next
+	}
+
+	table[path[len(path)-1]] = value
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables that override settings.
+const EnvPrefix = "SNMPGETTER_"
+
+// secretSuffix marks a setting, in the file or the environment, whose value
+// is read from the named file, as with Docker and Kubernetes secrets.
+const secretSuffix = "_file"
+
+// applyOverrides layers secret file references and environment variables
+// over the settings read from the configuration file, in that order:
+//
+//	[elasticsearch.auth]
+//	password_file = "/run/secrets/es_password"
+//
+//	SNMPGETTER_ELASTICSEARCH_AUTH_PASSWORD=changeme
+//	SNMPGETTER_ELASTICSEARCH_AUTH_PASSWORD_FILE=/run/secrets/es_password
+//
+// Variables are named after the TOML keys of the setting, upper-cased and
+// joined by underscores. Lists are comma separated; tables of lists and maps
+// can only be set in the file. secrets maps the dotted keys of settings to
+// the files the configuration file references, see splitSecrets.
+func applyOverrides(cfg *BootstrapConfiguration, secrets map[string]string) error {
+	return walkSettings(reflect.ValueOf(cfg).Elem(), nil, func(path []string, field reflect.Value) error {
+		key := strings.Join(path, ".")
+
+		if name, ok := secrets[key]; ok {
+			if err := setFromFile(field, name); err != nil {
+				return fmt.Errorf("%s%s: %w", key, secretSuffix, err)
+			}
+		}
+
+		env := EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+
+		if value, ok := os.LookupEnv(env); ok {
+			if err := setValue(field, value); err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+		}
+
+		envFile := env + strings.ToUpper(secretSuffix)
+
+		if name, ok := os.LookupEnv(envFile); ok {
+			if err := setFromFile(field, name); err != nil {
+				return fmt.Errorf("%s: %w", envFile, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// splitSecrets separates secret file references from the other settings of
+// a decoded file. Only settings applyOverrides can set have references; any
+// other key ending in _file is left in place, to be rejected as unknown or
+// kept as data such as an exporter parameter.
+func splitSecrets(raw map[string]any) (map[string]any, map[string]string, error) {
+	known := map[string]bool{}
+
+	_ = walkSettings(reflect.ValueOf(&BootstrapConfiguration{}).Elem(), nil, func(path []string, _ reflect.Value) error {
+		known[strings.Join(path, ".")] = true
+		return nil
+	})
+
+	secrets := map[string]string{}
+
+	var split func(table map[string]any, path []string) (map[string]any, error)
+
+	split = func(table map[string]any, path []string) (map[string]any, error) {
+		out := make(map[string]any, len(table))
+
+		for key, value := range table {
+			keyPath := append(append([]string(nil), path...), key)
+
+			if base, ok := strings.CutSuffix(key, secretSuffix); ok {
+				setting := strings.Join(append(append([]string(nil), path...), base), ".")
+
+				if known[setting] {
+					name, isString := value.(string)
+					if !isString {
+						return nil, fmt.Errorf("%s must be a file path", strings.Join(keyPath, "."))
+					}
+
+					secrets[setting] = name
+
+					continue
+				}
+			}
+
+			if sub, ok := value.(map[string]any); ok {
+				s, err := split(sub, keyPath)
+				if err != nil {
+					return nil, err
+				}
+
+				value = s
+			}
+
+			out[key] = value
+		}
+
+		return out, nil
+	}
+
+	settings, err := split(raw, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return settings, secrets, nil
+}
+
+// walkSettings calls fn for every setting of a struct that can be set from a
+// single string, identified by the path of its TOML keys.
+func walkSettings(v reflect.Value, path []string, fn func(path []string, field reflect.Value) error) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		key, _, _ := strings.Cut(sf.Tag.Get("toml"), ",")
+		if key == "" || key == "-" || !sf.IsExported() {
+			continue
+		}
+
+		field := v.Field(i)
+		fieldPath := append(append([]string(nil), path...), key)
+
+		switch {
+		case isText(field):
+			if err := fn(fieldPath, field); err != nil {
+				return err
+			}
+		case field.Kind() == reflect.Struct:
+			if err := walkSettings(field, fieldPath, fn); err != nil {
+				return err
+			}
+		case isScalar(field.Kind()), field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			if err := fn(fieldPath, field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isText reports whether a field parses itself from text, as Duration does.
+func isText(field reflect.Value) bool {
+	_, ok := field.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// isScalar reports whether a kind of field can be parsed from a string.
+func isScalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// setValue parses a setting from a string.
+func setValue(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+
+	return nil
+}
+
+// setFromFile sets a setting to the contents of a file, without the trailing
+// newline secret files usually end with.
+func setFromFile(field reflect.Value, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("reading secret: %w", err)
+	}
+
+	return setValue(field, strings.TrimRight(string(data), "\r\n"))
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to a file in a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestLoadBootstrapConfiguration_Layers(t *testing.T) {
+	secret := writeFile(t, "es_password", "from-secret-file\n")
+	envSecret := writeFile(t, "trap_password", "from-env-secret\n")
+
+	path := writeFile(t, "config.toml", `
+[instance]
+name = "test-instance"
+
+[elasticsearch]
+hosts = ["http://localhost:9200"]
+index = "service_configuration"
+
+[elasticsearch.auth]
+username = "reader"
+password_file = "`+secret+`"
+
+[concurrency]
+max_scrapers = 20
+`)
+
+	t.Setenv("SNMPGETTER_ELASTICSEARCH_HOSTS", "http://es1:9200, http://es2:9200")
+	t.Setenv("SNMPGETTER_CONCURRENCY_MAX_WRITERS", "7")
+	t.Setenv("SNMPGETTER_TIMING_SCRAPE_TIMEOUT", "45s")
+	t.Setenv("SNMPGETTER_TRAPS_ENABLED", "true")
+	t.Setenv("SNMPGETTER_DISCOVERY_CREDENTIALS", "ignored")
+	t.Setenv("SNMPGETTER_SPOOL_DIR_FILE", envSecret)
+
+	cfg, err := LoadBootstrapConfiguration(path)
+	if err != nil {
+		t.Fatalf("LoadBootstrapConfiguration() error = %v", err)
+	}
+
+	if cfg.Elasticsearch.Auth.Password != "from-secret-file" {
+		t.Errorf("password = %q, want the secret file contents", cfg.Elasticsearch.Auth.Password)
+	}
+
+	if len(cfg.Elasticsearch.Hosts) != 2 || cfg.Elasticsearch.Hosts[1] != "http://es2:9200" {
+		t.Errorf("hosts = %v, want the environment list", cfg.Elasticsearch.Hosts)
+	}
+
+	if cfg.Concurrency.MaxScrapers != 20 || cfg.Concurrency.MaxWriters != 7 {
+		t.Errorf("concurrency = %+v, want the file and environment values", cfg.Concurrency)
+	}
+
+	if cfg.Timing.ScrapeTimeout.Duration != 45*time.Second || cfg.Timing.WriteTimeout.Duration != DefaultWriteTimeout {
+		t.Errorf("timing = %+v, want the environment value and defaults", cfg.Timing)
+	}
+
+	if !cfg.Traps.Enabled || cfg.Spool.Dir != "from-env-secret" {
+		t.Errorf("traps enabled = %v, spool dir = %q", cfg.Traps.Enabled, cfg.Spool.Dir)
+	}
+
+	if cfg.Instance.LogLevel != DefaultLogLevel || cfg.Backoff.MaxRetries != DefaultMaximumRetryAttempts || cfg.Metrics.Path != DefaultMetricsPath {
+		t.Errorf("defaults not applied: %+v %+v %+v", cfg.Instance, cfg.Backoff, cfg.Metrics)
+	}
+}
+
+func TestLoadBootstrapConfiguration_OverrideErrors(t *testing.T) {
+	base := `
+[elasticsearch]
+hosts = ["http://localhost:9200"]
+index = "service_configuration"
+`
+
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+	}{
+		{name: "invalid number", content: base, env: map[string]string{"SNMPGETTER_CONCURRENCY_MAX_SCRAPERS": "many"}},
+		{name: "invalid duration", content: base, env: map[string]string{"SNMPGETTER_TIMING_WRITE_TIMEOUT": "soon"}},
+		{name: "missing secret file", content: base, env: map[string]string{"SNMPGETTER_ELASTICSEARCH_AUTH_PASSWORD_FILE": "/nonexistent"}},
+		{name: "secret reference not a path", content: base + "[elasticsearch.auth]\npassword_file = 1\n"},
+		{name: "above maximum", content: base, env: map[string]string{"SNMPGETTER_CONCURRENCY_MAX_WRITERS": "51"}},
+		{name: "retries above maximum", content: base, env: map[string]string{"SNMPGETTER_BACKOFF_MAX_RETRIES": "11"}},
+		{name: "retry wait below minimum", content: base, env: map[string]string{"SNMPGETTER_BACKOFF_INITIAL_INTERVAL": "100ms"}},
+		{name: "invalid log level", content: base, env: map[string]string{"SNMPGETTER_INSTANCE_LOG_LEVEL": "verbose"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			if _, err := LoadBootstrapConfiguration(writeFile(t, "config.toml", tt.content)); err == nil {
+				t.Error("LoadBootstrapConfiguration() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often the configuration file is checked for changes.
+const DefaultWatchInterval = 5 * time.Second
+
+// WatchFile calls fn whenever the modification time or size of a file
+// changes, checking every interval until ctx is done. The file is stat'ed
+// through symbolic links, so that ConfigMap updates in Kubernetes, which
+// swap a link, are seen too. A file that cannot be read is not a change.
+func WatchFile(ctx context.Context, path string, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			fn()
+		}
+	}
+}
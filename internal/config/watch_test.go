@@ -0,0 +1,37 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	path := writeFile(t, "config.toml", "[instance]\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+
+	go WatchFile(ctx, path, 10*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+
+	select {
+	case <-changed:
+		t.Fatal("WatchFile() reported an unchanged file")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("[instance]\nname = \"x\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("WatchFile() did not report the change")
+	}
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"strconv"
+	"strings"
+)
+
+// enterprisesPrefix is the OID under which vendors register their sysObjectIDs.
+const enterprisesPrefix = "1.3.6.1.4.1."
+
+// vendors maps IANA private enterprise numbers to vendor names.
+var vendors = map[int]string{
+	9:     "cisco",
+	11:    "hp",
+	43:    "3com",
+	311:   "microsoft",
+	1916:  "extreme",
+	1991:  "brocade",
+	2011:  "huawei",
+	2636:  "juniper",
+	3375:  "f5",
+	4526:  "netgear",
+	6027:  "dell",
+	6486:  "alcatel-lucent",
+	6527:  "nokia",
+	6876:  "vmware",
+	8072:  "net-snmp",
+	11863: "tp-link",
+	12356: "fortinet",
+	14823: "aruba",
+	14988: "mikrotik",
+	25461: "paloaltonetworks",
+	25506: "h3c",
+	30065: "arista",
+	41112: "ubiquiti",
+}
+
+// Vendor returns the vendor of a sysObjectID, or an empty string when the
+// enterprise is not known.
+func Vendor(objectID string) string {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(objectID, "."), enterprisesPrefix)
+	if !ok {
+		return ""
+	}
+
+	number, _, _ := strings.Cut(rest, ".")
+
+	enterprise, err := strconv.Atoi(number)
+	if err != nil {
+		return ""
+	}
+
+	return vendors[enterprise]
+}
+
+// classify returns the rule with the longest prefix matching a sysObjectID.
+// Prefixes match whole sub-identifiers, so 1.3.6.1.4.1.9 does not match
+// 1.3.6.1.4.1.99.
+func classify(rules []Rule, objectID string) *Rule {
+	objectID = strings.TrimPrefix(objectID, ".")
+
+	var best *Rule
+
+	for i := range rules {
+		prefix := strings.TrimPrefix(rules[i].Prefix, ".")
+
+		if objectID != prefix && !strings.HasPrefix(objectID, prefix+".") {
+			continue
+		}
+
+		if best == nil || len(prefix) > len(strings.TrimPrefix(best.Prefix, ".")) {
+			best = &rules[i]
+		}
+	}
+
+	return best
+}
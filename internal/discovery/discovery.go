@@ -0,0 +1,462 @@
+// Package discovery finds SNMP devices by sweeping subnets with candidate
+// credentials and creates disabled device configurations for review.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+)
+
+// Defaults used when a sweep leaves them unset.
+const (
+	DefaultTimeout     = time.Second
+	DefaultConcurrency = 32
+	DefaultDeviceType  = "network-device"
+)
+
+// MaxHosts bounds the number of addresses in a single subnet.
+const MaxHosts = 1 << 16
+
+// idPrefix starts the ID of every discovered device configuration.
+const idPrefix = "discovered-"
+
+// Credential is a set of SNMP credentials tried against every address.
+type Credential struct {
+	// Name identifies the credential on discovered devices.
+	Name      string
+	Version   string
+	Community string
+	// AuthName is the exporter auth holding the credential; Name when empty.
+	AuthName string
+	// USM holds the SNMPv3 settings used to probe; required for version 3.
+	USM snmp.USM
+}
+
+// Rule classifies devices whose sysObjectID starts with Prefix. Empty fields
+// keep the template's values.
+type Rule struct {
+	Prefix  string
+	Type    string
+	Role    string
+	Modules []string
+}
+
+// Config configures a sweep.
+type Config struct {
+	// Subnets are the CIDR ranges to sweep.
+	Subnets     []string
+	Port        int
+	Timeout     time.Duration
+	Retries     int
+	Concurrency int
+	// Credentials are tried in order; the first that answers is recorded.
+	Credentials []Credential
+	// Rules are matched by longest sysObjectID prefix.
+	Rules []Rule
+	// Template holds the collector settings and tags of created configurations.
+	Template elasticsearch.Config
+}
+
+// Device is an address that answered one of the credentials.
+type Device struct {
+	Address    string
+	Credential *Credential
+	System     snmp.System
+}
+
+// Identifier fetches the system group of a device.
+type Identifier func(ctx context.Context, target snmp.Target) (*snmp.System, error)
+
+// Store lists and saves device configurations.
+type Store interface {
+	ListConfigs(ctx context.Context) ([]elasticsearch.Config, error)
+	SaveConfig(ctx context.Context, config *elasticsearch.Config) error
+}
+
+// Discoverer sweeps subnets for SNMP devices.
+type Discoverer struct {
+	config   Config
+	prefixes []netip.Prefix
+	identify Identifier
+	logger   *slog.Logger
+}
+
+// New creates a discoverer after validating the configuration.
+func New(cfg Config, identify Identifier, logger *slog.Logger) (*Discoverer, error) {
+	cfg.setDefaults()
+
+	prefixes, err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discoverer{
+		config:   cfg,
+		prefixes: prefixes,
+		identify: identify,
+		logger:   logger,
+	}, nil
+}
+
+// Validate checks the subnets and credentials, and that every credential and
+// rule yields a valid device configuration.
+func (c Config) Validate() error {
+	c.setDefaults()
+	_, err := c.validate()
+
+	return err
+}
+
+func (c *Config) setDefaults() {
+	if c.Port == 0 {
+		c.Port = snmp.DefaultPort
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+
+	if c.Template.Type == "" {
+		c.Template.Type = DefaultDeviceType
+	}
+}
+
+func (c *Config) validate() ([]netip.Prefix, error) {
+	if len(c.Subnets) == 0 {
+		return nil, fmt.Errorf("at least one subnet is required")
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(c.Subnets))
+
+	for _, subnet := range c.Subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet: %w", err)
+		}
+
+		if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits > 16 {
+			return nil, fmt.Errorf("subnet %s has more than %d addresses", subnet, MaxHosts)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	if len(c.Credentials) == 0 {
+		return nil, fmt.Errorf("at least one credential is required")
+	}
+
+	names := make(map[string]bool, len(c.Credentials))
+
+	for i := range c.Credentials {
+		credential := &c.Credentials[i]
+		if credential.Name == "" {
+			return nil, fmt.Errorf("credential %d: name is required", i+1)
+		}
+
+		if names[credential.Name] {
+			return nil, fmt.Errorf("duplicate credential: %s", credential.Name)
+		}
+
+		names[credential.Name] = true
+
+		if _, err := newTarget(c, credential, "192.0.2.1"); err != nil {
+			return nil, fmt.Errorf("credential %s: %w", credential.Name, err)
+		}
+
+		// Created configurations must pass the same validation as hand-written ones.
+		device := &Device{Address: "192.0.2.1", Credential: credential}
+		if err := elasticsearch.ValidateConfig(configuration(c, device, time.Time{})); err != nil {
+			return nil, fmt.Errorf("credential %s: %w", credential.Name, err)
+		}
+	}
+
+	for _, rule := range c.Rules {
+		if rule.Prefix == "" {
+			return nil, fmt.Errorf("rule prefix is required")
+		}
+
+		device := &Device{
+			Address:    "192.0.2.1",
+			Credential: &c.Credentials[0],
+			System:     snmp.System{ObjectID: strings.TrimPrefix(rule.Prefix, ".")},
+		}
+		if err := elasticsearch.ValidateConfig(configuration(c, device, time.Time{})); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Prefix, err)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// Sweep probes every address of the subnets and returns the devices that
+// answered, ordered by address.
+func (d *Discoverer) Sweep(ctx context.Context) ([]Device, error) {
+	addrs := make(chan netip.Addr)
+
+	var (
+		mu      sync.Mutex
+		devices []Device
+		wg      sync.WaitGroup
+	)
+
+	for range d.config.Concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for addr := range addrs {
+				if device, ok := d.probe(ctx, addr.String()); ok {
+					mu.Lock()
+					devices = append(devices, *device)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, prefix := range d.prefixes {
+		d.logger.Info("sweeping subnet", "subnet", prefix.String())
+
+		if !sendHosts(ctx, prefix, addrs) {
+			break
+		}
+	}
+
+	close(addrs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		a, _ := netip.ParseAddr(devices[i].Address)
+		b, _ := netip.ParseAddr(devices[j].Address)
+
+		return a.Less(b)
+	})
+
+	return devices, nil
+}
+
+// sendHosts sends the host addresses of a prefix, leaving out the network
+// and broadcast addresses of IPv4 subnets larger than /31.
+func sendHosts(ctx context.Context, prefix netip.Prefix, addrs chan<- netip.Addr) bool {
+	first, last := prefix.Addr(), lastAddr(prefix)
+
+	if prefix.Addr().Is4() && prefix.Bits() < 31 {
+		first, last = first.Next(), last.Prev()
+	}
+
+	for addr := first; addr.IsValid() && !last.Less(addr); addr = addr.Next() {
+		select {
+		case addrs <- addr:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+
+	addr, _ := netip.AddrFromSlice(b)
+
+	return addr
+}
+
+// probe tries each credential against an address in turn.
+func (d *Discoverer) probe(ctx context.Context, addr string) (*Device, bool) {
+	for i := range d.config.Credentials {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		credential := &d.config.Credentials[i]
+
+		target, err := newTarget(&d.config, credential, addr)
+		if err != nil {
+			return nil, false
+		}
+
+		system, err := d.identify(ctx, target)
+		if err != nil {
+			d.logger.Debug("no answer", "address", addr, "credential", credential.Name, "error", err)
+			continue
+		}
+
+		d.logger.Info("discovered device",
+			"address", addr,
+			"credential", credential.Name,
+			"sys_object_id", system.ObjectID,
+			"sys_name", system.Name,
+		)
+
+		return &Device{Address: addr, Credential: credential, System: *system}, true
+	}
+
+	return nil, false
+}
+
+// newTarget builds the SNMP target probing an address with a credential.
+func newTarget(cfg *Config, credential *Credential, addr string) (snmp.Target, error) {
+	target := snmp.Target{
+		Host:      addr,
+		Port:      cfg.Port,
+		Version:   credential.Version,
+		Community: credential.Community,
+		Timeout:   cfg.Timeout,
+		Retries:   cfg.Retries,
+	}
+
+	switch credential.Version {
+	case "1", "2c":
+		if credential.Community == "" {
+			return target, fmt.Errorf("community is required")
+		}
+	case "3":
+		if err := credential.USM.Validate(); err != nil {
+			return target, err
+		}
+
+		usm := credential.USM
+		target.USM = &usm
+	default:
+		return target, fmt.Errorf("invalid SNMP version: %q", credential.Version)
+	}
+
+	return target, nil
+}
+
+// Save creates a disabled configuration for every device whose address or ID
+// is not configured yet, and returns the number created.
+func (d *Discoverer) Save(ctx context.Context, store Store, devices []Device) (int, error) {
+	existing, err := store.ListConfigs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("listing configurations: %w", err)
+	}
+
+	known := make(map[string]bool, 2*len(existing))
+	for i := range existing {
+		known[existing[i].ID] = true
+		known[existing[i].SNMPSettings.Host] = true
+	}
+
+	now := time.Now().UTC()
+	created := 0
+
+	for i := range devices {
+		cfg := configuration(&d.config, &devices[i], now)
+
+		if known[cfg.ID] || known[devices[i].Address] {
+			d.logger.Debug("device already configured", "address", devices[i].Address)
+			continue
+		}
+
+		if err := store.SaveConfig(ctx, cfg); err != nil {
+			return created, fmt.Errorf("saving configuration for %s: %w", devices[i].Address, err)
+		}
+
+		created++
+	}
+
+	return created, nil
+}
+
+// configuration builds the disabled configuration of a discovered device.
+func configuration(cfg *Config, device *Device, discoveredAt time.Time) *elasticsearch.Config {
+	c := cfg.Template
+	c.CollectorSettings.Modules = append([]string(nil), c.CollectorSettings.Modules...)
+	c.CollectorSettings.Metrics.Include = append([]string(nil), c.CollectorSettings.Metrics.Include...)
+	c.CollectorSettings.Metrics.Exclude = append([]string(nil), c.CollectorSettings.Metrics.Exclude...)
+	c.Exporter.Params = nil
+
+	c.ID = idPrefix + strings.NewReplacer(".", "-", ":", "-").Replace(device.Address)
+	c.Name = device.System.Name
+	c.Enabled = false
+
+	if c.Name == "" {
+		c.Name = device.Address
+	}
+
+	credential := device.Credential
+	c.SNMPSettings = elasticsearch.SNMPSettings{
+		Host:      device.Address,
+		Port:      cfg.Port,
+		Version:   credential.Version,
+		Community: credential.Community,
+		AuthName:  credential.AuthName,
+		Timeout:   formatDuration(cfg.Timeout),
+		Retries:   cfg.Retries,
+	}
+
+	if c.SNMPSettings.AuthName == "" {
+		c.SNMPSettings.AuthName = credential.Name
+	}
+
+	if credential.Version == "3" {
+		c.SNMPSettings.SecurityName = credential.USM.SecurityName
+		c.SNMPSettings.SecurityLevel = credential.USM.SecurityLevel
+		c.SNMPSettings.AuthProtocol = credential.USM.AuthProtocol
+		c.SNMPSettings.AuthPassword = credential.USM.AuthPassword
+		c.SNMPSettings.PrivProtocol = credential.USM.PrivProtocol
+		c.SNMPSettings.PrivPassword = credential.USM.PrivPassword
+		c.SNMPSettings.ContextName = credential.USM.ContextName
+		c.SNMPSettings.ContextEngineID = credential.USM.ContextEngineID
+	}
+
+	if rule := classify(cfg.Rules, device.System.ObjectID); rule != nil {
+		if rule.Type != "" {
+			c.Type = rule.Type
+		}
+
+		if rule.Role != "" {
+			c.Tags.Role = rule.Role
+		}
+
+		if len(rule.Modules) > 0 {
+			c.CollectorSettings.Modules = append([]string(nil), rule.Modules...)
+		}
+	}
+
+	c.Discovery = &elasticsearch.DiscoveryInfo{
+		Credential:   credential.Name,
+		SysObjectID:  device.System.ObjectID,
+		SysName:      device.System.Name,
+		SysDescr:     device.System.Descr,
+		Vendor:       Vendor(device.System.ObjectID),
+		DiscoveredAt: discoveredAt,
+	}
+
+	return &c
+}
+
+// formatDuration formats a timeout in the whole units device configurations accept.
+func formatDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+)
+
+// fakeStore records saved configurations.
+type fakeStore struct {
+	existing []elasticsearch.Config
+	saved    []elasticsearch.Config
+}
+
+func (s *fakeStore) ListConfigs(_ context.Context) ([]elasticsearch.Config, error) {
+	return s.existing, nil
+}
+
+func (s *fakeStore) SaveConfig(_ context.Context, config *elasticsearch.Config) error {
+	s.saved = append(s.saved, *config)
+	return nil
+}
+
+func testConfig() Config {
+	return Config{
+		Subnets: []string{"10.0.0.0/29"},
+		Credentials: []Credential{
+			{Name: "public_v2", Version: "2c", Community: "public"},
+			{Name: "private_v2", Version: "2c", Community: "private"},
+		},
+		Rules: []Rule{
+			{Prefix: "1.3.6.1.4.1.9", Role: "router"},
+			{Prefix: "1.3.6.1.4.1.9.1.1208", Role: "network-switch", Modules: []string{"if_mib", "cisco_switch"}},
+		},
+		Template: elasticsearch.Config{
+			CollectorSettings: elasticsearch.CollectorSettings{
+				Hostname:           "http://snmp.exporter.hedgehog.internal:9116",
+				Version:            "v1.0.0",
+				Modules:            []string{"if_mib"},
+				CollectionInterval: "1m",
+				Metrics:            elasticsearch.MetricsSettings{Include: []string{"*"}},
+			},
+			Tags: elasticsearch.Tags{Environment: "production", Location: "london", Role: "server"},
+		},
+	}
+}
+
+func TestDiscoverer(t *testing.T) {
+	// Devices answer a single community each.
+	answers := map[string]struct {
+		community string
+		system    snmp.System
+	}{
+		"10.0.0.2": {community: "public", system: snmp.System{ObjectID: "1.3.6.1.4.1.9.1.1208", Name: "switch02"}},
+		"10.0.0.3": {community: "private", system: snmp.System{ObjectID: "1.3.6.1.4.1.9.1.222"}},
+		"10.0.0.5": {community: "public", system: snmp.System{ObjectID: "1.3.6.1.4.1.8072.3.2.10", Name: "server05"}},
+	}
+
+	var (
+		mu     sync.Mutex
+		probed = make(map[string]int)
+	)
+
+	identify := func(_ context.Context, target snmp.Target) (*snmp.System, error) {
+		mu.Lock()
+		probed[target.Host]++
+		mu.Unlock()
+
+		answer, ok := answers[target.Host]
+		if !ok || answer.community != target.Community {
+			return nil, fmt.Errorf("request timeout")
+		}
+
+		system := answer.system
+
+		return &system, nil
+	}
+
+	d, err := New(testConfig(), identify, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	devices, err := d.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+
+	// A /29 has six hosts; the network and broadcast addresses are skipped.
+	if len(probed) != 6 || probed["10.0.0.0"] != 0 || probed["10.0.0.7"] != 0 {
+		t.Errorf("unexpected addresses probed: %v", probed)
+	}
+
+	if len(devices) != 3 || devices[0].Address != "10.0.0.2" || devices[1].Credential.Name != "private_v2" {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+
+	store := &fakeStore{existing: []elasticsearch.Config{{ID: "server05", SNMPSettings: elasticsearch.SNMPSettings{Host: "10.0.0.5"}}}}
+
+	created, err := d.Save(context.Background(), store, devices)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if created != 2 || len(store.saved) != 2 {
+		t.Fatalf("expected two configurations to be created, got %d", created)
+	}
+
+	sw := store.saved[0]
+	if sw.ID != "discovered-10-0-0-2" || sw.Name != "switch02" || sw.Enabled {
+		t.Errorf("unexpected configuration: %+v", sw)
+	}
+
+	if sw.Tags.Role != "network-switch" || len(sw.CollectorSettings.Modules) != 2 || sw.Discovery.Vendor != "cisco" {
+		t.Errorf("expected the longest matching rule to classify the switch, got %+v %+v", sw.Tags, sw.Discovery)
+	}
+
+	router := store.saved[1]
+	if router.Name != "10.0.0.3" || router.Tags.Role != "router" || router.SNMPSettings.Community != "private" ||
+		router.Discovery.Credential != "private_v2" || router.SNMPSettings.AuthName != "private_v2" {
+		t.Errorf("unexpected configuration: %+v", router)
+	}
+
+	if err := elasticsearch.ValidateConfig(&router); err != nil {
+		t.Errorf("expected a valid configuration, got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{name: "no subnets", modify: func(c *Config) { c.Subnets = nil }, wantErr: true},
+		{name: "invalid subnet", modify: func(c *Config) { c.Subnets = []string{"10.0.0.0"} }, wantErr: true},
+		{name: "subnet too large", modify: func(c *Config) { c.Subnets = []string{"10.0.0.0/8"} }, wantErr: true},
+		{name: "missing community", modify: func(c *Config) { c.Credentials[0].Community = "" }, wantErr: true},
+		{name: "duplicate credential", modify: func(c *Config) { c.Credentials[1].Name = "public_v2" }, wantErr: true},
+		{name: "invalid template", modify: func(c *Config) { c.Template.Tags.Environment = "" }, wantErr: true},
+		{name: "invalid v3 credential", modify: func(c *Config) {
+			c.Credentials[0] = Credential{Name: "v3", Version: "3", USM: snmp.USM{SecurityName: "admin", SecurityLevel: "authPriv"}}
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(&cfg)
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVendor(t *testing.T) {
+	tests := map[string]string{
+		"1.3.6.1.4.1.9.1.1208":  "cisco",
+		".1.3.6.1.4.1.2636.1.1": "juniper",
+		"1.3.6.1.4.1.99999.1":   "",
+		"1.3.6.1.2.1.1":         "",
+	}
+
+	for oid, want := range tests {
+		if got := Vendor(oid); got != want {
+			t.Errorf("Vendor(%s) = %q, want %q", oid, got, want)
+		}
+	}
+
+	if rule := classify([]Rule{{Prefix: "1.3.6.1.4.1.9"}}, "1.3.6.1.4.1.99.1"); rule != nil {
+		t.Errorf("expected prefixes to match whole sub-identifiers, got %+v", rule)
+	}
+}
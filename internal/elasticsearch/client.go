@@ -10,6 +10,7 @@ import (
 
 	esapi "github.com/elastic/go-elasticsearch/v8"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
 )
 
 // Client wraps the Elasticsearch client for our specific use case
@@ -28,15 +29,55 @@ type SNMPSettings struct {
 	Timeout             string `json:"timeout"`
 	Retries             int    `json:"retries"`
 	PollIntervalSeconds int    `json:"poll_interval_seconds"`
+
+	// SNMPv3 USM settings. With the exporter backend the credentials live in
+	// the exporter's auth named by AuthName and only ContextName is sent.
+	SecurityName    string `json:"security_name,omitempty"`
+	SecurityLevel   string `json:"security_level,omitempty"`
+	AuthProtocol    string `json:"auth_protocol,omitempty"`
+	AuthPassword    string `json:"auth_password,omitempty"`
+	PrivProtocol    string `json:"priv_protocol,omitempty"`
+	PrivPassword    string `json:"priv_password,omitempty"`
+	ContextName     string `json:"context_name,omitempty"`
+	ContextEngineID string `json:"context_engine_id,omitempty"`
+}
+
+// USM returns the SNMPv3 security settings of the device.
+func (s *SNMPSettings) USM() *snmp.USM {
+	return &snmp.USM{
+		SecurityName:    s.SecurityName,
+		SecurityLevel:   s.SecurityLevel,
+		AuthProtocol:    s.AuthProtocol,
+		AuthPassword:    s.AuthPassword,
+		PrivProtocol:    s.PrivProtocol,
+		PrivPassword:    s.PrivPassword,
+		ContextName:     s.ContextName,
+		ContextEngineID: s.ContextEngineID,
+	}
 }
 
+// Collection backends selectable per device.
+const (
+	// BackendExporter scrapes the device through a multi-target exporter.
+	BackendExporter = "exporter"
+	// BackendNative polls the device directly over SNMP.
+	BackendNative = "native"
+)
+
 // CollectorSettings contains settings for the SNMP metrics collector
 type CollectorSettings struct {
-	Hostname           string         `json:"hostname"`
-	Version            string         `json:"version"`
-	Modules            []string       `json:"modules"`
-	CollectionInterval string         `json:"collection_interval"`
-	Metrics           MetricsSettings `json:"metrics"`
+	// Backend is "exporter" (the default) or "native".
+	Backend            string          `json:"backend,omitempty"`
+	Hostname           string          `json:"hostname"`
+	Version            string          `json:"version"`
+	Modules            []string        `json:"modules"`
+	CollectionInterval string          `json:"collection_interval"`
+	Metrics            MetricsSettings `json:"metrics"`
+	// CounterBits sets the width, 32 or 64, of counters by sample name, so
+	// that a decrease can be told to be a wrap. The native backend knows the
+	// width of its module counters; counters scraped through an exporter
+	// have no width otherwise, and any decrease is taken as a reset.
+	CounterBits map[string]int `json:"counter_bits,omitempty"`
 }
 
 // MetricsSettings defines which metrics to collect
@@ -45,6 +86,18 @@ type MetricsSettings struct {
 	Exclude []string `json:"exclude,omitempty"`
 }
 
+// ExporterSettings selects the kind of multi-target exporter that is probed
+// for the device. An empty type means the SNMP exporter.
+type ExporterSettings struct {
+	// Type names a probe type: snmp, blackbox, ipmi, json or one defined in
+	// the bootstrap configuration.
+	Type string `json:"type,omitempty"`
+	// Path overrides the probe path of the type.
+	Path string `json:"path,omitempty"`
+	// Params are sent as additional query parameters, overriding templated ones.
+	Params map[string]string `json:"params,omitempty"`
+}
+
 // Tags contains metadata tags for the device
 type Tags struct {
 	Environment string `json:"environment"`
@@ -52,6 +105,17 @@ type Tags struct {
 	Role        string `json:"role"`
 }
 
+// DiscoveryInfo records how a discovered device was found: the name of the
+// candidate credential that answered and the device's system identification.
+type DiscoveryInfo struct {
+	Credential   string    `json:"credential"`
+	SysObjectID  string    `json:"sys_object_id"`
+	SysName      string    `json:"sys_name,omitempty"`
+	SysDescr     string    `json:"sys_descr,omitempty"`
+	Vendor       string    `json:"vendor,omitempty"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
 // Config represents a device configuration document in Elasticsearch
 type Config struct {
 	ID                string            `json:"id"`
@@ -60,20 +124,13 @@ type Config struct {
 	Enabled           bool              `json:"enabled"`
 	SNMPSettings      SNMPSettings      `json:"snmp_settings"`
 	CollectorSettings CollectorSettings `json:"collector_settings"`
+	Exporter          ExporterSettings  `json:"exporter,omitempty"`
 	Tags              Tags              `json:"tags"`
+	Discovery         *DiscoveryInfo    `json:"discovery,omitempty"`
 	CreatedAt         time.Time         `json:"created_at"`
 	UpdatedAt         time.Time         `json:"updated_at"`
 }
 
-// MetricsDocument represents a document to be stored in Elasticsearch.
-type MetricsDocument struct {
-	DeviceID    string            `json:"device_id"`
-	Environment string            `json:"environment"`
-	Location    string            `json:"location"`
-	Role        string            `json:"role"`
-	Metrics     schema.MetricsInfo `json:"metrics"`
-}
-
 // NewClient creates a new Elasticsearch client wrapper
 func NewClient(esclient *esapi.Client, index string, opts ...func(*Client)) *Client {
 	client := &Client{
@@ -88,48 +145,6 @@ func NewClient(esclient *esapi.Client, index string, opts ...func(*Client)) *Cli
 	return client
 }
 
-// ListConfigs retrieves all device configurations from Elasticsearch
-func (c *Client) ListConfigs(ctx context.Context) ([]Config, error) {
-	res, err := c.es.Search(
-		c.es.Search.WithContext(ctx),
-		c.es.Search.WithIndex(c.index),
-		c.es.Search.WithSize(1000),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("searching configs: %w", err)
-	}
-
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			return
-		}
-	}()
-
-	if res.IsError() {
-		body, _ := io.ReadAll(res.Body)
-		return nil, fmt.Errorf("search response error: %s", body)
-	}
-
-	var result struct {
-		Hits struct {
-			Hits []struct {
-				Source Config `json:"_source"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
-	}
-
-	configs := make([]Config, len(result.Hits.Hits))
-	for i, hit := range result.Hits.Hits {
-		configs[i] = hit.Source
-	}
-
-	return configs, nil
-}
-
 // SaveConfig saves a device configuration to Elasticsearch.
 func (c *Client) SaveConfig(ctx context.Context, config *Config) error {
 	if config == nil {
@@ -195,7 +210,7 @@ func (c *Client) DeleteConfig(ctx context.Context, id string) error {
 }
 
 // StoreMetrics stores a metrics document in Elasticsearch.
-func (c *Client) StoreMetrics(ctx context.Context, doc *MetricsDocument) error {
+func (c *Client) StoreMetrics(ctx context.Context, doc *schema.Document) error {
 	if doc == nil {
 		return fmt.Errorf("metrics document cannot be nil")
 	}
@@ -228,3 +243,54 @@ func (c *Client) StoreMetrics(ctx context.Context, doc *MetricsDocument) error {
 
 	return nil
 }
+
+// InstallMetricsTemplate installs an index template for the metrics indices
+// so that native histogram samples are mapped as Elasticsearch histograms.
+func (c *Client) InstallMetricsTemplate(ctx context.Context, indexPrefix string) error {
+	template := map[string]interface{}{
+		"index_patterns": []string{indexPrefix + "-*"},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"@timestamp": map[string]string{"type": "date"},
+					"metric": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"name":      map[string]string{"type": "keyword"},
+							"type":      map[string]string{"type": "keyword"},
+							"value":     map[string]string{"type": "double"},
+							"count":     map[string]string{"type": "long"},
+							"histogram": map[string]string{"type": "histogram"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("marshaling template: %w", err)
+	}
+
+	res, err := c.es.Indices.PutIndexTemplate(
+		indexPrefix,
+		bytes.NewReader(data),
+		c.es.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("putting index template: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("index template response error: %s", body)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -56,7 +57,7 @@ func TestClient(t *testing.T) {
 
 	// Test Save
 	t.Run("Save", func(t *testing.T) {
-		err := client.SaveConfig(ctx, config)
+		err := client.SaveConfig(ctx, &config)
 		require.NoError(t, err)
 
 		// Wait for indexing
@@ -68,7 +69,7 @@ func TestClient(t *testing.T) {
 		configs, err := client.ListConfigs(ctx)
 		require.NoError(t, err)
 		assert.NotEmpty(t, configs)
-		
+
 		var found bool
 		for _, c := range configs {
 			if c.ID == config.ID {
@@ -92,7 +93,7 @@ func TestClient(t *testing.T) {
 
 		configs, err := client.ListConfigs(ctx)
 		require.NoError(t, err)
-		
+
 		for _, c := range configs {
 			assert.NotEqual(t, config.ID, c.ID, "Config should have been deleted")
 		}
@@ -100,22 +101,26 @@ func TestClient(t *testing.T) {
 
 	// Test metrics storage
 	t.Run("StoreMetrics", func(t *testing.T) {
-		doc := MetricsDocument{
-			Timestamp:   time.Now(),
-			DeviceID:   config.ID,
-			DeviceName: config.Name,
-			DeviceType: config.Type,
-			Host:       config.SNMPSettings.Host,
-			Environment: config.Tags.Environment,
-			Location:    config.Tags.Location,
-			Role:        config.Tags.Role,
-			Metrics: map[string]interface{}{
-				"ifInOctets":  float64(1000),
-				"ifOutOctets": float64(2000),
+		doc := schema.Document{
+			Timestamp: time.Now(),
+			Host:      schema.HostInfo{Hostname: config.SNMPSettings.Host},
+			Device: schema.DeviceInfo{
+				ID:   config.ID,
+				Name: config.Name,
+				Type: config.Type,
+				Tags: schema.DeviceTags{
+					Environment: config.Tags.Environment,
+					Location:    config.Tags.Location,
+					Role:        config.Tags.Role,
+				},
+			},
+			Samples: []schema.Sample{
+				{Name: "ifInOctets", Type: "counter", Value: 1000},
+				{Name: "ifOutOctets", Type: "counter", Value: 2000},
 			},
 		}
 
-		err := client.StoreMetrics(ctx, doc)
+		err := client.StoreMetrics(ctx, &doc)
 		require.NoError(t, err)
 	})
 }
@@ -0,0 +1,158 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	esapi "github.com/elastic/go-elasticsearch/v8"
+)
+
+// maxMembers bounds the number of getter instances read from the membership
+// index.
+const maxMembers = 1000
+
+// Member is a getter instance's lease in the membership index.
+type Member struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	RenewedAt time.Time `json:"renewed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MemberStore keeps getter instance leases in an Elasticsearch index, one
+// document per instance name.
+type MemberStore struct {
+	es    *esapi.Client
+	index string
+}
+
+// NewMemberStore creates a membership store on the given index.
+func NewMemberStore(esclient *esapi.Client, index string) *MemberStore {
+	return &MemberStore{
+		es:    esclient,
+		index: index,
+	}
+}
+
+// Renew writes a member's lease, creating it if needed.
+func (s *MemberStore) Renew(ctx context.Context, member *Member) error {
+	data, err := json.Marshal(member)
+	if err != nil {
+		return fmt.Errorf("marshaling member: %w", err)
+	}
+
+	// Refresh so that other instances see the lease on their next read.
+	res, err := s.es.Index(
+		s.index,
+		bytes.NewReader(data),
+		s.es.Index.WithContext(ctx),
+		s.es.Index.WithDocumentID(member.Name),
+		s.es.Index.WithRefresh("true"),
+	)
+	if err != nil {
+		return fmt.Errorf("renewing lease: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("lease response error: %s", body)
+	}
+
+	return nil
+}
+
+// Members returns the members whose lease has not expired at now.
+func (s *MemberStore) Members(ctx context.Context, now time.Time) ([]Member, error) {
+	query := map[string]any{
+		"size": maxMembers,
+		"query": map[string]any{
+			"range": map[string]any{
+				"expires_at": map[string]any{"gt": now.UTC().Format(time.RFC3339Nano)},
+			},
+		},
+	}
+
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling search: %w", err)
+	}
+
+	res, err := s.es.Search(
+		s.es.Search.WithContext(ctx),
+		s.es.Search.WithIndex(s.index),
+		s.es.Search.WithBody(bytes.NewReader(data)),
+		// Before the first lease is written there is no index to search.
+		s.es.Search.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("searching members: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("search response error: %s", body)
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source Member `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	members := make([]Member, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		members[i] = hit.Source
+	}
+
+	return members, nil
+}
+
+// Leave removes a member's lease so that its devices are reassigned without
+// waiting for the lease to expire.
+func (s *MemberStore) Leave(ctx context.Context, name string) error {
+	res, err := s.es.Delete(
+		s.index,
+		name,
+		s.es.Delete.WithContext(ctx),
+		s.es.Delete.WithRefresh("true"),
+	)
+	if err != nil {
+		return fmt.Errorf("removing lease: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("delete response error: %s", body)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// configPageSize is the number of configurations retrieved per search
+	// request.
+	configPageSize = 500
+
+	// pointInTimeKeepAlive keeps a point in time open between pages.
+	pointInTimeKeepAlive = "1m"
+)
+
+// ConfigVersion identifies the stored revision of a device configuration.
+type ConfigVersion struct {
+	ID        string    `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListConfigs retrieves all device configurations from Elasticsearch, paging
+// through the index so that large estates are loaded in full.
+func (c *Client) ListConfigs(ctx context.Context) ([]Config, error) {
+	var configs []Config
+
+	err := c.scan(ctx, nil, nil, func(source json.RawMessage) error {
+		var config Config
+		if err := json.Unmarshal(source, &config); err != nil {
+			return fmt.Errorf("decoding config: %w", err)
+		}
+
+		configs = append(configs, config)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+// ListConfigVersions returns the ID and update time of every device
+// configuration without transferring the configurations themselves.
+func (c *Client) ListConfigVersions(ctx context.Context) ([]ConfigVersion, error) {
+	var versions []ConfigVersion
+
+	err := c.scan(ctx, nil, []string{"id", "updated_at"}, func(source json.RawMessage) error {
+		var version ConfigVersion
+		if err := json.Unmarshal(source, &version); err != nil {
+			return fmt.Errorf("decoding config version: %w", err)
+		}
+
+		versions = append(versions, version)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetConfigs retrieves the device configurations with the given IDs.
+// IDs that are not stored are ignored.
+func (c *Client) GetConfigs(ctx context.Context, ids []string) ([]Config, error) {
+	var configs []Config
+
+	for start := 0; start < len(ids); start += configPageSize {
+		end := min(start+configPageSize, len(ids))
+		query := map[string]any{
+			"terms": map[string]any{"id": ids[start:end]},
+		}
+
+		err := c.scan(ctx, query, nil, func(source json.RawMessage) error {
+			var config Config
+			if err := json.Unmarshal(source, &config); err != nil {
+				return fmt.Errorf("decoding config: %w", err)
+			}
+
+			configs = append(configs, config)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return configs, nil
+}
+
+// scan pages through the configuration documents matching query within a
+// point in time, passing the source of each hit to fn. A nil query matches
+// every document and a nil source returns whole documents.
+func (c *Client) scan(ctx context.Context, query map[string]any, source []string, fn func(json.RawMessage) error) error {
+	pit, err := c.openPointInTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		c.closePointInTime(context.WithoutCancel(ctx), pit)
+	}()
+
+	var searchAfter []json.RawMessage
+
+	for {
+		request := map[string]any{
+			"size":             configPageSize,
+			"pit":              map[string]string{"id": pit, "keep_alive": pointInTimeKeepAlive},
+			"sort":             []any{map[string]string{"_shard_doc": "asc"}},
+			"track_total_hits": false,
+		}
+
+		if query != nil {
+			request["query"] = query
+		}
+
+		if source != nil {
+			request["_source"] = source
+		}
+
+		if searchAfter != nil {
+			request["search_after"] = searchAfter
+		}
+
+		page, err := c.searchPage(ctx, request)
+		if err != nil {
+			return err
+		}
+
+		if page.PitID != "" {
+			pit = page.PitID
+		}
+
+		for _, hit := range page.Hits.Hits {
+			if err := fn(hit.Source); err != nil {
+				return err
+			}
+		}
+
+		if len(page.Hits.Hits) < configPageSize {
+			return nil
+		}
+
+		searchAfter = page.Hits.Hits[len(page.Hits.Hits)-1].Sort
+	}
+}
+
+// searchPage is a single page of search results within a point in time.
+type searchPage struct {
+	PitID string `json:"pit_id"`
+	Hits  struct {
+		Hits []struct {
+			Source json.RawMessage   `json:"_source"`
+			Sort   []json.RawMessage `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// searchPage runs one search request and decodes the page of results.
+func (c *Client) searchPage(ctx context.Context, request map[string]any) (*searchPage, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling search: %w", err)
+	}
+
+	res, err := c.es.Search(
+		c.es.Search.WithContext(ctx),
+		c.es.Search.WithBody(bytes.NewReader(data)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("searching configs: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("search response error: %s", body)
+	}
+
+	var page searchPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return &page, nil
+}
+
+// openPointInTime opens a point in time on the configuration index so that
+// pages are read from a consistent view.
+func (c *Client) openPointInTime(ctx context.Context) (string, error) {
+	res, err := c.es.OpenPointInTime(
+		[]string{c.index},
+		pointInTimeKeepAlive,
+		c.es.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("opening point in time: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return "", fmt.Errorf("point in time response error: %s", body)
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+
+	return result.ID, nil
+}
+
+// closePointInTime releases a point in time. Failures are ignored as the
+// point in time expires on its own.
+func (c *Client) closePointInTime(ctx context.Context, id string) {
+	data, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return
+	}
+
+	res, err := c.es.ClosePointInTime(
+		c.es.ClosePointInTime.WithContext(ctx),
+		c.es.ClosePointInTime.WithBody(bytes.NewReader(data)),
+	)
+	if err != nil {
+		return
+	}
+
+	_ = res.Body.Close()
+}
@@ -0,0 +1,180 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// fakeConfigIndex serves a configuration index through the point in time and
+// search APIs, one page at a time.
+type fakeConfigIndex struct {
+	mu       sync.Mutex
+	configs  []Config
+	searches int
+	open     int
+}
+
+func (f *fakeConfigIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/configs/_pit":
+		f.open++
+		fmt.Fprint(w, `{"id":"pit-1"}`)
+	case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+		f.open--
+		fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+	case r.URL.Path == "/_search":
+		f.search(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConfigIndex) search(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Size        int      `json:"size"`
+		SearchAfter []int    `json:"search_after"`
+		Source      []string `json:"_source"`
+		PIT         struct {
+			ID string `json:"id"`
+		} `json:"pit"`
+		Query struct {
+			Terms struct {
+				ID []string `json:"id"`
+			} `json:"terms"`
+		} `json:"query"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.PIT.ID != "pit-1" {
+		http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+		return
+	}
+
+	f.searches++
+
+	start := 0
+	if len(request.SearchAfter) == 1 {
+		start = request.SearchAfter[0] + 1
+	}
+
+	type hit struct {
+		Source any   `json:"_source"`
+		Sort   []int `json:"sort"`
+	}
+
+	hits := []hit{}
+
+	for i := start; i < len(f.configs) && len(hits) < request.Size; i++ {
+		config := f.configs[i]
+		if request.Query.Terms.ID != nil && !slices.Contains(request.Query.Terms.ID, config.ID) {
+			continue
+		}
+
+		var source any = config
+		if request.Source != nil {
+			source = ConfigVersion{ID: config.ID, UpdatedAt: config.UpdatedAt}
+		}
+
+		hits = append(hits, hit{Source: source, Sort: []int{i}})
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"pit_id": "pit-1",
+		"hits":   map[string]any{"hits": hits},
+	})
+}
+
+func newFakeConfigClient(t *testing.T, count int) (*Client, *fakeConfigIndex) {
+	t.Helper()
+
+	index := &fakeConfigIndex{}
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range count {
+		index.configs = append(index.configs, Config{
+			ID:        fmt.Sprintf("device-%04d", i),
+			Enabled:   true,
+			UpdatedAt: updated.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	server := httptest.NewServer(index)
+	t.Cleanup(server.Close)
+
+	esclient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	return NewClient(esclient, "configs"), index
+}
+
+func TestClient_ListConfigsPaginates(t *testing.T) {
+	client, index := newFakeConfigClient(t, 2*configPageSize+3)
+
+	configs, err := client.ListConfigs(context.Background())
+	if err != nil {
+		t.Fatalf("ListConfigs() error = %v", err)
+	}
+
+	if len(configs) != len(index.configs) {
+		t.Fatalf("expected %d configurations, got %d", len(index.configs), len(configs))
+	}
+
+	if configs[len(configs)-1].ID != index.configs[len(index.configs)-1].ID {
+		t.Errorf("unexpected last configuration %s", configs[len(configs)-1].ID)
+	}
+
+	if index.searches != 3 {
+		t.Errorf("expected 3 pages, got %d", index.searches)
+	}
+
+	if index.open != 0 {
+		t.Errorf("expected the point in time to be closed, %d open", index.open)
+	}
+}
+
+func TestClient_ListConfigVersions(t *testing.T) {
+	client, index := newFakeConfigClient(t, configPageSize)
+
+	versions, err := client.ListConfigVersions(context.Background())
+	if err != nil {
+		t.Fatalf("ListConfigVersions() error = %v", err)
+	}
+
+	// A full last page needs one more request to find the end.
+	if len(versions) != configPageSize || index.searches != 2 {
+		t.Fatalf("expected %d versions in 2 pages, got %d in %d", configPageSize, len(versions), index.searches)
+	}
+
+	if !versions[7].UpdatedAt.Equal(index.configs[7].UpdatedAt) || versions[7].ID != "device-0007" {
+		t.Errorf("unexpected version %+v", versions[7])
+	}
+}
+
+func TestClient_GetConfigs(t *testing.T) {
+	client, _ := newFakeConfigClient(t, 20)
+
+	configs, err := client.GetConfigs(context.Background(), []string{"device-0003", "device-0011", "missing"})
+	if err != nil {
+		t.Fatalf("GetConfigs() error = %v", err)
+	}
+
+	if len(configs) != 2 || configs[0].ID != "device-0003" || configs[1].ID != "device-0011" {
+		t.Errorf("unexpected configurations %+v", configs)
+	}
+}
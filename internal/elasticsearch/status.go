@@ -0,0 +1,181 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	esapi "github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// DefaultStatusIndex is the device status index used when none is configured.
+const DefaultStatusIndex = "snmp-getter-status"
+
+// DeviceStatus is the outcome of a device's latest collection. The status
+// index holds one per device, replaced after every collection, so that it
+// reads as a table of the fleet's health. A device that has been silent for
+// N intervals has a LastSuccess older than N times IntervalSeconds.
+type DeviceStatus struct {
+	Timestamp time.Time         `json:"@timestamp"`
+	Device    schema.DeviceInfo `json:"device"`
+	// Observer is the name of the getter instance that collected the device.
+	Observer string `json:"observer"`
+	// Exporter is the base URL of the exporter scraped; empty for native SNMP.
+	Exporter string   `json:"exporter,omitempty"`
+	Host     string   `json:"host"`
+	Modules  []string `json:"modules"`
+	// Outcome is "success", "failure" or "skipped".
+	Outcome         string  `json:"outcome"`
+	ErrorClass      string  `json:"error_class,omitempty"`
+	ErrorMessage    string  `json:"error_message,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Samples         int     `json:"samples"`
+	// Attempts is the number of scrapes made, retries included.
+	Attempts            int        `json:"attempts"`
+	IntervalSeconds     float64    `json:"interval_seconds"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// StatusWriter writes device status documents to the status index through
+// a bulk indexer, so that a collection does not wait for its status to be
+// written.
+type StatusWriter struct {
+	indexer esutil.BulkIndexer
+	logger  *slog.Logger
+}
+
+// NewStatusWriter creates a status writer on the given index, flushing at
+// least every flushInterval.
+func NewStatusWriter(esclient *esapi.Client, index string, flushInterval time.Duration, logger *slog.Logger) (*StatusWriter, error) {
+	w := &StatusWriter{logger: logger}
+
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        esclient,
+		Index:         index,
+		NumWorkers:    1,
+		FlushInterval: flushInterval,
+		OnError: func(_ context.Context, err error) {
+			w.logger.Error("status indexer error", "error", err)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulk indexer: %w", err)
+	}
+
+	w.indexer = indexer
+
+	return w, nil
+}
+
+// Write queues a device's status, replacing the previous one.
+func (w *StatusWriter) Write(ctx context.Context, status *DeviceStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("marshaling status: %w", err)
+	}
+
+	err = w.indexer.Add(ctx, esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: status.Device.ID,
+		Body:       bytes.NewReader(data),
+		OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			reason := res.Error.Reason
+			if err != nil {
+				reason = err.Error()
+			}
+
+			w.logger.Error("status rejected",
+				"device", status.Device.ID,
+				"status", res.Status,
+				"type", res.Error.Type,
+				"reason", reason,
+			)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add status to bulk indexer: %w", err)
+	}
+
+	return nil
+}
+
+// Close flushes queued statuses.
+func (w *StatusWriter) Close() error {
+	if err := w.indexer.Close(context.Background()); err != nil {
+		return fmt.Errorf("failed to close bulk indexer: %w", err)
+	}
+
+	return nil
+}
+
+// InstallStatusTemplate installs an index template for the status index so
+// that its fields can be filtered and grouped on.
+func (c *Client) InstallStatusTemplate(ctx context.Context, index string) error {
+	keyword := map[string]string{"type": "keyword"}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{index},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"@timestamp":           map[string]string{"type": "date"},
+					"observer":             keyword,
+					"exporter":             keyword,
+					"host":                 keyword,
+					"modules":              keyword,
+					"outcome":              keyword,
+					"error_class":          keyword,
+					"error_message":        map[string]string{"type": "text"},
+					"duration_seconds":     map[string]string{"type": "double"},
+					"samples":              map[string]string{"type": "long"},
+					"attempts":             map[string]string{"type": "integer"},
+					"interval_seconds":     map[string]string{"type": "double"},
+					"last_success":         map[string]string{"type": "date"},
+					"consecutive_failures": map[string]string{"type": "integer"},
+					"device": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"id":       keyword,
+							"name":     keyword,
+							"type":     keyword,
+							"exporter": keyword,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("marshaling template: %w", err)
+	}
+
+	res, err := c.es.Indices.PutIndexTemplate(
+		index,
+		bytes.NewReader(data),
+		c.es.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("putting index template: %w", err)
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("index template response error: %s", body)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+func TestStatusWriter(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		lines []map[string]any
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path != "/"+DefaultStatusIndex+"/_bulk" {
+			t.Errorf("Expected a bulk request on the status index, got %s", r.URL.Path)
+		}
+
+		var items int
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Errorf("Invalid bulk line: %v", err)
+			}
+
+			mu.Lock()
+			lines = append(lines, line)
+			mu.Unlock()
+
+			items++
+		}
+
+		resp := `{"errors":false,"items":[`
+		for i := 0; i < items/2; i++ {
+			if i > 0 {
+				resp += ","
+			}
+
+			resp += `{"index":{"status":200}}`
+		}
+
+		_, _ = io.WriteString(w, resp+"]}")
+	}))
+	defer server.Close()
+
+	esclient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer, err := NewStatusWriter(esclient, DefaultStatusIndex, time.Hour, logger)
+	if err != nil {
+		t.Fatalf("Failed to create status writer: %v", err)
+	}
+
+	status := &DeviceStatus{
+		Timestamp:  time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC),
+		Device:     schema.DeviceInfo{ID: "switch01"},
+		Outcome:    "failure",
+		ErrorClass: "timeout",
+		Attempts:   3,
+	}
+
+	if err := writer.Write(context.Background(), status); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected an action and a document, got %v", lines)
+	}
+
+	action, _ := lines[0]["index"].(map[string]any)
+	if action["_id"] != "switch01" {
+		t.Errorf("Expected the status to replace the device's document, got %v", lines[0])
+	}
+
+	if lines[1]["outcome"] != "failure" || lines[1]["attempts"] != float64(3) || lines[1]["error_class"] != "timeout" {
+		t.Errorf("Unexpected status document %v", lines[1])
+	}
+}
@@ -0,0 +1,56 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	esapi "github.com/elastic/go-elasticsearch/v8"
+)
+
+// ReloadableTransport is the transport of an Elasticsearch client whose
+// connection settings (addresses, credentials, TLS) can be replaced while the
+// client is in use. Requests already sent complete on the old connection.
+type ReloadableTransport struct {
+	current atomic.Pointer[transportHolder]
+}
+
+// transportHolder lets transports of any type share the atomic pointer.
+type transportHolder struct {
+	transport elastictransport.Interface
+}
+
+// NewReloadableClient creates an Elasticsearch client whose connection
+// settings can be replaced through the returned transport.
+func NewReloadableClient(cfg esapi.Config) (*esapi.Client, *ReloadableTransport, error) {
+	client, err := esapi.NewClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &ReloadableTransport{}
+	t.current.Store(&transportHolder{transport: client.Transport})
+
+	client.Transport = t
+
+	return client, t, nil
+}
+
+// Perform implements elastictransport.Interface.
+func (t *ReloadableTransport) Perform(req *http.Request) (*http.Response, error) {
+	return t.current.Load().transport.Perform(req)
+}
+
+// Reload replaces the connection settings. The current settings are kept if
+// the new ones are invalid.
+func (t *ReloadableTransport) Reload(cfg esapi.Config) error {
+	client, err := esapi.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("creating elasticsearch client: %w", err)
+	}
+
+	t.current.Store(&transportHolder{transport: client.Transport})
+
+	return nil
+}
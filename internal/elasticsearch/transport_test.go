@@ -0,0 +1,65 @@
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	esapi "github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestReloadableTransport(t *testing.T) {
+	var first, second atomic.Int32
+
+	server := func(hits *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hits.Add(1)
+			w.Header().Set("X-Elastic-Product", "Elasticsearch")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{}`))
+		}))
+	}
+
+	a, b := server(&first), server(&second)
+	defer a.Close()
+	defer b.Close()
+
+	client, transport, err := NewReloadableClient(esapi.Config{Addresses: []string{a.URL}})
+	if err != nil {
+		t.Fatalf("NewReloadableClient() error = %v", err)
+	}
+
+	ping := func() {
+		t.Helper()
+
+		res, err := client.Ping(client.Ping.WithContext(context.Background()))
+		if err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+		res.Body.Close()
+	}
+
+	ping()
+
+	if err := transport.Reload(esapi.Config{Addresses: []string{b.URL}}); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	ping()
+
+	if first.Load() != 1 || second.Load() != 1 {
+		t.Errorf("requests = %d, %d; want one to each server", first.Load(), second.Load())
+	}
+
+	if err := transport.Reload(esapi.Config{Addresses: []string{"://invalid"}}); err == nil {
+		t.Error("Reload() accepted an invalid address")
+	}
+
+	ping()
+
+	if second.Load() != 2 {
+		t.Error("an invalid reload replaced the connection settings")
+	}
+}
@@ -2,33 +2,33 @@ package elasticsearch
 
 import (
 	"context"
+	"fmt"
 	"time"
-)
 
-// MetricDocument represents a single metric data point in Elasticsearch
-type MetricDocument struct {
-	Timestamp   time.Time              `json:"@timestamp"`
-	DeviceID    string                 `json:"device_id"`
-	DeviceName  string                 `json:"device_name"`
-	MetricName  string                 `json:"metric_name"`
-	Value       float64                `json:"value"`
-	Labels      map[string]string      `json:"labels,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
-	Environment string                 `json:"environment"`
-}
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
 
 // Writer defines the interface for writing metrics to Elasticsearch
 type Writer interface {
 	// Write writes a batch of metric documents to Elasticsearch
-	Write(ctx context.Context, docs []MetricDocument) error
+	Write(ctx context.Context, docs []schema.Document) error
 
 	// WriteOne writes a single metric document to Elasticsearch
-	WriteOne(ctx context.Context, doc MetricDocument) error
+	WriteOne(ctx context.Context, doc schema.Document) error
 
-	// Close closes the writer and releases any resources
+	// Close flushes pending documents, closes the writer and releases any resources
 	Close() error
 }
 
+// WriterObserver is notified of bulk indexing outcomes.
+type WriterObserver interface {
+	// Flushed is called after every bulk request with its duration and error, if any.
+	Flushed(duration time.Duration, err error)
+
+	// ItemFailed is called for every document rejected in a bulk response.
+	ItemFailed(err *ItemError)
+}
+
 // WriterConfig holds configuration for the Elasticsearch writer
 type WriterConfig struct {
 	Addresses        []string      `json:"addresses" yaml:"addresses" toml:"addresses"`
@@ -37,6 +37,7 @@ type WriterConfig struct {
 	IndexPrefix      string        `json:"index_prefix" yaml:"index_prefix" toml:"index_prefix"`
 	BatchSize        int           `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
 	FlushInterval    time.Duration `json:"flush_interval" yaml:"flush_interval" toml:"flush_interval"`
+	NumWorkers       int           `json:"num_workers" yaml:"num_workers" toml:"num_workers"`
 	CertificateHash  string        `json:"certificate_hash" yaml:"certificate_hash" toml:"certificate_hash"`
 	RetryMaxAttempts int           `json:"retry_max_attempts" yaml:"retry_max_attempts" toml:"retry_max_attempts"`
 	RetryWaitTime    time.Duration `json:"retry_wait_time" yaml:"retry_wait_time" toml:"retry_wait_time"`
@@ -51,3 +52,58 @@ type ValidationError struct {
 func (e *ValidationError) Error() string {
 	return e.Field + ": " + e.Message
 }
+
+// ItemError represents a document rejected by the bulk API
+type ItemError struct {
+	Index      string
+	DocumentID string
+	Status     int
+	Type       string
+	Reason     string
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("indexing into %s failed with status %d: %s: %s", e.Index, e.Status, e.Type, e.Reason)
+}
+
+// mappingErrorTypes are the bulk item error types of documents that do not
+// fit the index mapping.
+var mappingErrorTypes = map[string]bool{
+	"mapper_parsing_exception":         true,
+	"document_parsing_exception":       true,
+	"strict_dynamic_mapping_exception": true,
+	"illegal_argument_exception":       true,
+}
+
+// MappingRejected reports whether the document was rejected because it does
+// not fit the index mapping; it will be rejected again until the mapping or
+// the document changes.
+func (e *ItemError) MappingRejected() bool {
+	return mappingErrorTypes[e.Type]
+}
+
+// Retryable reports whether indexing the document may succeed if retried.
+func (e *ItemError) Retryable() bool {
+	return retryableStatus(e.Status)
+}
+
+// UnavailableError is returned when Elasticsearch could not be reached or
+// was too busy to handle a request.
+type UnavailableError struct {
+	// Status is the status Elasticsearch answered with; 0 if it did not answer.
+	Status int
+	Err    error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("elasticsearch unavailable: %v", e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports that the request may succeed once Elasticsearch recovers.
+func (e *UnavailableError) Retryable() bool {
+	return true
+}
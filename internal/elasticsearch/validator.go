@@ -3,6 +3,9 @@ package elasticsearch
 import (
 	"fmt"
 	"regexp"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/filter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
 )
 
 var (
@@ -17,11 +20,16 @@ func ValidateConfig(config *Config) error {
 		return fmt.Errorf("config cannot be nil")
 	}
 
-	if err := validateSNMPSettings(&config.SNMPSettings); err != nil {
-		return fmt.Errorf("validating SNMP settings: %w", err)
+	// Other exporter types only need a host to probe.
+	if config.Exporter.Type == "" || config.Exporter.Type == "snmp" {
+		if err := validateSNMPSettings(&config.SNMPSettings, config.CollectorSettings.Backend); err != nil {
+			return fmt.Errorf("validating SNMP settings: %w", err)
+		}
+	} else if config.SNMPSettings.Host == "" {
+		return fmt.Errorf("validating SNMP settings: host is required")
 	}
 
-	if err := validateCollectorSettings(&config.CollectorSettings); err != nil {
+	if err := validateCollectorSettings(&config.CollectorSettings, config.Exporter.Type); err != nil {
 		return fmt.Errorf("validating collector settings: %w", err)
 	}
 
@@ -32,8 +40,8 @@ func ValidateConfig(config *Config) error {
 	return nil
 }
 
-// validateSNMPSettings validates SNMP configuration settings.
-func validateSNMPSettings(settings *SNMPSettings) error {
+// validateSNMPSettings validates SNMP configuration settings for the collection backend.
+func validateSNMPSettings(settings *SNMPSettings, backend string) error {
 	if settings == nil {
 		return fmt.Errorf("SNMP settings cannot be nil")
 	}
@@ -46,12 +54,24 @@ func validateSNMPSettings(settings *SNMPSettings) error {
 		return fmt.Errorf("invalid SNMP port: %d", settings.Port)
 	}
 
-	if settings.Version == "" {
+	switch settings.Version {
+	case "":
 		return fmt.Errorf("SNMP version is required")
-	}
-
-	if settings.Community == "" {
-		return fmt.Errorf("SNMP community string is required")
+	case "1", "2c":
+		if settings.Community == "" {
+			return fmt.Errorf("SNMP community string is required")
+		}
+	case "3":
+		// The exporter holds SNMPv3 credentials in its own auth configuration.
+		if backend == BackendNative {
+			if err := settings.USM().Validate(); err != nil {
+				return fmt.Errorf("invalid SNMPv3 settings: %w", err)
+			}
+		} else if settings.AuthName == "" {
+			return fmt.Errorf("auth name is required for SNMPv3 through the exporter")
+		}
+	default:
+		return fmt.Errorf("invalid SNMP version: %s", settings.Version)
 	}
 
 	if !durationRegex.MatchString(settings.Timeout) {
@@ -62,7 +82,7 @@ func validateSNMPSettings(settings *SNMPSettings) error {
 }
 
 // validateCollectorSettings validates collector configuration settings.
-func validateCollectorSettings(settings *CollectorSettings) error {
+func validateCollectorSettings(settings *CollectorSettings, exporterType string) error {
 	if settings == nil {
 		return fmt.Errorf("collector settings cannot be nil")
 	}
@@ -79,7 +99,7 @@ func validateCollectorSettings(settings *CollectorSettings) error {
 		return fmt.Errorf("invalid version format: %s", settings.Version)
 	}
 
-	if len(settings.Modules) == 0 {
+	if len(settings.Modules) == 0 && (exporterType == "" || exporterType == "snmp") {
 		return fmt.Errorf("at least one module must be specified")
 	}
 
@@ -87,6 +107,24 @@ func validateCollectorSettings(settings *CollectorSettings) error {
 		return fmt.Errorf("invalid collection interval format: %s", settings.CollectionInterval)
 	}
 
+	switch settings.Backend {
+	case "", BackendExporter:
+	case BackendNative:
+		for _, module := range settings.Modules {
+			if !snmp.HasModule(module) {
+				return fmt.Errorf("module %s is not available to the native backend", module)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid collection backend: %s", settings.Backend)
+	}
+
+	for name, bits := range settings.CounterBits {
+		if bits != 32 && bits != 64 {
+			return fmt.Errorf("invalid width %d for counter %s: must be 32 or 64", bits, name)
+		}
+	}
+
 	return validateMetrics(&settings.Metrics)
 }
 
@@ -116,6 +154,10 @@ func validateMetrics(metrics *MetricsSettings) error {
 		excluded[metric] = true
 	}
 
+	if _, err := filter.Compile(metrics.Include, metrics.Exclude); err != nil {
+		return fmt.Errorf("invalid metric filter: %w", err)
+	}
+
 	return nil
 }
 
@@ -128,7 +170,7 @@ func validateTags(tags *Tags) error {
 	validEnvironments := map[string]bool{
 		"development": true,
 		"staging":     true,
-		"production": true,
+		"production":  true,
 	}
 
 	if !validEnvironments[tags.Environment] {
@@ -0,0 +1,106 @@
+package elasticsearch
+
+import "testing"
+
+func TestValidateConfig_SNMPVersions(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			ID: "switch-01",
+			SNMPSettings: SNMPSettings{
+				Host:    "switch-01.network.hedgehog.internal",
+				Port:    161,
+				Version: "2c",
+				Timeout: "5s",
+			},
+			CollectorSettings: CollectorSettings{
+				Hostname:           "snmp.collector.hedgehog.internal",
+				Version:            "v1.0.0",
+				Modules:            []string{"if_mib"},
+				CollectionInterval: "1m",
+				Metrics:            MetricsSettings{Include: []string{"ifInOctets"}},
+			},
+			Tags: Tags{Environment: "production", Location: "london", Role: "network-switch"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{
+			name:   "v2c with community",
+			modify: func(c *Config) { c.SNMPSettings.Community = "public" },
+		},
+		{
+			name:    "v2c without community",
+			modify:  func(*Config) {},
+			wantErr: true,
+		},
+		{
+			name: "v3 through the exporter",
+			modify: func(c *Config) {
+				c.SNMPSettings.Version = "3"
+				c.SNMPSettings.AuthName = "secure_v3"
+				c.SNMPSettings.ContextName = "vlan-10"
+			},
+		},
+		{
+			name:    "v3 through the exporter without auth name",
+			modify:  func(c *Config) { c.SNMPSettings.Version = "3" },
+			wantErr: true,
+		},
+		{
+			name: "v3 native",
+			modify: func(c *Config) {
+				c.CollectorSettings.Backend = BackendNative
+				c.SNMPSettings.Version = "3"
+				c.SNMPSettings.SecurityName = "monitor"
+				c.SNMPSettings.SecurityLevel = "authNoPriv"
+				c.SNMPSettings.AuthProtocol = "SHA"
+				c.SNMPSettings.AuthPassword = "authpassword"
+			},
+		},
+		{
+			name: "v3 native without credentials",
+			modify: func(c *Config) {
+				c.CollectorSettings.Backend = BackendNative
+				c.SNMPSettings.Version = "3"
+				c.SNMPSettings.SecurityName = "monitor"
+				c.SNMPSettings.SecurityLevel = "authPriv"
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown version",
+			modify:  func(c *Config) { c.SNMPSettings.Version = "4" },
+			wantErr: true,
+		},
+		{
+			name: "counter widths",
+			modify: func(c *Config) {
+				c.SNMPSettings.Community = "public"
+				c.CollectorSettings.CounterBits = map[string]int{"ifInOctets": 32, "ifHCInOctets": 64}
+			},
+		},
+		{
+			name: "invalid counter width",
+			modify: func(c *Config) {
+				c.SNMPSettings.Community = "public"
+				c.CollectorSettings.CounterBits = map[string]int{"ifInOctets": 16}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			tt.modify(cfg)
+
+			if err := ValidateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
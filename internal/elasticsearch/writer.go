@@ -8,56 +8,83 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
 )
 
+// defaultNumWorkers is used when no worker count is configured.
+const defaultNumWorkers = 2
+
+// approxDocumentBytes estimates the encoded size of a per-sample document.
+// The bulk indexer flushes on size, so the batch size is converted to bytes.
+const approxDocumentBytes = 512
+
 // ESWriter implements the Writer interface for Elasticsearch
 type ESWriter struct {
 	client        *elasticsearch.Client
 	bulkIndexer   esutil.BulkIndexer
 	config        WriterConfig
 	indexPrefix   string
+	logger        *slog.Logger
+	observer      WriterObserver
 	mu            sync.RWMutex
 	isInitialized bool
 }
 
+// flushState carries per-flush bookkeeping through the bulk indexer hooks.
+type flushState struct {
+	start time.Time
+	items int
+	err   error
+}
+
+type flushStateKey struct{}
+
+// WithObserver registers an observer for bulk indexing outcomes.
+func WithObserver(observer WriterObserver) func(*ESWriter) {
+	return func(w *ESWriter) {
+		w.observer = observer
+	}
+}
+
 // NewWriter creates a new Elasticsearch writer
-func NewWriter(esclient *elasticsearch.Client, cfg WriterConfig) (*ESWriter, error) {
+func NewWriter(esclient *elasticsearch.Client, cfg WriterConfig, logger *slog.Logger, opts ...func(*ESWriter)) (*ESWriter, error) {
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("validating configuration: %w", err)
 	}
 
-	info, err := esclient.Info()
-	if err != nil {
-		return nil, fmt.Errorf("getting cluster info: %w", err)
+	if cfg.NumWorkers <= 0 {
+		cfg.NumWorkers = defaultNumWorkers
 	}
-	defer info.Body.Close()
 
-	var clusterInfo struct {
-		Version struct {
-			Number string `json:"number"`
-		} `json:"version"`
+	w := &ESWriter{
+		client:      esclient,
+		config:      cfg,
+		indexPrefix: cfg.IndexPrefix,
+		logger:      logger,
 	}
 
-	if err := json.NewDecoder(info.Body).Decode(&clusterInfo); err != nil {
-		return nil, fmt.Errorf("decoding cluster info: %w", err)
+	for _, opt := range opts {
+		opt(w)
 	}
 
-	bi, err := createBulkIndexer(esclient, cfg)
+	bi, err := w.createBulkIndexer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bulk indexer: %w", err)
 	}
 
-	return &ESWriter{
-		client:        esclient,
-		bulkIndexer:   bi,
-		config:        cfg,
-		indexPrefix:   cfg.IndexPrefix,
-		isInitialized: true,
-	}, nil
+	w.bulkIndexer = bi
+	w.isInitialized = true
+
+	return w, nil
 }
 
 func validateConfig(cfg *WriterConfig) error {
@@ -77,23 +104,53 @@ func validateConfig(cfg *WriterConfig) error {
 		return fmt.Errorf("flush interval must be positive")
 	}
 
+	if cfg.NumWorkers < 0 {
+		return fmt.Errorf("number of workers cannot be negative")
+	}
+
 	return nil
 }
 
-func createBulkIndexer(client *elasticsearch.Client, cfg WriterConfig) (esutil.BulkIndexer, error) {
+func (w *ESWriter) createBulkIndexer() (esutil.BulkIndexer, error) {
 	return esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Client:        client,
-		NumWorkers:    2, // Number of workers can be made configurable
-		FlushBytes:    5e6,
-		FlushInterval: cfg.FlushInterval,
+		Client:        w.client,
+		NumWorkers:    w.config.NumWorkers,
+		FlushBytes:    w.config.BatchSize * approxDocumentBytes,
+		FlushInterval: w.config.FlushInterval,
 		OnError: func(ctx context.Context, err error) {
-			fmt.Printf("bulk indexer error: %v\n", err)
+			// Failed flushes report the error twice, first with the flush
+			// context; record it there and log it on the second call.
+			if state, ok := ctx.Value(flushStateKey{}).(*flushState); ok {
+				state.err = err
+				return
+			}
+
+			w.logger.Error("bulk indexer error", "error", err)
+		},
+		OnFlushStart: func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, flushStateKey{}, &flushState{start: time.Now()})
+		},
+		OnFlushEnd: func(ctx context.Context) {
+			state, ok := ctx.Value(flushStateKey{}).(*flushState)
+			if !ok || w.observer == nil {
+				return
+			}
+
+			// Workers also flush when their buffer is empty; only report real requests.
+			if state.items > 0 || state.err != nil {
+				w.observer.Flushed(time.Since(state.start), state.err)
+			}
 		},
 	})
 }
 
-// Write implements the Writer interface
-func (w *ESWriter) Write(ctx context.Context, docs []MetricDocument) error {
+// Write implements the Writer interface. Documents are only queued on the
+// bulk indexer, so writes are fire and forget: the error reports invalid
+// documents and a closed indexer, never a failed bulk request or a rejected
+// document. Those reach the observer once the batch is flushed, and are not
+// classified or retried; use Send, or a SendWriter, for delivery the caller
+// can check.
+func (w *ESWriter) Write(ctx context.Context, docs []schema.Document) error {
 	w.mu.RLock()
 	if !w.isInitialized {
 		w.mu.RUnlock()
@@ -101,8 +158,8 @@ func (w *ESWriter) Write(ctx context.Context, docs []MetricDocument) error {
 	}
 	w.mu.RUnlock()
 
-	for _, doc := range docs {
-		if err := w.WriteOne(ctx, doc); err != nil {
+	for i := range docs {
+		if err := w.WriteOne(ctx, docs[i]); err != nil {
 			return fmt.Errorf("failed to write document: %w", err)
 		}
 	}
@@ -110,20 +167,21 @@ func (w *ESWriter) Write(ctx context.Context, docs []MetricDocument) error {
 	return nil
 }
 
-// WriteOne implements the Writer interface
-func (w *ESWriter) WriteOne(ctx context.Context, doc MetricDocument) error {
+// WriteOne implements the Writer interface. Like Write, it only queues the
+// document; rejections are reported to the observer once the batch is flushed.
+func (w *ESWriter) WriteOne(ctx context.Context, doc schema.Document) error {
 	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	if !w.isInitialized {
-		w.mu.RUnlock()
 		return errors.New("writer is not initialized")
 	}
-	w.mu.RUnlock()
 
-	if err := validateDocument(doc); err != nil {
+	if err := validateDocument(&doc); err != nil {
 		return fmt.Errorf("document validation failed: %w", err)
 	}
 
-	indexName := fmt.Sprintf("%s-%s", w.indexPrefix, doc.Timestamp.Format("2006.01.02"))
+	indexName := w.IndexName(doc.Timestamp)
 
 	docJSON, err := json.Marshal(doc)
 	if err != nil {
@@ -133,8 +191,10 @@ func (w *ESWriter) WriteOne(ctx context.Context, doc MetricDocument) error {
 	err = w.bulkIndexer.Add(ctx, esutil.BulkIndexerItem{
 		Action:     "index",
 		Index:      indexName,
-		DocumentID: generateDocumentID(doc),
+		DocumentID: generateDocumentID(&doc),
 		Body:       bytes.NewReader(docJSON),
+		OnSuccess:  countItem,
+		OnFailure:  w.onFailure,
 	})
 
 	if err != nil {
@@ -144,22 +204,297 @@ func (w *ESWriter) WriteOne(ctx context.Context, doc MetricDocument) error {
 	return nil
 }
 
-func validateDocument(doc MetricDocument) error {
+// Send indexes documents and waits for the result, bypassing the bulk
+// indexer's buffer. Documents go in a single bulk request, halved for as long
+// as Elasticsearch answers that the request is too large. Invalid documents,
+// documents too large to send on their own and documents the bulk API
+// rejects permanently are reported and dropped; any other failure returns an
+// error and the documents should be sent again. The error is an
+// *UnavailableError when Elasticsearch could not be reached or asked for the
+// documents to be sent again. Document IDs are stable, so documents indexed
+// by a failed request are overwritten rather than duplicated on retry.
+func (w *ESWriter) Send(ctx context.Context, docs []schema.Document) error {
+	entries := make([]bulkEntry, 0, len(docs))
+
+	for i := range docs {
+		doc := &docs[i]
+
+		if err := validateDocument(doc); err != nil {
+			w.logger.Error("dropping invalid document", "device", doc.Device.ID, "error", err)
+			continue
+		}
+
+		entry, err := w.encode(doc)
+		if err != nil {
+			w.logger.Error("dropping invalid document", "device", doc.Device.ID, "error", err)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return w.sendBatch(ctx, entries)
+}
+
+// SendWriter writes documents with Send rather than the bulk indexer, so that
+// failed writes are reported to the caller.
+type SendWriter struct {
+	*ESWriter
+}
+
+// Write implements the Writer interface.
+func (w SendWriter) Write(ctx context.Context, docs []schema.Document) error {
+	return w.Send(ctx, docs)
+}
+
+// WriteOne implements the Writer interface.
+func (w SendWriter) WriteOne(ctx context.Context, doc schema.Document) error {
+	return w.Send(ctx, []schema.Document{doc})
+}
+
+// bulkEntry is a document encoded for the bulk API: its action and source
+// lines.
+type bulkEntry struct {
+	item esutil.BulkIndexerItem
+	data []byte
+}
+
+// encode encodes a document for Send.
+func (w *ESWriter) encode(doc *schema.Document) (bulkEntry, error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+
+	item := esutil.BulkIndexerItem{
+		Action:     "index",
+		Index:      w.IndexName(doc.Timestamp),
+		DocumentID: generateDocumentID(doc),
+	}
+
+	meta := map[string]map[string]string{
+		item.Action: {"_index": item.Index, "_id": item.DocumentID},
+	}
+
+	if err := enc.Encode(meta); err != nil {
+		return bulkEntry{}, fmt.Errorf("failed to marshal action: %w", err)
+	}
+
+	if err := enc.Encode(doc); err != nil {
+		return bulkEntry{}, fmt.Errorf("failed to marshal document: %w", err)
+	}
+
+	return bulkEntry{item: item, data: buf.Bytes()}, nil
+}
+
+// sendBatch sends entries in one bulk request. A request that is too large
+// is split in two, down to single documents, which are then dropped.
+func (w *ESWriter) sendBatch(ctx context.Context, entries []bulkEntry) error {
+	var body bytes.Buffer
+
+	items := make([]esutil.BulkIndexerItem, len(entries))
+
+	for i := range entries {
+		body.Write(entries[i].data)
+		items[i] = entries[i].item
+	}
+
+	start := time.Now()
+	err := w.send(ctx, &body, items)
+
+	if w.observer != nil {
+		w.observer.Flushed(time.Since(start), err)
+	}
+
+	if !errors.Is(err, errRequestTooLarge) {
+		return err
+	}
+
+	if len(entries) == 1 {
+		w.onFailure(ctx, items[0], esutil.BulkIndexerResponseItem{Status: http.StatusRequestEntityTooLarge}, err)
+		return nil
+	}
+
+	half := len(entries) / 2
+
+	if err := w.sendBatch(ctx, entries[:half]); err != nil {
+		return err
+	}
+
+	return w.sendBatch(ctx, entries[half:])
+}
+
+// errRequestTooLarge is returned by send when Elasticsearch refuses a bulk
+// request for its size.
+var errRequestTooLarge = errors.New("bulk request too large")
+
+// retryableStatus reports whether a bulk item failure may succeed when retried.
+func retryableStatus(status int) bool {
+	return status == 429 || status >= 500
+}
+
+// send performs a bulk request for Send and checks every item.
+func (w *ESWriter) send(ctx context.Context, body *bytes.Buffer, items []esutil.BulkIndexerItem) error {
+	res, err := w.client.Bulk(body, w.client.Bulk.WithContext(ctx))
+	if err != nil {
+		return &UnavailableError{Err: fmt.Errorf("bulk request: %w", err)}
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			return
+		}
+	}()
+
+	if res.StatusCode == http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%w: %s", errRequestTooLarge, res.String())
+	}
+
+	if res.IsError() {
+		err := fmt.Errorf("bulk response error: %s", res.String())
+		if retryableStatus(res.StatusCode) {
+			return &UnavailableError{Status: res.StatusCode, Err: err}
+		}
+
+		return err
+	}
+
+	var blk esutil.BulkIndexerResponse
+	if err := json.NewDecoder(res.Body).Decode(&blk); err != nil {
+		return fmt.Errorf("decoding bulk response: %w", err)
+	}
+
+	if len(blk.Items) != len(items) {
+		return fmt.Errorf("bulk response has %d items, expected %d", len(blk.Items), len(items))
+	}
+
+	retry, status := 0, 0
+
+	for i, result := range blk.Items {
+		for _, info := range result {
+			if info.Error.Type == "" && info.Status <= 201 {
+				continue
+			}
+
+			if retryableStatus(info.Status) {
+				retry++
+				status = info.Status
+
+				continue
+			}
+
+			w.onFailure(ctx, items[i], info, nil)
+		}
+	}
+
+	if retry > 0 {
+		return &UnavailableError{
+			Status: status,
+			Err:    fmt.Errorf("%d of %d documents were not indexed and should be retried", retry, len(items)),
+		}
+	}
+
+	return nil
+}
+
+// IndexName returns the daily index a document with the given timestamp is written to.
+func (w *ESWriter) IndexName(ts time.Time) string {
+	return fmt.Sprintf("%s-%s", w.indexPrefix, ts.UTC().Format("2006.01.02"))
+}
+
+// countItem records a flushed document on the flush state.
+func countItem(ctx context.Context, _ esutil.BulkIndexerItem, _ esutil.BulkIndexerResponseItem) {
+	if state, ok := ctx.Value(flushStateKey{}).(*flushState); ok {
+		state.items++
+	}
+}
+
+// onFailure reports a document rejected by the bulk API.
+func (w *ESWriter) onFailure(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+	countItem(ctx, item, res)
+
+	itemErr := &ItemError{
+		Index:      item.Index,
+		DocumentID: item.DocumentID,
+		Status:     res.Status,
+		Type:       res.Error.Type,
+		Reason:     res.Error.Reason,
+	}
+
+	if err != nil {
+		itemErr.Reason = err.Error()
+	}
+
+	w.logger.Error("document rejected",
+		"index", itemErr.Index,
+		"document_id", itemErr.DocumentID,
+		"status", itemErr.Status,
+		"type", itemErr.Type,
+		"reason", itemErr.Reason,
+	)
+
+	if w.observer != nil {
+		w.observer.ItemFailed(itemErr)
+	}
+}
+
+// Stats returns the bulk indexer statistics.
+func (w *ESWriter) Stats() esutil.BulkIndexerStats {
+	return w.bulkIndexer.Stats()
+}
+
+func validateDocument(doc *schema.Document) error {
 	if doc.Timestamp.IsZero() {
 		return fmt.Errorf("timestamp is required")
 	}
-	if doc.DeviceID == "" {
+	if doc.Device.ID == "" {
 		return fmt.Errorf("device ID is required")
 	}
-	if doc.MetricName == "" {
+	if doc.Metric == nil && len(doc.Samples) == 0 && doc.Trap == nil {
+		return fmt.Errorf("metric sample or trap is required")
+	}
+	if doc.Metric != nil && doc.Metric.Name == "" {
 		return fmt.Errorf("metric name is required")
 	}
 	return nil
 }
 
-func generateDocumentID(doc MetricDocument) string {
-	idStr := fmt.Sprintf("%s-%s-%d", doc.DeviceID, doc.MetricName, doc.Timestamp.UnixNano())
-	hash := sha256.Sum256([]byte(idStr))
+// generateDocumentID derives a stable ID so that retried writes of the same
+// sample overwrite rather than duplicate it.
+func generateDocumentID(doc *schema.Document) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s-%d", doc.Device.ID, doc.Timestamp.UnixNano())
+
+	if doc.Metric != nil {
+		b.WriteString("-" + doc.Metric.Name)
+
+		keys := make([]string, 0, len(doc.Metric.Labels))
+		for k := range doc.Metric.Labels {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(&b, ",%s=%q", k, doc.Metric.Labels[k])
+		}
+	}
+
+	// Traps have no natural key; include the varbinds so that distinct
+	// notifications received in the same instant are kept apart.
+	if doc.Trap != nil {
+		b.WriteString("-" + doc.Trap.OID)
+
+		for _, v := range doc.Trap.Variables {
+			fmt.Fprintf(&b, ",%s=%q", v.OID, v.Value)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(b.String()))
 	return hex.EncodeToString(hash[:])
 }
 
@@ -1,8 +1,22 @@
 package elasticsearch
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -15,7 +29,7 @@ func TestValidateConfig(t *testing.T) {
 			name: "valid config",
 			cfg: &WriterConfig{
 				IndexPrefix:   "metrics",
-				BatchSize:    100,
+				BatchSize:     100,
 				FlushInterval: time.Second,
 			},
 			wantErr: false,
@@ -23,7 +37,7 @@ func TestValidateConfig(t *testing.T) {
 		{
 			name: "missing index prefix",
 			cfg: &WriterConfig{
-				BatchSize:    100,
+				BatchSize:     100,
 				FlushInterval: time.Second,
 			},
 			wantErr: true,
@@ -32,7 +46,7 @@ func TestValidateConfig(t *testing.T) {
 			name: "invalid batch size",
 			cfg: &WriterConfig{
 				IndexPrefix:   "metrics",
-				BatchSize:    0,
+				BatchSize:     0,
 				FlushInterval: time.Second,
 			},
 			wantErr: true,
@@ -41,7 +55,7 @@ func TestValidateConfig(t *testing.T) {
 			name: "invalid flush interval",
 			cfg: &WriterConfig{
 				IndexPrefix:   "metrics",
-				BatchSize:    100,
+				BatchSize:     100,
 				FlushInterval: 0,
 			},
 			wantErr: true,
@@ -64,16 +78,16 @@ func TestValidateConfig(t *testing.T) {
 }
 
 func TestGenerateDocumentID(t *testing.T) {
-	doc1 := &MetricsDocument{
-		DeviceID:   "device1",
-		MetricName: "metric1",
-		Timestamp:  time.Now(),
+	doc1 := &schema.Document{
+		Timestamp: time.Now(),
+		Device:    schema.DeviceInfo{ID: "device1"},
+		Metric:    &schema.Sample{Name: "metric1", Labels: map[string]string{"ifIndex": "1"}},
 	}
 
-	doc2 := &MetricsDocument{
-		DeviceID:   "device1",
-		MetricName: "metric1",
-		Timestamp:  doc1.Timestamp,
+	doc2 := &schema.Document{
+		Timestamp: doc1.Timestamp,
+		Device:    schema.DeviceInfo{ID: "device1"},
+		Metric:    &schema.Sample{Name: "metric1", Labels: map[string]string{"ifIndex": "1"}},
 	}
 
 	id1 := generateDocumentID(doc1)
@@ -82,4 +96,296 @@ func TestGenerateDocumentID(t *testing.T) {
 	if id1 != id2 {
 		t.Errorf("Expected identical IDs for same document content, got %s and %s", id1, id2)
 	}
+
+	doc2.Metric.Labels["ifIndex"] = "2"
+
+	if id3 := generateDocumentID(doc2); id3 == id1 {
+		t.Errorf("Expected different IDs for samples with different labels, got %s", id3)
+	}
+}
+
+// recordingObserver records bulk indexing outcomes.
+type recordingObserver struct {
+	mu      sync.Mutex
+	flushes int
+	failed  []*ItemError
+}
+
+func (o *recordingObserver) Flushed(_ time.Duration, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.flushes++
+}
+
+func (o *recordingObserver) ItemFailed(err *ItemError) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.failed = append(o.failed, err)
+}
+
+func TestESWriter_ReportsItemFailures(t *testing.T) {
+	var indices []string
+
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("Expected path /_bulk, got %s", r.URL.Path)
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]struct {
+				Index string `json:"_index"`
+			}
+
+			if err := json.Unmarshal(scanner.Bytes(), &action); err == nil {
+				if meta, ok := action["index"]; ok {
+					mu.Lock()
+					indices = append(indices, meta.Index)
+					mu.Unlock()
+				}
+			}
+		}
+
+		fmt.Fprint(w, `{"errors":true,"items":[
+			{"index":{"_index":"metrics-2025.02.18","status":201}},
+			{"index":{"_index":"metrics-2025.02.18","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [metric.value]"}}}
+		]}`)
+	}))
+	defer server.Close()
+
+	esclient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	observer := &recordingObserver{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer, err := NewWriter(esclient, WriterConfig{
+		IndexPrefix:   "metrics",
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+	}, logger, WithObserver(observer))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	ts := time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC)
+	docs := []schema.Document{
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifInOctets", Value: 1}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifOutOctets", Value: 2}},
+	}
+
+	if err := writer.Write(context.Background(), docs); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for _, index := range indices {
+		if index != "metrics-2025.02.18" {
+			t.Errorf("Expected daily index metrics-2025.02.18, got %s", index)
+		}
+	}
+
+	if len(observer.failed) != 1 {
+		t.Fatalf("Expected 1 failed item, got %d", len(observer.failed))
+	}
+
+	if observer.failed[0].Type != "mapper_parsing_exception" || observer.failed[0].Status != 400 {
+		t.Errorf("Unexpected item error: %v", observer.failed[0])
+	}
+
+	if observer.flushes != 1 {
+		t.Errorf("Expected 1 flush, got %d", observer.flushes)
+	}
+}
+
+func TestESWriter_Send(t *testing.T) {
+	// The first response throttles one document, the second accepts both.
+	responses := []string{
+		`{"errors":true,"items":[
+			{"index":{"_index":"metrics-2025.02.18","status":201}},
+			{"index":{"_index":"metrics-2025.02.18","status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}},
+			{"index":{"_index":"metrics-2025.02.18","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}
+		]}`,
+		`{"errors":false,"items":[
+			{"index":{"_index":"metrics-2025.02.18","status":200}},
+			{"index":{"_index":"metrics-2025.02.18","status":201}},
+			{"index":{"_index":"metrics-2025.02.18","status":200}}
+		]}`,
+	}
+
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		fmt.Fprint(w, responses[requests])
+		requests++
+	}))
+	defer server.Close()
+
+	esclient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	observer := &recordingObserver{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer, err := NewWriter(esclient, WriterConfig{
+		IndexPrefix:   "metrics",
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+	}, logger, WithObserver(observer))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	defer writer.Close()
+
+	ts := time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC)
+	docs := []schema.Document{
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifInOctets", Value: 1}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifOutOctets", Value: 2}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifSpeed", Value: 3}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}},
+	}
+
+	var unavailable *UnavailableError
+
+	err = writer.Send(context.Background(), docs)
+	if !errors.As(err, &unavailable) || unavailable.Status != 429 || !unavailable.Retryable() {
+		t.Fatalf("Expected throttled documents to be retried, got %v", err)
+	}
+
+	if len(observer.failed) != 1 || observer.failed[0].Status != 400 {
+		t.Fatalf("Expected the rejected document to be reported, got %v", observer.failed)
+	}
+
+	if rejected := observer.failed[0]; !rejected.MappingRejected() || rejected.Retryable() {
+		t.Errorf("Expected a permanent mapping rejection, got %v", rejected)
+	}
+
+	if err := writer.Send(context.Background(), docs); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if observer.flushes != 2 {
+		t.Errorf("Expected 2 flushes, got %d", observer.flushes)
+	}
+}
+
+func TestESWriter_SendSplitsLargeRequests(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		indexed []string
+		status  = http.StatusOK
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		var names []string
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var doc struct {
+				Metric *schema.Sample `json:"metric"`
+			}
+
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err == nil && doc.Metric != nil {
+				names = append(names, doc.Metric.Name)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Only single documents fit, and ifHuge does not fit at all.
+		if status != http.StatusOK || len(names) > 1 || names[0] == "ifHuge" {
+			code := status
+			if code == http.StatusOK {
+				code = http.StatusRequestEntityTooLarge
+			}
+
+			w.WriteHeader(code)
+			fmt.Fprint(w, `{"error":"refused"}`)
+
+			return
+		}
+
+		indexed = append(indexed, names...)
+		fmt.Fprint(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+	}))
+	defer server.Close()
+
+	esclient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	observer := &recordingObserver{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer, err := NewWriter(esclient, WriterConfig{
+		IndexPrefix:   "metrics",
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+	}, logger, WithObserver(observer))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	defer writer.Close()
+
+	ts := time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC)
+	docs := []schema.Document{
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifInOctets", Value: 1}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifHuge", Value: 2}},
+		{Timestamp: ts, Device: schema.DeviceInfo{ID: "switch01"}, Metric: &schema.Sample{Name: "ifOutOctets", Value: 3}},
+	}
+
+	if err := writer.Send(context.Background(), docs); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if len(indexed) != 2 || indexed[0] != "ifInOctets" || indexed[1] != "ifOutOctets" {
+		t.Errorf("Expected the documents that fit to be indexed, got %v", indexed)
+	}
+
+	if len(observer.failed) != 1 || observer.failed[0].Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the oversized document to be reported, got %v", observer.failed)
+	}
+
+	// Refused requests are kept for another attempt, whatever their status.
+	mu.Lock()
+	status = http.StatusUnauthorized
+	mu.Unlock()
+
+	if err := writer.Send(context.Background(), docs[:1]); err == nil {
+		t.Error("Send() error = nil, want an error for a refused request")
+	}
+
+	// Writes through a SendWriter report the failure to the caller.
+	mu.Lock()
+	status = http.StatusServiceUnavailable
+	mu.Unlock()
+
+	var unavailable *UnavailableError
+	if err := (SendWriter{writer}).WriteOne(context.Background(), docs[0]); !errors.As(err, &unavailable) {
+		t.Errorf("SendWriter.WriteOne() error = %v, want an *UnavailableError", err)
+	}
 }
@@ -6,14 +6,33 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// Client represents a client for the SNMP exporter.
+// AcceptHeader lists the exposition formats the client accepts, most preferred
+// first: delimited protobuf, OpenMetrics and the Prometheus text format.
+const AcceptHeader = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7," +
+	"application/openmetrics-text;version=1.0.0;q=0.6," +
+	"application/openmetrics-text;version=0.0.1;q=0.5," +
+	"text/plain;version=0.0.4;q=0.4," +
+	"*/*;q=0.1"
+
+// Response is a metrics response from the exporter.
+type Response struct {
+	// Body is the raw exposition.
+	Body []byte
+	// ContentType is the exposition format the exporter chose.
+	ContentType string
+}
+
+// Client represents a client for a multi-target exporter.
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	probe      *compiledProbe
+	timeout    time.Duration
 }
 
 // Config represents the configuration for the SNMP exporter client.
@@ -22,6 +41,10 @@ type Config struct {
 	BaseURL string
 	// Timeout is the timeout for HTTP requests.
 	Timeout time.Duration
+	// Transport is the HTTP transport to use (optional, defaults to http.DefaultTransport).
+	Transport http.RoundTripper
+	// Probe describes the exporter's probe endpoint (optional, defaults to the SNMP exporter).
+	Probe *Probe
 }
 
 // NewClient creates a new SNMP exporter client.
@@ -31,18 +54,38 @@ func NewClient(cfg Config) (*Client, error) {
 		return nil, fmt.Errorf("base URL must start with http:// or https://")
 	}
 
+	probe := cfg.Probe
+	if probe == nil {
+		snmp := DefaultProbes()[ProbeSNMP]
+		probe = &snmp
+	}
+
+	compiled, err := probe.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid probe: %w", err)
+	}
+
 	// Create HTTP client with timeout.
 	httpClient := &http.Client{
-		Timeout: cfg.Timeout,
+		Timeout:   cfg.Timeout,
+		Transport: cfg.Transport,
 	}
 
 	return &Client{
 		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
 		httpClient: httpClient,
+		probe:      compiled,
+		timeout:    cfg.Timeout,
 	}, nil
 }
 
-// QueryParams represents the parameters for querying the SNMP exporter.
+// BaseURL returns the exporter base URL the client queries.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// QueryParams represents the parameters for querying an exporter. The probe's
+// parameter templates decide which of them are sent.
 type QueryParams struct {
 	// Target is the SNMP device to query (required).
 	Target string
@@ -62,6 +105,8 @@ type QueryParams struct {
 	Timeout string
 	// Retries is the number of retries for failed requests (optional).
 	Retries int
+	// Params holds additional query parameters, overriding templated ones (optional).
+	Params map[string]string
 }
 
 // buildTargetString builds the target string with optional transport and port.
@@ -80,42 +125,12 @@ func (p *QueryParams) buildTargetString() string {
 	return target
 }
 
-// GetMetrics queries the SNMP exporter for metrics.
-func (c *Client) GetMetrics(ctx context.Context, params *QueryParams) ([]byte, error) {
-	// Build query parameters.
-	query := url.Values{}
-
-	// Add target parameter (URL encoded).
-	query.Set("target", params.buildTargetString())
-
-	// Add module parameter if specified.
-	if len(params.Module) > 0 {
-		query.Set("module", strings.Join(params.Module, ","))
-	}
-
-	// Add auth parameter if specified.
-	if params.Auth != "" {
-		query.Set("auth", params.Auth)
-	}
-
-	// Add context parameter if specified.
-	if params.Context != "" {
-		query.Set("snmp_context", params.Context)
-	}
-
-	// Add version parameter if specified.
-	if params.Version != "" {
-		query.Set("version", params.Version)
-	}
-
-	// Add timeout parameter if specified.
-	if params.Timeout != "" {
-		query.Set("timeout", params.Timeout)
-	}
-
-	// Add retries parameter if specified.
-	if params.Retries > 0 {
-		query.Set("retries", fmt.Sprintf("%d", params.Retries))
+// GetMetrics queries the exporter's probe endpoint for metrics, negotiating the
+// exposition format. Failed requests and error statuses are returned as *Error.
+func (c *Client) GetMetrics(ctx context.Context, params *QueryParams) (*Response, error) {
+	query, err := c.probe.query(params)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse base URL.
@@ -124,7 +139,8 @@ func (c *Client) GetMetrics(ctx context.Context, params *QueryParams) ([]byte, e
 		return nil, fmt.Errorf("invalid base URL: %w", err)
 	}
 
-	// Add query parameters to URL.
+	// Add probe path and query parameters to URL.
+	baseURL.Path = strings.TrimRight(baseURL.Path, "/") + c.probe.path
 	baseURL.RawQuery = query.Encode()
 
 	// Create request.
@@ -133,11 +149,18 @@ func (c *Client) GetMetrics(ctx context.Context, params *QueryParams) ([]byte, e
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	req.Header.Set("Accept", AcceptHeader)
+
+	// Probe exporters such as blackbox_exporter size their own timeouts from this header.
+	if c.timeout > 0 {
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(c.timeout.Seconds(), 'f', -1, 64))
+	}
+
 	var closeErr error
 	// Send request.
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, requestError(err)
 	}
 
 	defer func() {
@@ -149,17 +172,17 @@ func (c *Client) GetMetrics(ctx context.Context, params *QueryParams) ([]byte, e
 	// Read response body.
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, requestError(fmt.Errorf("failed to read response: %w", err))
 	}
 
 	// Check response status.
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, body)
+		return nil, statusError(resp.StatusCode, body)
 	}
 
 	if closeErr != nil {
 		return nil, closeErr
 	}
 
-	return body, nil
+	return &Response{Body: body, ContentType: resp.Header.Get("Content-Type")}, nil
 }
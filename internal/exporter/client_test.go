@@ -2,6 +2,7 @@ package exporter
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -116,7 +117,12 @@ func TestClient_GetMetrics(t *testing.T) {
 			t.Errorf("Expected auth public_v2, got %s", auth)
 		}
 
+		if accept := r.Header.Get("Accept"); accept != AcceptHeader {
+			t.Errorf("Expected Accept %s, got %s", AcceptHeader, accept)
+		}
+
 		// Send response
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("test metrics"))
 	}))
@@ -145,7 +151,152 @@ func TestClient_GetMetrics(t *testing.T) {
 		t.Fatalf("GetMetrics() error = %v", err)
 	}
 
-	if string(metrics) != "test metrics" {
-		t.Errorf("GetMetrics() = %v, want %v", string(metrics), "test metrics")
+	if string(metrics.Body) != "test metrics" {
+		t.Errorf("GetMetrics() = %v, want %v", string(metrics.Body), "test metrics")
+	}
+
+	if metrics.ContentType != "application/openmetrics-text; version=1.0.0; charset=utf-8" {
+		t.Errorf("GetMetrics() content type = %v", metrics.ContentType)
+	}
+}
+
+func TestClient_GetMetricsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		kind      ErrorKind
+		retryable bool
+	}{
+		{name: "unknown module", status: http.StatusBadRequest, body: "Unknown module 'if_mibb'", kind: ErrorUnknownModule},
+		{name: "unknown auth", status: http.StatusBadRequest, body: "Unknown auth 'private'", kind: ErrorAuth},
+		{name: "forbidden", status: http.StatusForbidden, body: "forbidden", kind: ErrorAuth},
+		{name: "other 4xx", status: http.StatusBadRequest, body: "'target' parameter must be specified", kind: ErrorRequest},
+		{
+			name:      "device timeout",
+			status:    http.StatusInternalServerError,
+			body:      "error walking target 192.0.0.8: request timeout (after 3 retries)",
+			kind:      ErrorUnreachable,
+			retryable: true,
+		},
+		{name: "server error", status: http.StatusServiceUnavailable, body: "overloaded", kind: ErrorServer, retryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, err := NewClient(Config{BaseURL: server.URL, Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			_, err = client.GetMetrics(context.Background(), &QueryParams{Target: "192.0.0.8"})
+
+			var exporterErr *Error
+			if !errors.As(err, &exporterErr) {
+				t.Fatalf("GetMetrics() error = %v, want *Error", err)
+			}
+
+			if exporterErr.Kind != tt.kind || exporterErr.StatusCode != tt.status {
+				t.Errorf("GetMetrics() error = %s/%d, want %s/%d", exporterErr.Kind, exporterErr.StatusCode, tt.kind, tt.status)
+			}
+
+			if got := exporterErr.Retryable(); got != tt.retryable {
+				t.Errorf("Retryable() = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+
+	t.Run("unreachable exporter", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		client, err := NewClient(Config{BaseURL: server.URL, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		_, err = client.GetMetrics(context.Background(), &QueryParams{Target: "192.0.0.8"})
+
+		var exporterErr *Error
+		if !errors.As(err, &exporterErr) || exporterErr.Kind != ErrorUnreachable || exporterErr.StatusCode != 0 {
+			t.Errorf("GetMetrics() error = %v, want an unreachable error without a status", err)
+		}
+	})
+}
+
+func TestClient_GetMetricsProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/exporters/probe" {
+			t.Errorf("Expected path /exporters/probe, got %s", r.URL.Path)
+		}
+
+		query := r.URL.Query()
+		if target := query.Get("target"); target != "https://web01.hedgehog.internal/health" {
+			t.Errorf("Expected the device target parameter to override the template, got %s", target)
+		}
+
+		if module := query.Get("module"); module != "http_2xx" {
+			t.Errorf("Expected module http_2xx, got %s", module)
+		}
+
+		if query.Has("auth") {
+			t.Errorf("Expected no auth parameter for the blackbox probe")
+		}
+
+		if timeout := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); timeout != "2.5" {
+			t.Errorf("Expected scrape timeout header 2.5, got %s", timeout)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	probe := DefaultProbes()[ProbeBlackbox]
+
+	client, err := NewClient(Config{
+		BaseURL: server.URL + "/exporters/",
+		Timeout: 2500 * time.Millisecond,
+		Probe:   &probe,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	params := QueryParams{
+		Target: "web01.hedgehog.internal",
+		Module: []string{"http_2xx"},
+		Auth:   "public_v2",
+		Params: map[string]string{"target": "https://web01.hedgehog.internal/health"},
+	}
+
+	if _, err := client.GetMetrics(context.Background(), &params); err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+}
+
+func TestProbe_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		probe   Probe
+		wantErr bool
+	}{
+		{name: "built-in", probe: DefaultProbes()[ProbeIPMI]},
+		{name: "relative path", probe: Probe{Path: "probe"}, wantErr: true},
+		{name: "bad template", probe: Probe{Path: "/probe", Params: map[string]string{"target": "{{.Host"}}, wantErr: true},
+		{name: "unknown field", probe: Probe{Path: "/probe", Params: map[string]string{"target": "{{.Hostname}}"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.probe.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
 	}
 }
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind classifies a failed exporter request.
+type ErrorKind string
+
+// Exporter error kinds.
+const (
+	// ErrorUnreachable means the exporter could not be connected to, or that
+	// it could not reach the device.
+	ErrorUnreachable ErrorKind = "target_unreachable"
+	// ErrorTimeout means the exporter did not answer in time.
+	ErrorTimeout ErrorKind = "timeout"
+	// ErrorAuth means the exporter refused the request or does not know the
+	// device's auth.
+	ErrorAuth ErrorKind = "auth_failure"
+	// ErrorUnknownModule means the exporter does not know a requested module.
+	ErrorUnknownModule ErrorKind = "unknown_module"
+	// ErrorServer means the exporter failed with a 5xx status.
+	ErrorServer ErrorKind = "exporter_5xx"
+	// ErrorRequest means the exporter rejected the request for another reason.
+	ErrorRequest ErrorKind = "bad_request"
+)
+
+// Error is returned by GetMetrics when the exporter could not be queried or
+// answered with a status other than 200 OK.
+type Error struct {
+	Kind ErrorKind
+	// StatusCode is the status the exporter answered with; 0 if it did not answer.
+	StatusCode int
+	// Body is the exporter's explanation of an error status.
+	Body string
+	// Err is the cause of a request that got no answer.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+	}
+
+	return fmt.Sprintf("%s: unexpected status code: %d, body: %s", e.Kind, e.StatusCode, e.Body)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request may succeed if repeated: the
+// exporter or device may come back, while a bad module or credentials will
+// be rejected again.
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrorUnreachable, ErrorTimeout, ErrorServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestError classifies a request that got no answer.
+func requestError(err error) *Error {
+	var netErr net.Error
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return &Error{Kind: ErrorTimeout, Err: err}
+	}
+
+	return &Error{Kind: ErrorUnreachable, Err: err}
+}
+
+// statusError classifies an error status from its code and, as exporters
+// answer most failures with 400 or 500, the explanation in the body.
+func statusError(code int, body []byte) *Error {
+	e := &Error{StatusCode: code, Body: string(bytes.TrimSpace(body))}
+	text := strings.ToLower(e.Body)
+
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden || strings.Contains(text, "unknown auth"):
+		e.Kind = ErrorAuth
+	case strings.Contains(text, "unknown module"):
+		e.Kind = ErrorUnknownModule
+	case code >= 500 && (strings.Contains(text, "timeout") || strings.Contains(text, "no route to host") ||
+		strings.Contains(text, "connection refused")):
+		e.Kind = ErrorUnreachable
+	case code >= 500:
+		e.Kind = ErrorServer
+	default:
+		e.Kind = ErrorRequest
+	}
+
+	return e
+}
@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Built-in probe types.
+const (
+	ProbeSNMP     = "snmp"
+	ProbeBlackbox = "blackbox"
+	ProbeIPMI     = "ipmi"
+	ProbeJSON     = "json"
+)
+
+// Probe describes how to query a multi-target exporter: the path of its probe
+// endpoint and a text/template for each query parameter. Templates are executed
+// with a TemplateData value; parameters that expand to an empty string are omitted.
+type Probe struct {
+	Path   string
+	Params map[string]string
+}
+
+// TemplateData is the data available to probe parameter templates.
+type TemplateData struct {
+	// Target is the host with the optional transport and port, e.g. "udp://sw1:161".
+	Target string
+	// Host is the bare device host.
+	Host string
+	// Port is the device port, or empty when unset.
+	Port string
+	// Module is the comma-separated list of modules.
+	Module  string
+	Auth    string
+	Context string
+	Version string
+	Timeout string
+	Retries string
+	// Params holds the device's own parameters.
+	Params map[string]string
+}
+
+// DefaultProbes returns the built-in probe types.
+func DefaultProbes() map[string]Probe {
+	return map[string]Probe{
+		ProbeSNMP: {
+			Path: "/snmp",
+			Params: map[string]string{
+				"target":       "{{.Target}}",
+				"module":       "{{.Module}}",
+				"auth":         "{{.Auth}}",
+				"snmp_context": "{{.Context}}",
+				"version":      "{{.Version}}",
+				"timeout":      "{{.Timeout}}",
+				"retries":      "{{.Retries}}",
+			},
+		},
+		ProbeBlackbox: {
+			Path: "/probe",
+			Params: map[string]string{
+				"target": "{{.Host}}",
+				"module": "{{.Module}}",
+			},
+		},
+		ProbeIPMI: {
+			Path: "/ipmi",
+			Params: map[string]string{
+				"target": "{{.Host}}",
+				"module": "{{.Module}}",
+			},
+		},
+		ProbeJSON: {
+			Path: "/probe",
+			Params: map[string]string{
+				"target": "{{.Host}}",
+				"module": "{{.Module}}",
+			},
+		},
+	}
+}
+
+// Validate checks that the probe has a path and that its templates parse.
+func (p Probe) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+// compiledProbe is a probe with parsed parameter templates.
+type compiledProbe struct {
+	path   string
+	names  []string
+	params map[string]*template.Template
+}
+
+func (p Probe) compile() (*compiledProbe, error) {
+	if !strings.HasPrefix(p.Path, "/") {
+		return nil, fmt.Errorf("probe path must start with /: %q", p.Path)
+	}
+
+	c := &compiledProbe{
+		path:   p.Path,
+		names:  make([]string, 0, len(p.Params)),
+		params: make(map[string]*template.Template, len(p.Params)),
+	}
+
+	for name, text := range p.Params {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template for parameter %s: %w", name, err)
+		}
+
+		// Catch references to unknown fields before the first scrape does.
+		if err := tmpl.Execute(io.Discard, TemplateData{}); err != nil {
+			return nil, fmt.Errorf("invalid template for parameter %s: %w", name, err)
+		}
+
+		c.names = append(c.names, name)
+		c.params[name] = tmpl
+	}
+
+	sort.Strings(c.names)
+
+	return c, nil
+}
+
+// query expands the parameter templates for a request. The device's own
+// parameters are added last and override templated values.
+func (c *compiledProbe) query(params *QueryParams) (url.Values, error) {
+	data := params.templateData()
+	query := url.Values{}
+
+	var b strings.Builder
+
+	for _, name := range c.names {
+		b.Reset()
+
+		if err := c.params[name].Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("expanding parameter %s: %w", name, err)
+		}
+
+		if b.Len() > 0 {
+			query.Set(name, b.String())
+		}
+	}
+
+	for name, value := range params.Params {
+		query.Set(name, value)
+	}
+
+	return query, nil
+}
+
+// templateData builds the template data for the query parameters.
+func (p *QueryParams) templateData() TemplateData {
+	data := TemplateData{
+		Target:  p.buildTargetString(),
+		Host:    p.Target,
+		Module:  strings.Join(p.Module, ","),
+		Auth:    p.Auth,
+		Context: p.Context,
+		Version: p.Version,
+		Timeout: p.Timeout,
+		Params:  p.Params,
+	}
+
+	if p.Port > 0 {
+		data.Port = strconv.Itoa(p.Port)
+	}
+
+	if p.Retries > 0 {
+		data.Retries = strconv.Itoa(p.Retries)
+	}
+
+	return data
+}
@@ -0,0 +1,301 @@
+// Package filter selects metric samples using include and exclude patterns.
+//
+// A pattern is a metric name matcher optionally followed by label matchers:
+//
+//	ifInOctets                     exact name
+//	if*Octets                      glob (*, ? and [...] as in path.Match)
+//	/ifHC(In|Out)Octets/           regular expression, implicitly anchored
+//	ifInOctets{ifDescr=~"Gi.*"}    name plus label matchers
+//	{ifType="6"}                   label matchers only, any name
+//
+// Label matchers use the PromQL operators =, !=, =~ and !~; regular
+// expression values are anchored as in PromQL.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter decides which samples are kept.
+type Filter struct {
+	include []*pattern
+	exclude []*pattern
+}
+
+// pattern matches a metric name and a set of labels.
+type pattern struct {
+	name     func(string) bool
+	matchers []*labelMatcher
+}
+
+// labelMatcher matches a single label value.
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Compile builds a filter from include and exclude patterns. An empty include
+// list keeps every sample not excluded.
+func Compile(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+
+	for _, p := range include {
+		compiled, err := parsePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("include pattern %q: %w", p, err)
+		}
+
+		f.include = append(f.include, compiled)
+	}
+
+	for _, p := range exclude {
+		compiled, err := parsePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", p, err)
+		}
+
+		f.exclude = append(f.exclude, compiled)
+	}
+
+	return f, nil
+}
+
+// MatchName reports whether any sample of the named metric could be kept.
+// It allows whole metric families to be skipped before their samples are read.
+func (f *Filter) MatchName(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, p := range f.exclude {
+		if len(p.matchers) == 0 && p.name(name) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, p := range f.include {
+		if p.name(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether a sample with the given name and labels is kept.
+func (f *Filter) Match(name string, labels map[string]string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, p := range f.exclude {
+		if p.match(name, labels) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, p := range f.include {
+		if p.match(name, labels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *pattern) match(name string, labels map[string]string) bool {
+	if !p.name(name) {
+		return false
+	}
+
+	for _, m := range p.matchers {
+		if !m.match(labels[m.name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *labelMatcher) match(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default: // "!~"
+		return !m.re.MatchString(value)
+	}
+}
+
+// parsePattern parses a name matcher with optional label matchers.
+func parsePattern(s string) (*pattern, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	namePart, rest, err := splitName(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pattern{}
+
+	p.name, err = nameMatcher(namePart)
+	if err != nil {
+		return nil, err
+	}
+
+	if rest == "" {
+		return p, nil
+	}
+
+	if !strings.HasPrefix(rest, "{") || !strings.HasSuffix(rest, "}") {
+		return nil, fmt.Errorf("unexpected %q after metric name", rest)
+	}
+
+	p.matchers, err = parseMatchers(rest[1 : len(rest)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// splitName separates the metric name matcher from any label matchers.
+func splitName(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "/") {
+		if i := strings.IndexByte(s, '{'); i >= 0 {
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i:]), nil
+		}
+
+		return s, "", nil
+	}
+
+	// Find the closing delimiter of a regular expression, allowing \/ escapes.
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			return s[:i+1], strings.TrimSpace(s[i+1:]), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated regular expression")
+}
+
+// nameMatcher returns a matcher for an exact name, glob or /regex/.
+func nameMatcher(s string) (func(string) bool, error) {
+	switch {
+	case s == "":
+		return func(string) bool { return true }, nil
+	case strings.HasPrefix(s, "/"):
+		expr := strings.ReplaceAll(s[1:len(s)-1], `\/`, "/")
+
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		return re.MatchString, nil
+	case strings.ContainsAny(s, "*?["):
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob: %w", err)
+		}
+
+		return func(name string) bool {
+			ok, _ := path.Match(s, name)
+			return ok
+		}, nil
+	default:
+		return func(name string) bool { return name == s }, nil
+	}
+}
+
+// labelNameRegex matches a valid Prometheus label name at the start of a string.
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// parseMatchers parses a comma separated list of label matchers.
+func parseMatchers(s string) ([]*labelMatcher, error) {
+	var matchers []*labelMatcher
+
+	s = strings.TrimSpace(s)
+	for s != "" {
+		name := labelNameRegex.FindString(s)
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at %q", s)
+		}
+
+		s = strings.TrimSpace(s[len(name):])
+
+		var op string
+
+		for _, candidate := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, candidate) {
+				op = candidate
+				break
+			}
+		}
+
+		if op == "" {
+			return nil, fmt.Errorf("expected label operator at %q", s)
+		}
+
+		s = strings.TrimSpace(s[len(op):])
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected quoted label value at %q", s)
+		}
+
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value %s: %w", quoted, err)
+		}
+
+		m := &labelMatcher{name: name, op: op, value: value}
+		if op == "=~" || op == "!~" {
+			m.re, err = regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression for label %s: %w", name, err)
+			}
+		}
+
+		matchers = append(matchers, m)
+
+		s = strings.TrimSpace(s[len(quoted):])
+		if s == "" {
+			break
+		}
+
+		if s[0] != ',' {
+			return nil, fmt.Errorf("expected ',' at %q", s)
+		}
+
+		s = strings.TrimSpace(s[1:])
+	}
+
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("empty label matcher list")
+	}
+
+	return matchers, nil
+}
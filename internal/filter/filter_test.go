@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestFilter_Match(t *testing.T) {
+	gi1 := map[string]string{"ifDescr": "Gi0/1", "ifType": "6"}
+	vlan := map[string]string{"ifDescr": "Vlan10", "ifType": "53"}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		metric  string
+		labels  map[string]string
+		want    bool
+	}{
+		{name: "no patterns keeps everything", metric: "ifInOctets", want: true},
+		{name: "exact include", include: []string{"ifInOctets"}, metric: "ifInOctets", want: true},
+		{name: "exact include miss", include: []string{"ifInOctets"}, metric: "ifOutOctets", want: false},
+		{name: "glob include", include: []string{"if*Octets"}, metric: "ifHCInOctets", want: true},
+		{name: "glob include miss", include: []string{"if*Octets"}, metric: "ifInErrors", want: false},
+		{name: "regex include", include: []string{"/ifHC(In|Out)Octets/"}, metric: "ifHCOutOctets", want: true},
+		{name: "regex is anchored", include: []string{"/ifHC(In|Out)/"}, metric: "ifHCOutOctets", want: false},
+		{name: "exclude wins over include", include: []string{"if*"}, exclude: []string{"ifInErrors"}, metric: "ifInErrors", want: false},
+		{name: "exclude without include", exclude: []string{"snmp_*"}, metric: "snmp_scrape_duration_seconds", want: false},
+		{
+			name:    "label regex match",
+			include: []string{`ifInOctets{ifDescr=~"Gi.*"}`},
+			metric:  "ifInOctets",
+			labels:  gi1,
+			want:    true,
+		},
+		{
+			name:    "label regex miss",
+			include: []string{`ifInOctets{ifDescr=~"Gi.*"}`},
+			metric:  "ifInOctets",
+			labels:  vlan,
+			want:    false,
+		},
+		{
+			name:    "label matchers without name",
+			include: []string{`{ifType="6", ifDescr!~"Vlan.*"}`},
+			metric:  "ifOutOctets",
+			labels:  gi1,
+			want:    true,
+		},
+		{
+			name:    "label exclude",
+			include: []string{"if*Octets"},
+			exclude: []string{`{ifDescr=~"Vlan.*"}`},
+			metric:  "ifInOctets",
+			labels:  vlan,
+			want:    false,
+		},
+		{
+			name:    "missing label matches empty value",
+			include: []string{`sysUpTime{ifDescr!="Gi0/1"}`},
+			metric:  "sysUpTime",
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Compile(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			if got := f.Match(tt.metric, tt.labels); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.metric, tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_MatchName(t *testing.T) {
+	f, err := Compile([]string{`ifInOctets{ifDescr=~"Gi.*"}`, "sys*"}, []string{"sysDescr", `{ifType="53"}`})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	for name, want := range map[string]bool{
+		"ifInOctets":  true,
+		"sysUpTime":   true,
+		"sysDescr":    false,
+		"ifOutOctets": false,
+	} {
+		if got := f.MatchName(name); got != want {
+			t.Errorf("MatchName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	for _, p := range []string{
+		"",
+		"/ifIn(/",
+		"/unterminated",
+		"if[Octets",
+		`ifInOctets{ifDescr=~"Gi.*"`,
+		`ifInOctets{ifDescr~"Gi.*"}`,
+		`ifInOctets{ifDescr="Gi0/1" ifType="6"}`,
+		`ifInOctets{ifDescr=Gi}`,
+		`ifInOctets{}`,
+		`ifInOctets{ifDescr=~"("}`,
+	} {
+		if _, err := Compile([]string{p}, nil); err == nil {
+			t.Errorf("Compile(%q) expected error", p)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package health tracks the getter's liveness and readiness.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default thresholds used when none are configured.
+const (
+	DefaultUnavailableThreshold = 2 * time.Minute
+	DefaultStallThreshold       = time.Minute
+)
+
+// maxStalledListed caps the devices named in a failed liveness check.
+const maxStalledListed = 5
+
+// Check states reported in responses.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Config represents the health checker configuration.
+type Config struct {
+	// UnavailableThreshold is how long Elasticsearch or every exporter may be
+	// unreachable before the getter reports itself not ready.
+	UnavailableThreshold time.Duration
+	// StallThreshold is how long a device's collection loop may be overdue
+	// before the getter reports itself not live.
+	StallThreshold time.Duration
+}
+
+// StalledFunc returns the devices whose collection loops have been overdue
+// for longer than grace.
+type StalledFunc func(grace time.Duration) []string
+
+// Checker records dependency reachability and watches collection progress.
+type Checker struct {
+	cfg          Config
+	mu           sync.RWMutex
+	configLoaded bool
+	stalled      StalledFunc
+	es           dependency
+	exporters    map[string]*dependency
+	now          func() time.Time
+}
+
+// dependency tracks the reachability of a remote service.
+type dependency struct {
+	lastError    string
+	failingSince time.Time
+}
+
+// Response is the JSON body returned by the health handlers.
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// New creates a new health checker.
+func New(cfg Config) *Checker {
+	if cfg.UnavailableThreshold <= 0 {
+		cfg.UnavailableThreshold = DefaultUnavailableThreshold
+	}
+
+	if cfg.StallThreshold <= 0 {
+		cfg.StallThreshold = DefaultStallThreshold
+	}
+
+	return &Checker{
+		cfg:       cfg,
+		exporters: make(map[string]*dependency),
+		now:       time.Now,
+	}
+}
+
+// ConfigLoaded records that device configurations were loaded successfully.
+func (c *Checker) ConfigLoaded() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.configLoaded = true
+}
+
+// WatchProgress makes liveness depend on device collections: the getter is
+// not live while stalled reports a device overdue by the stall threshold.
+func (c *Checker) WatchProgress(stalled StalledFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stalled = stalled
+}
+
+// ReportElasticsearch records the outcome of an Elasticsearch request.
+func (c *Checker) ReportElasticsearch(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.es.report(err, c.now())
+}
+
+// ReportExporter records the outcome of a request to an exporter.
+func (c *Checker) ReportExporter(baseURL string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dep, ok := c.exporters[baseURL]
+	if !ok {
+		dep = &dependency{}
+		c.exporters[baseURL] = dep
+	}
+
+	dep.report(err, c.now())
+}
+
+// RetainExporters forgets the exporters not in the given set of base URLs,
+// so that an exporter no longer configured does not hold readiness down.
+func (c *Checker) RetainExporters(baseURLs map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for url := range c.exporters {
+		if !baseURLs[url] {
+			delete(c.exporters, url)
+		}
+	}
+}
+
+// report updates the dependency state; failingSince is kept from the first failure.
+func (d *dependency) report(err error, now time.Time) {
+	if err == nil {
+		d.lastError = ""
+		d.failingSince = time.Time{}
+
+		return
+	}
+
+	d.lastError = err.Error()
+	if d.failingSince.IsZero() {
+		d.failingSince = now
+	}
+}
+
+// unavailable reports whether the dependency has been failing longer than threshold.
+func (d *dependency) unavailable(now time.Time, threshold time.Duration) bool {
+	return !d.failingSince.IsZero() && now.Sub(d.failingSince) > threshold
+}
+
+// status describes the dependency for a response.
+func (d *dependency) status() string {
+	if d.failingSince.IsZero() {
+		return StatusOK
+	}
+
+	return StatusFail + ": " + d.lastError
+}
+
+// Liveness reports whether devices are still being collected.
+func (c *Checker) Liveness() Response {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	resp := Response{Status: StatusOK, Checks: map[string]string{"collections": StatusOK}}
+
+	if c.stalled == nil {
+		return resp
+	}
+
+	if stalled := c.stalled(c.cfg.StallThreshold); len(stalled) > 0 {
+		listed := stalled
+		if len(listed) > maxStalledListed {
+			listed = append(listed[:maxStalledListed:maxStalledListed], "...")
+		}
+
+		resp.Status = StatusFail
+		resp.Checks["collections"] = fmt.Sprintf("%s: %d devices stalled: %s",
+			StatusFail, len(stalled), strings.Join(listed, ", "))
+	}
+
+	return resp
+}
+
+// Readiness reports whether the getter is able to collect and store metrics.
+func (c *Checker) Readiness() Response {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	resp := Response{Status: StatusOK, Checks: make(map[string]string)}
+
+	resp.Checks["config"] = StatusOK
+	if !c.configLoaded {
+		resp.Status = StatusFail
+		resp.Checks["config"] = StatusFail + ": configurations not loaded"
+	}
+
+	resp.Checks["elasticsearch"] = c.es.status()
+	if c.es.unavailable(now, c.cfg.UnavailableThreshold) {
+		resp.Status = StatusFail
+	}
+
+	// A single broken exporter only affects its own devices, so readiness
+	// fails only once every known exporter is unavailable.
+	urls := make([]string, 0, len(c.exporters))
+	for url := range c.exporters {
+		urls = append(urls, url)
+	}
+
+	sort.Strings(urls)
+
+	allUnavailable := len(urls) > 0
+	for _, url := range urls {
+		dep := c.exporters[url]
+		resp.Checks["exporter:"+url] = dep.status()
+
+		if !dep.unavailable(now, c.cfg.UnavailableThreshold) {
+			allUnavailable = false
+		}
+	}
+
+	if allUnavailable {
+		resp.Status = StatusFail
+	}
+
+	return resp
+}
+
+// LivenessHandler serves the liveness check.
+func (c *Checker) LivenessHandler() http.Handler {
+	return handler(c.Liveness)
+}
+
+// ReadinessHandler serves the readiness check.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return handler(c.Readiness)
+}
+
+// handler writes a check response as JSON, using 503 for failures.
+func handler(check func() Response) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		resp := check()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if resp.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
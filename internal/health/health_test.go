@@ -0,0 +1,104 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	now := time.Now()
+	c := New(Config{UnavailableThreshold: time.Minute})
+	c.now = func() time.Time { return now }
+
+	if got := c.Readiness().Status; got != StatusFail {
+		t.Errorf("expected not ready before configurations load, got %s", got)
+	}
+
+	c.ConfigLoaded()
+	c.ReportElasticsearch(nil)
+
+	if got := c.Readiness().Status; got != StatusOK {
+		t.Errorf("expected ready after configurations load, got %s", got)
+	}
+
+	// A brief Elasticsearch outage stays within the threshold.
+	c.ReportElasticsearch(errors.New("connection refused"))
+
+	now = now.Add(30 * time.Second)
+	if got := c.Readiness().Status; got != StatusOK {
+		t.Errorf("expected ready within unavailable threshold, got %s", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := c.Readiness().Status; got != StatusFail {
+		t.Errorf("expected not ready after unavailable threshold, got %s", got)
+	}
+
+	c.ReportElasticsearch(nil)
+
+	if got := c.Readiness().Status; got != StatusOK {
+		t.Errorf("expected ready after Elasticsearch recovers, got %s", got)
+	}
+}
+
+func TestChecker_ReadinessExporters(t *testing.T) {
+	now := time.Now()
+	c := New(Config{UnavailableThreshold: time.Minute})
+	c.now = func() time.Time { return now }
+	c.ConfigLoaded()
+
+	c.ReportExporter("http://a:9116", errors.New("timeout"))
+	c.ReportExporter("http://b:9116", nil)
+
+	now = now.Add(2 * time.Minute)
+	if got := c.Readiness().Status; got != StatusOK {
+		t.Errorf("expected ready while one exporter is reachable, got %s", got)
+	}
+
+	c.ReportExporter("http://b:9116", errors.New("timeout"))
+
+	now = now.Add(2 * time.Minute)
+	if got := c.Readiness().Status; got != StatusFail {
+		t.Errorf("expected not ready when all exporters are unavailable, got %s", got)
+	}
+
+	c.ReportExporter("http://c:9116", nil)
+	c.RetainExporters(map[string]bool{"http://c:9116": true})
+
+	resp := c.Readiness()
+	if resp.Status != StatusOK || len(resp.Checks) != 3 {
+		t.Errorf("expected exporters no longer configured to be forgotten, got %v", resp)
+	}
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	var stalled []string
+
+	c := New(Config{StallThreshold: time.Minute})
+	c.WatchProgress(func(grace time.Duration) []string {
+		if grace != time.Minute {
+			t.Errorf("expected the stall threshold as grace, got %v", grace)
+		}
+
+		return stalled
+	})
+
+	rec := httptest.NewRecorder()
+	c.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+
+	stalled = []string{"switch01"}
+
+	rec = httptest.NewRecorder()
+	c.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 for a stalled device, got %d", rec.Code)
+	}
+}
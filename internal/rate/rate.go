@@ -0,0 +1,203 @@
+// Package rate derives per-second rates from cumulative counter samples.
+//
+// SNMP counters are fixed-width and wrap: Counter32 values roll over at 2^32
+// and Counter64 values at 2^64. A counter that goes down is either such a wrap
+// or a reset caused by the device restarting. The width is taken from the
+// sample; a counter of unknown width that goes down is taken to be reset.
+// Restarts are recognised by a drop in sysUpTime, which itself wraps after
+// about 497 days; the first sample after a reset carries no rate because the
+// amount counted since the restart is unknown.
+package rate
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// UptimeMetric is the metric used to detect device restarts.
+const UptimeMetric = "sysUpTime"
+
+const (
+	counter32Range = 1 << 32
+	counter64Range = 1 << 64
+)
+
+// sysUpTime is a TimeTicks value, in hundredths of a second, that wraps at
+// 2^32. A drop in uptime is a wrap rather than a restart when the uptime
+// advanced by the time elapsed, give or take uptimeTolerance of it plus
+// uptimeSlack ticks for the time taken to poll.
+const (
+	ticksPerSecond  = 100
+	uptimeRange     = 1 << 32
+	uptimeTolerance = 0.1
+	uptimeSlack     = 60 * ticksPerSecond
+)
+
+// Calculator keeps the previous value of every counter series and annotates
+// counter samples with their rate. It is safe for concurrent use.
+type Calculator struct {
+	mu      sync.Mutex
+	devices map[string]*deviceState
+}
+
+// deviceState holds the last scrape of one device.
+type deviceState struct {
+	timestamp time.Time
+	uptime    float64
+	hasUptime bool
+	counters  map[string]float64
+}
+
+// New creates a new rate calculator.
+func New() *Calculator {
+	return &Calculator{devices: make(map[string]*deviceState)}
+}
+
+// Apply sets the Rate of every counter sample in the scrape, using the
+// previous scrape of the same device as the baseline.
+func (c *Calculator) Apply(deviceID string, scrape *schema.Scrape) {
+	current := &deviceState{
+		timestamp: scrape.Timestamp,
+		counters:  make(map[string]float64),
+	}
+
+	for i := range scrape.Samples {
+		if scrape.Samples[i].Name == UptimeMetric {
+			current.uptime = scrape.Samples[i].Value
+			current.hasUptime = true
+
+			break
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := c.devices[deviceID]
+	c.devices[deviceID] = current
+
+	var elapsed float64
+	if previous != nil {
+		elapsed = current.timestamp.Sub(previous.timestamp).Seconds()
+	}
+
+	restarted := previous != nil && previous.hasUptime && current.hasUptime && restart(previous.uptime, current.uptime, elapsed)
+
+	for i := range scrape.Samples {
+		sample := &scrape.Samples[i]
+		if sample.Type != "counter" {
+			continue
+		}
+
+		key := seriesKey(sample)
+		current.counters[key] = sample.Value
+
+		if previous == nil || restarted || elapsed <= 0 {
+			continue
+		}
+
+		last, ok := previous.counters[key]
+		if !ok {
+			continue
+		}
+
+		delta, ok := increase(last, sample.Value, sample.CounterBits, previous.hasUptime && current.hasUptime)
+		if !ok {
+			continue
+		}
+
+		r := delta / elapsed
+		sample.Rate = &r
+	}
+}
+
+// Retain forgets the state of devices not in the given set of IDs.
+func (c *Calculator) Retain(deviceIDs map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.devices {
+		if !deviceIDs[id] {
+			delete(c.devices, id)
+		}
+	}
+}
+
+// restart reports whether a drop in uptime between two scrapes, elapsed
+// seconds apart, was caused by the device restarting rather than by the
+// uptime wrapping.
+func restart(last, uptime, elapsed float64) bool {
+	if uptime >= last {
+		return false
+	}
+
+	expected := elapsed * ticksPerSecond
+	advanced := uptime + uptimeRange - last
+
+	return math.Abs(advanced-expected) > expected*uptimeTolerance+uptimeSlack
+}
+
+// increase returns how much a counter of the given width grew between two
+// samples. A decrease is only treated as a wrap when the width is known,
+// uptime shows the device did not restart and the wrapped increase covers
+// less than half the counter range; anything else is a reset and yields no
+// increase.
+func increase(last, value float64, bits int, uptimeKnown bool) (float64, bool) {
+	if value >= last {
+		return value - last, true
+	}
+
+	if !uptimeKnown {
+		return 0, false
+	}
+
+	var counterRange float64
+
+	switch bits {
+	case 32:
+		counterRange = counter32Range
+	case 64:
+		counterRange = counter64Range
+	default:
+		return 0, false
+	}
+
+	delta := value + counterRange - last
+	if delta > counterRange/2 {
+		return 0, false
+	}
+
+	return delta, true
+}
+
+// seriesKey identifies a series by metric name and sorted labels.
+func seriesKey(sample *schema.Sample) string {
+	if len(sample.Labels) == 0 {
+		return sample.Name
+	}
+
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	b.WriteString(sample.Name)
+
+	for _, name := range names {
+		b.WriteByte(0)
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(sample.Labels[name])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+func scrapeAt(ts time.Time, uptime, octets float64) *schema.Scrape {
+	return counterScrapeAt(ts, uptime, octets, 32)
+}
+
+func counterScrapeAt(ts time.Time, uptime, octets float64, bits int) *schema.Scrape {
+	return &schema.Scrape{
+		Timestamp: ts,
+		Samples: []schema.Sample{
+			{Name: UptimeMetric, Type: "gauge", Value: uptime},
+			{Name: "ifInOctets", Type: "counter", Value: octets, Labels: map[string]string{"ifIndex": "1"}, CounterBits: bits},
+		},
+	}
+}
+
+func TestCalculator_Apply(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		previous *schema.Scrape
+		current  *schema.Scrape
+		want     *float64
+	}{
+		{
+			name:    "first sample",
+			current: scrapeAt(start, 100, 1000),
+		},
+		{
+			name:     "increase",
+			previous: scrapeAt(start, 100, 1000),
+			current:  scrapeAt(start.Add(10*time.Second), 1100, 3000),
+			want:     ptr(200),
+		},
+		{
+			name:     "counter32 wrap",
+			previous: scrapeAt(start, 100, counter32Range-1000),
+			current:  scrapeAt(start.Add(10*time.Second), 1100, 1000),
+			want:     ptr(200),
+		},
+		{
+			name:     "counter64 wrap",
+			previous: counterScrapeAt(start, 100, counter64Range-2048, 64),
+			current:  counterScrapeAt(start.Add(2*time.Second), 300, 0, 64),
+			want:     ptr(1024),
+		},
+		{
+			name:     "counter64 cleared below 2^32",
+			previous: counterScrapeAt(start, 100, 3000000000, 64),
+			current:  counterScrapeAt(start.Add(10*time.Second), 1100, 1000, 64),
+		},
+		{
+			name:     "unknown width",
+			previous: counterScrapeAt(start, 100, counter32Range-1000, 0),
+			current:  counterScrapeAt(start.Add(10*time.Second), 1100, 1000, 0),
+		},
+		{
+			name:     "uptime wrap",
+			previous: scrapeAt(start, uptimeRange-500, 1000),
+			current:  scrapeAt(start.Add(10*time.Second), 500, 3000),
+			want:     ptr(200),
+		},
+		{
+			name:     "device restart",
+			previous: scrapeAt(start, 500000, 1000000),
+			current:  scrapeAt(start.Add(10*time.Second), 800, 2000),
+		},
+		{
+			name:     "implausible wrap",
+			previous: scrapeAt(start, 100, 1000000),
+			current:  scrapeAt(start.Add(10*time.Second), 1100, 10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			if tt.previous != nil {
+				c.Apply("switch01", tt.previous)
+			}
+
+			c.Apply("switch01", tt.current)
+
+			got := tt.current.Samples[1].Rate
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("expected no rate, got %v", *got)
+			case tt.want != nil && got == nil:
+				t.Errorf("expected rate %v, got none", *tt.want)
+			case tt.want != nil && *got != *tt.want:
+				t.Errorf("rate = %v, want %v", *got, *tt.want)
+			}
+
+			if tt.current.Samples[0].Rate != nil {
+				t.Error("expected no rate on gauge samples")
+			}
+		})
+	}
+}
+
+func TestCalculator_ResetWithoutUptime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New()
+
+	first := scrapeAt(start, 0, counter32Range-1000)
+	first.Samples = first.Samples[1:]
+	c.Apply("switch01", first)
+
+	second := scrapeAt(start.Add(10*time.Second), 0, 1000)
+	second.Samples = second.Samples[1:]
+	c.Apply("switch01", second)
+
+	if second.Samples[0].Rate != nil {
+		t.Errorf("expected a decrease without uptime to be treated as a reset, got rate %v", *second.Samples[0].Rate)
+	}
+
+	third := scrapeAt(start.Add(20*time.Second), 0, 3000)
+	third.Samples = third.Samples[1:]
+	c.Apply("switch01", third)
+
+	if third.Samples[0].Rate == nil || *third.Samples[0].Rate != 200 {
+		t.Errorf("expected rate 200 after the reset, got %v", third.Samples[0].Rate)
+	}
+}
+
+func TestCalculator_Retain(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New()
+
+	c.Apply("switch01", scrapeAt(start, 100, 1000))
+	c.Retain(map[string]bool{"switch02": true})
+
+	current := scrapeAt(start.Add(10*time.Second), 1100, 3000)
+	c.Apply("switch01", current)
+
+	if current.Samples[1].Rate != nil {
+		t.Error("expected the baseline of a removed device to be forgotten")
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
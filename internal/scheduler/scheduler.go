@@ -0,0 +1,391 @@
+// Package scheduler runs periodic metric collection for each configured device.
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+// DefaultInterval is used when a device specifies no usable collection interval.
+const DefaultInterval = time.Minute
+
+// DefaultJitter is the fraction of the interval used to spread collections.
+const DefaultJitter = 0.1
+
+// CollectFunc performs a single collection for a device.
+type CollectFunc func(ctx context.Context, cfg *elasticsearch.Config)
+
+// Config represents the scheduler configuration.
+type Config struct {
+	// DefaultInterval is used for devices without a valid interval.
+	DefaultInterval time.Duration
+	// Jitter is the fraction of the interval (0-1) applied as random offset to each run.
+	Jitter float64
+}
+
+// Scheduler runs an independent timer per enabled device.
+type Scheduler struct {
+	collect CollectFunc
+	cfg     Config
+	logger  *slog.Logger
+	jobs    map[string]*job
+	// draining holds replaced jobs whose last collection is still running.
+	draining map[*job]struct{}
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// job is a single device's collection loop. Cancelling the job stops the
+// loop; aborting it also cancels a collection in progress.
+type job struct {
+	config   elasticsearch.Config
+	interval time.Duration
+	cancel   context.CancelFunc
+	abort    context.CancelFunc
+	running  atomic.Bool
+	// progress is when the loop last started or finished a collection, in
+	// Unix nanoseconds.
+	progress atomic.Int64
+	done     chan struct{}
+}
+
+// touch records that the loop is making progress.
+func (j *job) touch() {
+	j.progress.Store(time.Now().UnixNano())
+}
+
+// stop stops the loop and cancels any collection in progress.
+func (j *job) stop() {
+	j.cancel()
+	j.abort()
+}
+
+// New creates a new scheduler.
+func New(collect CollectFunc, cfg Config, logger *slog.Logger) *Scheduler {
+	if cfg.DefaultInterval <= 0 {
+		cfg.DefaultInterval = DefaultInterval
+	}
+
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		cfg.Jitter = DefaultJitter
+	}
+
+	return &Scheduler{
+		collect:  collect,
+		cfg:      cfg,
+		logger:   logger,
+		jobs:     make(map[string]*job),
+		draining: make(map[*job]struct{}),
+	}
+}
+
+// Interval returns the collection interval for a device configuration.
+// The collector collection_interval takes precedence over the SNMP
+// poll_interval_seconds; fallback is returned if neither is usable.
+func Interval(cfg *elasticsearch.Config, fallback time.Duration) time.Duration {
+	if cfg.CollectorSettings.CollectionInterval != "" {
+		d, err := time.ParseDuration(cfg.CollectorSettings.CollectionInterval)
+		if err == nil && d > 0 {
+			return d
+		}
+	}
+
+	if cfg.SNMPSettings.PollIntervalSeconds > 0 {
+		return time.Duration(cfg.SNMPSettings.PollIntervalSeconds) * time.Second
+	}
+
+	return fallback
+}
+
+// Update reconciles running jobs with the given configurations. New and
+// changed devices are (re)scheduled, removed and disabled devices are stopped,
+// and unchanged devices keep their existing schedule.
+func (s *Scheduler) Update(ctx context.Context, configs []elasticsearch.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]elasticsearch.Config, len(configs))
+	for i := range configs {
+		if configs[i].Enabled {
+			wanted[configs[i].ID] = configs[i]
+		}
+	}
+
+	// Jobs being replaced, so the new job can wait for any in-flight
+	// collection of the old one instead of polling the device twice.
+	previous := make(map[string]chan struct{})
+
+	for id, j := range s.jobs {
+		cfg, ok := wanted[id]
+		if ok && reflect.DeepEqual(cfg, j.config) {
+			continue
+		}
+
+		j.stop()
+		delete(s.jobs, id)
+
+		if ok {
+			previous[id] = j.done
+		} else {
+			s.logger.Info("unscheduled device", "id", id)
+		}
+	}
+
+	for id, cfg := range wanted {
+		if _, ok := s.jobs[id]; ok {
+			continue
+		}
+
+		s.schedule(ctx, cfg, previous[id])
+	}
+}
+
+// Apply reschedules the devices added or changed in a configuration sync and
+// stops those disabled or removed. Devices outside the diff keep their
+// existing schedule.
+func (s *Scheduler) Apply(ctx context.Context, diff cache.Diff) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, configs := range [][]elasticsearch.Config{diff.Added, diff.Changed} {
+		for _, cfg := range configs {
+			var previous chan struct{}
+
+			if j, ok := s.jobs[cfg.ID]; ok {
+				// Only the loop is cancelled, not the job's collection: a
+				// collection in progress finishes with the old configuration
+				// and the replacement waits on previous, so an edit neither
+				// discards a nearly complete scrape nor polls the device twice.
+				// Until it finishes the job is draining, so that Shutdown
+				// still waits for it and aborts it at the deadline.
+				j.cancel()
+				delete(s.jobs, cfg.ID)
+				s.draining[j] = struct{}{}
+
+				previous = j.done
+			}
+
+			s.schedule(ctx, cfg, previous)
+		}
+	}
+
+	for _, cfg := range diff.Disabled {
+		s.unschedule(cfg.ID)
+	}
+
+	for _, id := range diff.Removed {
+		s.unschedule(id)
+	}
+}
+
+// unschedule stops the job of a device, if any. The caller must hold s.mu.
+func (s *Scheduler) unschedule(id string) {
+	j, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+
+	j.stop()
+	delete(s.jobs, id)
+
+	s.logger.Info("unscheduled device", "id", id)
+}
+
+// schedule starts the collection loop for a device once the previous job, if
+// any, has finished. The caller must hold s.mu.
+func (s *Scheduler) schedule(ctx context.Context, cfg elasticsearch.Config, previous <-chan struct{}) {
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	// Collections outlive the loop so that Shutdown can let them finish.
+	collectCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+
+	j := &job{
+		config:   cfg,
+		interval: Interval(&cfg, s.cfg.DefaultInterval),
+		cancel:   cancel,
+		abort:    abort,
+		done:     make(chan struct{}),
+	}
+	j.touch()
+	s.jobs[cfg.ID] = j
+
+	s.logger.Info("scheduled device",
+		"id", cfg.ID,
+		"name", cfg.Name,
+		"interval", j.interval,
+	)
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		defer close(j.done)
+		defer abort()
+		defer s.drained(j)
+
+		if previous != nil {
+			<-previous
+			j.touch()
+		}
+
+		s.run(jobCtx, collectCtx, j)
+	}()
+}
+
+// drained forgets a job that is no longer running.
+func (s *Scheduler) drained(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.draining, j)
+}
+
+// run executes the collection loop until ctx is cancelled. Collections run
+// with collectCtx.
+func (s *Scheduler) run(ctx, collectCtx context.Context, j *job) {
+	// Spread the first collection across the whole interval so that devices
+	// loaded together do not all fire at once.
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(j.interval)))) //nolint:gosec // Jitter does not need a secure source.
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+
+		j.touch()
+		j.running.Store(true)
+		s.collect(collectCtx, &j.config)
+		j.running.Store(false)
+		j.touch()
+
+		elapsed := time.Since(start)
+
+		if elapsed > j.interval {
+			s.logger.Warn("collection overran interval",
+				"id", j.config.ID,
+				"interval", j.interval,
+				"elapsed", elapsed,
+			)
+		}
+
+		// Missed runs are skipped rather than queued, so a slow device never
+		// builds up a backlog of collections.
+		next := s.jittered(j.interval) - elapsed%j.interval
+		if next < 0 {
+			next = 0
+		}
+
+		timer.Reset(next)
+	}
+}
+
+// jittered returns the interval adjusted by a random offset within the
+// configured jitter fraction.
+func (s *Scheduler) jittered(interval time.Duration) time.Duration {
+	spread := int64(float64(interval) * s.cfg.Jitter)
+	if spread <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(2*spread)-spread) //nolint:gosec // Jitter does not need a secure source.
+}
+
+// Stalled returns, sorted, the IDs of the devices whose loop has made no
+// progress for longer than its interval, jitter included, plus grace. Such a
+// loop is stuck in a collection or no longer firing.
+func (s *Scheduler) Stalled(grace time.Duration) []string {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stalled []string
+
+	for id, j := range s.jobs {
+		limit := j.interval + time.Duration(float64(j.interval)*s.cfg.Jitter) + grace
+
+		if now.Sub(time.Unix(0, j.progress.Load())) > limit {
+			stalled = append(stalled, id)
+		}
+	}
+
+	sort.Strings(stalled)
+
+	return stalled
+}
+
+// Count returns the number of scheduled devices.
+func (s *Scheduler) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.jobs)
+}
+
+// Stop cancels all jobs and waits for running collections to return.
+func (s *Scheduler) Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.Shutdown(ctx)
+}
+
+// Shutdown stops scheduling collections and waits for those running to
+// finish, including those of replaced jobs. Collections still running when
+// ctx is done are cancelled; their number is returned.
+func (s *Scheduler) Shutdown(ctx context.Context) int {
+	s.mu.Lock()
+	jobs := make([]*job, 0, len(s.jobs)+len(s.draining))
+
+	for id, j := range s.jobs {
+		j.cancel()
+		jobs = append(jobs, j)
+		delete(s.jobs, id)
+	}
+
+	for j := range s.draining {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+	}
+
+	abandoned := 0
+
+	for _, j := range jobs {
+		if j.running.Load() {
+			abandoned++
+		}
+
+		j.abort()
+	}
+
+	<-done
+
+	return abandoned
+}
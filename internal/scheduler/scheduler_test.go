@@ -0,0 +1,293 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+func TestInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  elasticsearch.Config
+		want time.Duration
+	}{
+		{
+			name: "collection interval",
+			cfg: elasticsearch.Config{
+				SNMPSettings:      elasticsearch.SNMPSettings{PollIntervalSeconds: 30},
+				CollectorSettings: elasticsearch.CollectorSettings{CollectionInterval: "1m"},
+			},
+			want: time.Minute,
+		},
+		{
+			name: "poll interval seconds",
+			cfg: elasticsearch.Config{
+				SNMPSettings: elasticsearch.SNMPSettings{PollIntervalSeconds: 30},
+			},
+			want: 30 * time.Second,
+		},
+		{
+			name: "invalid collection interval falls back to poll interval",
+			cfg: elasticsearch.Config{
+				SNMPSettings:      elasticsearch.SNMPSettings{PollIntervalSeconds: 30},
+				CollectorSettings: elasticsearch.CollectorSettings{CollectionInterval: "soon"},
+			},
+			want: 30 * time.Second,
+		},
+		{
+			name: "default",
+			cfg:  elasticsearch.Config{},
+			want: 5 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Interval(&tt.cfg, 5*time.Minute); got != tt.want {
+				t.Errorf("Interval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// counter records collections per device.
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *counter) collect(_ context.Context, cfg *elasticsearch.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[cfg.ID]++
+}
+
+func (c *counter) get(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.calls[id]
+}
+
+func testConfig(id string, interval string, enabled bool) elasticsearch.Config {
+	return elasticsearch.Config{
+		ID:      id,
+		Enabled: enabled,
+		CollectorSettings: elasticsearch.CollectorSettings{
+			CollectionInterval: interval,
+		},
+	}
+}
+
+func TestScheduler_Update(t *testing.T) {
+	c := &counter{calls: make(map[string]int)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(c.collect, Config{Jitter: 0}, logger)
+
+	defer s.Stop()
+
+	ctx := context.Background()
+	s.Update(ctx, []elasticsearch.Config{
+		testConfig("fast", "20ms", true),
+		testConfig("disabled", "20ms", false),
+	})
+
+	if got := s.Count(); got != 1 {
+		t.Fatalf("Count() = %d, want 1", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if got := c.get("fast"); got < 3 {
+		t.Errorf("expected at least 3 collections for fast device, got %d", got)
+	}
+
+	if got := c.get("disabled"); got != 0 {
+		t.Errorf("expected no collections for disabled device, got %d", got)
+	}
+
+	// Removing the device must stop its collections.
+	s.Update(ctx, nil)
+
+	if got := s.Count(); got != 0 {
+		t.Fatalf("Count() = %d, want 0", got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	before := c.get("fast")
+	time.Sleep(100 * time.Millisecond)
+
+	if after := c.get("fast"); after != before {
+		t.Errorf("expected no collections after removal, got %d more", after-before)
+	}
+}
+
+func TestScheduler_Apply(t *testing.T) {
+	c := &counter{calls: make(map[string]int)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(c.collect, Config{Jitter: 0}, logger)
+
+	defer s.Stop()
+
+	ctx := context.Background()
+	s.Apply(ctx, cache.Diff{Added: []elasticsearch.Config{
+		testConfig("kept", "1h", true),
+		testConfig("changed", "1h", true),
+		testConfig("disabled", "1h", true),
+		testConfig("removed", "1h", true),
+	}})
+
+	s.mu.Lock()
+	kept := s.jobs["kept"]
+	s.mu.Unlock()
+
+	s.Apply(ctx, cache.Diff{
+		Changed:  []elasticsearch.Config{testConfig("changed", "20ms", true)},
+		Disabled: []elasticsearch.Config{testConfig("disabled", "1h", false)},
+		Removed:  []string{"removed"},
+	})
+
+	if got := s.Count(); got != 2 {
+		t.Fatalf("Count() = %d, want 2", got)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs["kept"] != kept {
+		t.Error("expected the unchanged device to keep its job")
+	}
+
+	if j := s.jobs["changed"]; j == nil || j.interval != 20*time.Millisecond {
+		t.Errorf("expected the changed device to be rescheduled, got %+v", j)
+	}
+}
+
+func TestScheduler_SlowDeviceDoesNotBlockOthers(t *testing.T) {
+	c := &counter{calls: make(map[string]int)}
+	release := make(chan struct{})
+	collect := func(ctx context.Context, cfg *elasticsearch.Config) {
+		if cfg.ID == "slow" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+
+		c.collect(ctx, cfg)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(collect, Config{Jitter: 0}, logger)
+
+	s.Update(context.Background(), []elasticsearch.Config{
+		testConfig("slow", "10ms", true),
+		testConfig("fast", "20ms", true),
+	})
+
+	time.Sleep(200 * time.Millisecond)
+
+	if got := c.get("fast"); got < 3 {
+		t.Errorf("expected fast device to keep collecting, got %d collections", got)
+	}
+
+	close(release)
+	s.Stop()
+}
+
+func TestScheduler_Stalled(t *testing.T) {
+	release := make(chan struct{})
+	collect := func(_ context.Context, cfg *elasticsearch.Config) {
+		if cfg.ID == "stuck" {
+			<-release
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(collect, Config{Jitter: 0}, logger)
+	defer s.Stop()
+	defer close(release)
+
+	s.Update(context.Background(), []elasticsearch.Config{
+		testConfig("stuck", "10ms", true),
+		testConfig("healthy", "10ms", true),
+	})
+
+	if stalled := s.Stalled(time.Second); len(stalled) != 0 {
+		t.Fatalf("expected no stalled devices, got %v", stalled)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	stalled := s.Stalled(20 * time.Millisecond)
+	if len(stalled) != 1 || stalled[0] != "stuck" {
+		t.Errorf("Stalled() = %v, want [stuck]", stalled)
+	}
+}
+
+func TestScheduler_Shutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  time.Duration
+		timeout   time.Duration
+		replaced  bool
+		abandoned int
+	}{
+		{name: "collection finishes", duration: 50 * time.Millisecond, timeout: time.Second, abandoned: 0},
+		{name: "collection outlives timeout", duration: time.Hour, timeout: 50 * time.Millisecond, abandoned: 1},
+		{name: "replaced job's collection outlives timeout", duration: time.Hour, timeout: 50 * time.Millisecond, replaced: true, abandoned: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			cancelled := make(chan bool, 1)
+			collect := func(ctx context.Context, _ *elasticsearch.Config) {
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+
+				select {
+				case <-time.After(tt.duration):
+					cancelled <- false
+				case <-ctx.Done():
+					cancelled <- true
+				}
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			s := New(collect, Config{Jitter: 0}, logger)
+
+			s.Update(context.Background(), []elasticsearch.Config{testConfig("device", "10ms", true)})
+			<-started
+
+			if tt.replaced {
+				s.Apply(context.Background(), cache.Diff{Changed: []elasticsearch.Config{testConfig("device", "20ms", true)}})
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			if got := s.Shutdown(ctx); got != tt.abandoned {
+				t.Errorf("Shutdown() = %d, want %d", got, tt.abandoned)
+			}
+
+			if got := <-cancelled; got != (tt.abandoned > 0) {
+				t.Errorf("collection cancelled = %v, want %v", got, tt.abandoned > 0)
+			}
+
+			if got := s.Count(); got != 0 {
+				t.Errorf("Count() = %d, want 0", got)
+			}
+		})
+	}
+}
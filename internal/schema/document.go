@@ -1,17 +1,71 @@
 package schema
 
 import (
+	"fmt"
 	"time"
 )
 
-// Document represents a metrics document.
+// DocumentMode selects how scraped samples are laid out in Elasticsearch.
+type DocumentMode string
+
+// Supported document modes.
+const (
+	// DocumentModeSample stores one document per sample.
+	DocumentModeSample DocumentMode = "sample"
+	// DocumentModeScrape stores one document per device scrape with a nested samples array.
+	DocumentModeScrape DocumentMode = "scrape"
+)
+
+// ParseDocumentMode parses a document mode, defaulting to DocumentModeSample.
+func ParseDocumentMode(s string) (DocumentMode, error) {
+	switch DocumentMode(s) {
+	case "", DocumentModeSample:
+		return DocumentModeSample, nil
+	case DocumentModeScrape:
+		return DocumentModeScrape, nil
+	default:
+		return "", fmt.Errorf("invalid document mode: %s", s)
+	}
+}
+
+// HistogramMode selects how histogram and summary samples are represented.
+type HistogramMode string
+
+// Supported histogram modes.
+const (
+	// HistogramModeFlattened emits Prometheus-style _bucket, _sum, _count and
+	// quantile samples as ordinary scalar samples.
+	HistogramModeFlattened HistogramMode = "flattened"
+	// HistogramModeNative emits one sample per histogram or summary carrying an
+	// Elasticsearch histogram field (or quantiles) plus sum and count.
+	HistogramModeNative HistogramMode = "native"
+)
+
+// ParseHistogramMode parses a histogram mode, defaulting to HistogramModeFlattened.
+func ParseHistogramMode(s string) (HistogramMode, error) {
+	switch HistogramMode(s) {
+	case "", HistogramModeFlattened:
+		return HistogramModeFlattened, nil
+	case HistogramModeNative:
+		return HistogramModeNative, nil
+	default:
+		return "", fmt.Errorf("invalid histogram mode: %s", s)
+	}
+}
+
+// Document represents a metrics or event document. In sample mode Metric is
+// set; in scrape mode Samples holds every sample from the scrape. Trap
+// documents carry Trap and the Source the notification was received from.
 type Document struct {
+	Timestamp time.Time    `json:"@timestamp"`
 	Event     EventInfo    `json:"event"`
 	Host      HostInfo     `json:"host"`
 	Observer  ObserverInfo `json:"observer"`
-	SNMP      SNMPMetrics  `json:"snmp"`
-	Metrics   MetricsInfo  `json:"metrics"`
-	Timestamp time.Time    `json:"@timestamp"`
+	Device    DeviceInfo   `json:"device"`
+	Source    *SourceInfo  `json:"source,omitempty"`
+	Metric    *Sample      `json:"metric,omitempty"`
+	Samples   []Sample     `json:"samples,omitempty"`
+	Trap      *Trap        `json:"trap,omitempty"`
 }
 
 // EventInfo contains event metadata.
@@ -20,9 +74,9 @@ type EventInfo struct {
 	Kind     string    `json:"kind"`
 	Category string    `json:"category"`
 	Type     string    `json:"type"`
-	Outcome  string    `json:"outcome"`
+	Outcome  string    `json:"outcome,omitempty"`
 	Dataset  string    `json:"dataset"`
-	Provider string    `json:"provider"`
+	Provider string    `json:"provider,omitempty"`
 }
 
 // HostInfo contains information about the monitored host.
@@ -31,6 +85,12 @@ type HostInfo struct {
 	Type     string `json:"type"`
 }
 
+// SourceInfo contains the network source of an event.
+type SourceInfo struct {
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+}
+
 // ObserverInfo contains information about the monitoring agent.
 type ObserverInfo struct {
 	Type     string `json:"type"`
@@ -38,27 +98,87 @@ type ObserverInfo struct {
 	Hostname string `json:"hostname"`
 }
 
-// SNMPMetrics contains SNMP-specific metrics.
-type SNMPMetrics struct {
-	SysInfo    map[string]interface{} `json:"sys_info"`
-	Interfaces map[string]interface{} `json:"interfaces"`
-	Metrics    map[string]interface{} `json:"metrics"`
-	Resources  []Resource            `json:"resources"`
+// DeviceInfo identifies the configured device a document belongs to.
+// Exporter names the type of exporter the samples were collected from.
+type DeviceInfo struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Exporter string     `json:"exporter,omitempty"`
+	Tags     DeviceTags `json:"tags"`
+}
+
+// DeviceTags contains the metadata tags of a device.
+type DeviceTags struct {
+	Environment string `json:"environment"`
+	Location    string `json:"location"`
+	Role        string `json:"role"`
+}
+
+// Sample is a single metric sample parsed from an exporter response. For
+// native histograms and summaries Value holds the sum of observations. Rate
+// is the per-second increase of a counter since the previous scrape.
+// Created is the time a counter, histogram or summary was created, when
+// the exporter reports it.
+type Sample struct {
+	Name      string             `json:"name"`
+	Type      string             `json:"type"`
+	Value     float64            `json:"value"`
+	Rate      *float64           `json:"rate,omitempty"`
+	Labels    map[string]string  `json:"labels,omitempty"`
+	Count     uint64             `json:"count,omitempty"`
+	Histogram *Histogram         `json:"histogram,omitempty"`
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+	Created   *time.Time         `json:"created,omitempty"`
+	Exemplar  *Exemplar          `json:"exemplar,omitempty"`
+	// CounterBits is the width of an SNMP counter, 32 or 64, or 0 when
+	// unknown. It is not indexed; it tells the rate calculator where the
+	// counter wraps.
+	CounterBits int `json:"-"`
+}
+
+// Exemplar is an example observation attached to a counter or histogram bucket.
+type Exemplar struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     float64           `json:"value"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+}
+
+// Histogram is a histogram in the Elasticsearch histogram field format:
+// strictly increasing values with the (non-cumulative) count for each.
+type Histogram struct {
+	Values []float64 `json:"values"`
+	Counts []uint64  `json:"counts"`
+}
+
+// Scrape holds all samples parsed from one exporter response.
+type Scrape struct {
+	Target    string
+	Timestamp time.Time
+	Samples   []Sample
 }
 
-// Resource represents a monitored SNMP resource.
-type Resource struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Type        string                 `json:"type"`
-	Values      map[string]interface{} `json:"values"`
+// Trap is an SNMP trap or inform. OID is the snmpTrapOID of the notification;
+// SNMPv1 traps are translated to it as described in RFC 3584.
+type Trap struct {
+	Version string `json:"version"`
+	// PDU is "trap" or "inform".
+	PDU string `json:"pdu"`
+	OID string `json:"oid"`
+	// Uptime is the sender's sysUpTime in hundredths of a second.
+	Uptime       uint32 `json:"uptime"`
+	Enterprise   string `json:"enterprise,omitempty"`
+	AgentAddress string `json:"agent_address,omitempty"`
+	// User is the SNMPv3 security name the notification was authenticated with.
+	User      string     `json:"user,omitempty"`
+	Variables []Variable `json:"variables,omitempty"`
 }
 
-// MetricsInfo contains general metrics information.
-type MetricsInfo struct {
-	Name      string                 `json:"name"`
-	Labels    map[string]string      `json:"labels"`
-	Value     float64                `json:"value"`
-	Timestamp time.Time              `json:"timestamp"`
-	Metadata  map[string]interface{} `json:"metadata"`
+// Variable is a variable binding of a trap. Value holds the textual form of
+// every type; Number is also set for integer types.
+type Variable struct {
+	OID    string   `json:"oid"`
+	Type   string   `json:"type"`
+	Value  string   `json:"value"`
+	Number *float64 `json:"number,omitempty"`
 }
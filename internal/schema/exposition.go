@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ParseError is returned by ParseFamilies for an exposition it cannot decode.
+type ParseError struct {
+	// MediaType is the format the exposition was parsed as.
+	MediaType string
+	Err       error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parsing %s exposition: %v", e.MediaType, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseFamilies decodes an exposition in the format named by contentType:
+// the Prometheus text format, OpenMetrics text or delimited protobuf. An
+// empty or unrecognised content type is parsed as the Prometheus text format.
+// Failures are returned as *ParseError.
+func ParseFamilies(contentType string, data []byte) (map[string]*dto.MetricFamily, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+
+	var families map[string]*dto.MetricFamily
+
+	switch mediaType {
+	case expfmt.OpenMetricsType:
+		families, err = parseOpenMetrics(data)
+	case expfmt.ProtoType:
+		families, err = parseProtobuf(data)
+	default:
+		mediaType = "text/plain"
+
+		var parser expfmt.TextParser
+		families, err = parser.TextToMetricFamilies(bytes.NewReader(data))
+	}
+
+	if err != nil {
+		return nil, &ParseError{MediaType: mediaType, Err: err}
+	}
+
+	return families, nil
+}
+
+// parseProtobuf decodes a stream of length-delimited MetricFamily messages.
+func parseProtobuf(data []byte) (map[string]*dto.MetricFamily, error) {
+	families := make(map[string]*dto.MetricFamily)
+	decoder := expfmt.NewDecoder(bytes.NewReader(data), expfmt.NewFormat(expfmt.TypeProtoDelim))
+
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err != nil {
+			if errors.Is(err, io.EOF) {
+				return families, nil
+			}
+
+			return nil, fmt.Errorf("decoding protobuf: %w", err)
+		}
+
+		if existing, ok := families[family.GetName()]; ok {
+			existing.Metric = append(existing.Metric, family.Metric...)
+			continue
+		}
+
+		families[family.GetName()] = family
+	}
+}
+
+// protoTime converts a created timestamp, which exporters leave unset when unknown.
+func protoTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+
+	created := ts.AsTime().UTC()
+
+	return &created
+}
+
+// exemplar converts an exemplar; exemplars with values JSON cannot hold are dropped.
+func exemplar(e *dto.Exemplar) *Exemplar {
+	if e == nil || math.IsNaN(e.GetValue()) || math.IsInf(e.GetValue(), 0) {
+		return nil
+	}
+
+	result := &Exemplar{Value: e.GetValue()}
+
+	if len(e.Label) > 0 {
+		result.Labels = make(map[string]string, len(e.Label))
+		for _, label := range e.Label {
+			result.Labels[label.GetName()] = label.GetValue()
+		}
+	}
+
+	result.Timestamp = protoTime(e.GetTimestamp())
+
+	return result
+}
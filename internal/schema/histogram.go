@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// appendHistogram appends the samples for one histogram metric.
+func (t *Transformer) appendHistogram(samples []Sample, name, metricType string, h *dto.Histogram, labels map[string]string) []Sample {
+	if t.histogramMode == HistogramModeNative {
+		sample := Sample{
+			Name:      name,
+			Type:      metricType,
+			Labels:    labels,
+			Count:     h.GetSampleCount(),
+			Histogram: nativeHistogram(h.GetBucket()),
+			Created:   protoTime(h.GetCreatedTimestamp()),
+		}
+
+		if sum := h.GetSampleSum(); !math.IsNaN(sum) && !math.IsInf(sum, 0) {
+			sample.Value = sum
+		}
+
+		return append(samples, sample)
+	}
+
+	for _, bucket := range h.GetBucket() {
+		n := len(samples)
+
+		samples = appendScalar(samples, name+"_bucket", metricType, float64(bucket.GetCumulativeCount()),
+			withLabel(labels, "le", formatFloat(bucket.GetUpperBound())))
+		if len(samples) > n {
+			samples[n].Exemplar = exemplar(bucket.GetExemplar())
+		}
+	}
+
+	// The +Inf bucket is implicit in the exposition format and equals the count.
+	if n := len(h.GetBucket()); n == 0 || !math.IsInf(h.GetBucket()[n-1].GetUpperBound(), 1) {
+		samples = appendScalar(samples, name+"_bucket", metricType, float64(h.GetSampleCount()),
+			withLabel(labels, "le", "+Inf"))
+	}
+
+	samples = appendScalar(samples, name+"_sum", metricType, h.GetSampleSum(), labels)
+
+	return appendCount(samples, name, metricType, h.GetSampleCount(), h.GetCreatedTimestamp(), labels)
+}
+
+// appendSummary appends the samples for one summary metric.
+func (t *Transformer) appendSummary(samples []Sample, name, metricType string, s *dto.Summary, labels map[string]string) []Sample {
+	if t.histogramMode == HistogramModeNative {
+		sample := Sample{
+			Name:      name,
+			Type:      metricType,
+			Labels:    labels,
+			Count:     s.GetSampleCount(),
+			Quantiles: make(map[string]float64, len(s.GetQuantile())),
+			Created:   protoTime(s.GetCreatedTimestamp()),
+		}
+
+		if sum := s.GetSampleSum(); !math.IsNaN(sum) && !math.IsInf(sum, 0) {
+			sample.Value = sum
+		}
+
+		for _, q := range s.GetQuantile() {
+			if v := q.GetValue(); !math.IsNaN(v) && !math.IsInf(v, 0) {
+				sample.Quantiles[quantileKey(q.GetQuantile())] = v
+			}
+		}
+
+		return append(samples, sample)
+	}
+
+	for _, q := range s.GetQuantile() {
+		samples = appendScalar(samples, name, metricType, q.GetValue(),
+			withLabel(labels, "quantile", formatFloat(q.GetQuantile())))
+	}
+
+	samples = appendScalar(samples, name+"_sum", metricType, s.GetSampleSum(), labels)
+
+	return appendCount(samples, name, metricType, s.GetSampleCount(), s.GetCreatedTimestamp(), labels)
+}
+
+// appendCount appends the _count sample of a flattened histogram or summary,
+// which carries the created time of the whole metric.
+func appendCount(samples []Sample, name, metricType string, count uint64, created *timestamppb.Timestamp, labels map[string]string) []Sample {
+	samples = appendScalar(samples, name+"_count", metricType, float64(count), labels)
+	samples[len(samples)-1].Created = protoTime(created)
+
+	return samples
+}
+
+// nativeHistogram converts cumulative Prometheus buckets to the Elasticsearch
+// histogram format. Each bucket is represented by the midpoint of its bounds;
+// the +Inf bucket, which has no midpoint, uses the last finite upper bound.
+// Empty buckets are omitted.
+func nativeHistogram(buckets []*dto.Bucket) *Histogram {
+	h := &Histogram{
+		Values: make([]float64, 0, len(buckets)),
+		Counts: make([]uint64, 0, len(buckets)),
+	}
+
+	var (
+		lower    float64
+		previous uint64
+	)
+
+	for i, bucket := range buckets {
+		upper := bucket.GetUpperBound()
+		cumulative := bucket.GetCumulativeCount()
+
+		var value float64
+
+		switch {
+		case math.IsInf(upper, 1):
+			value = lower
+		case i == 0 && upper > 0:
+			// The first bucket's lower bound is unknown; assume zero.
+			value = upper / 2
+		case i == 0:
+			value = upper
+		default:
+			value = (lower + upper) / 2
+		}
+
+		if cumulative > previous {
+			count := cumulative - previous
+			previous = cumulative
+
+			// Values must be strictly increasing; merge into the previous entry otherwise.
+			if n := len(h.Values); n > 0 && value <= h.Values[n-1] {
+				h.Counts[n-1] += count
+			} else {
+				h.Values = append(h.Values, value)
+				h.Counts = append(h.Counts, count)
+			}
+		}
+
+		if !math.IsInf(upper, 1) {
+			lower = upper
+		}
+	}
+
+	return h
+}
+
+// withLabel returns a copy of labels with name set to value.
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+
+	result[name] = value
+
+	return result
+}
+
+// formatFloat formats a bucket bound or quantile as Prometheus does.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// quantileKey names a quantile as a field without dots, e.g. 0.99 -> p99 and
+// 0.999 -> p99_9, since Elasticsearch treats dots in field names as objects.
+func quantileKey(q float64) string {
+	percentile := math.Round(q*1e6) / 1e4 // Avoid float noise such as 99.89999999999999.
+
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(percentile, 'f', -1, 64), ".", "_")
+}
@@ -0,0 +1,488 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// openMetricsSuffixes lists the sample name suffixes each OpenMetrics family type may use.
+var openMetricsSuffixes = map[string][]string{
+	"counter":        {"_total", "_created", ""},
+	"gauge":          {""},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"", "_count", "_sum", "_created"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// counterSuffix ends the sample names of OpenMetrics counters. The text and
+// protobuf formats name a counter family after its samples, so OpenMetrics
+// counter families are renamed to match.
+const counterSuffix = "_total"
+
+// openMetricsTypes maps OpenMetrics family types to their closest Prometheus type.
+var openMetricsTypes = map[string]dto.MetricType{
+	"counter":        dto.MetricType_COUNTER,
+	"gauge":          dto.MetricType_GAUGE,
+	"histogram":      dto.MetricType_HISTOGRAM,
+	"gaugehistogram": dto.MetricType_GAUGE_HISTOGRAM,
+	"summary":        dto.MetricType_SUMMARY,
+	"info":           dto.MetricType_GAUGE,
+	"stateset":       dto.MetricType_GAUGE,
+	"unknown":        dto.MetricType_UNTYPED,
+}
+
+// openMetricsParser parses the OpenMetrics text format into metric families.
+type openMetricsParser struct {
+	families   map[string]*dto.MetricFamily
+	family     *dto.MetricFamily
+	familyType string
+	metrics    map[string]*dto.Metric
+}
+
+// parseOpenMetrics parses an OpenMetrics exposition, including exemplars and
+// _created samples.
+func parseOpenMetrics(data []byte) (map[string]*dto.MetricFamily, error) {
+	p := &openMetricsParser{families: make(map[string]*dto.MetricFamily)}
+
+	lines := strings.Split(string(data), "\n")
+	eof := false
+
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		if eof {
+			return nil, fmt.Errorf("line %d: content after # EOF", i+1)
+		}
+
+		var err error
+
+		if strings.HasPrefix(line, "#") {
+			eof, err = p.parseComment(line)
+		} else {
+			err = p.parseSample(line)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+
+	if !eof {
+		return nil, fmt.Errorf("missing # EOF")
+	}
+
+	return counterSampleNames(p.families), nil
+}
+
+// counterSampleNames renames counter families to the name of their _total
+// samples, unless a family already has that name.
+func counterSampleNames(families map[string]*dto.MetricFamily) map[string]*dto.MetricFamily {
+	renamed := make(map[string]*dto.MetricFamily, len(families))
+
+	for name, family := range families {
+		if family.GetType() == dto.MetricType_COUNTER {
+			if _, taken := families[name+counterSuffix]; !taken {
+				name += counterSuffix
+				family.Name = proto.String(name)
+			}
+		}
+
+		renamed[name] = family
+	}
+
+	return renamed
+}
+
+// parseComment handles # TYPE, # HELP, # UNIT and # EOF lines. It reports
+// whether the line ended the exposition.
+func (p *openMetricsParser) parseComment(line string) (bool, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) == 2 && fields[1] == "EOF" {
+		return true, nil
+	}
+
+	if len(fields) < 3 {
+		return false, fmt.Errorf("malformed comment %q", line)
+	}
+
+	var value string
+	if len(fields) == 4 {
+		value = fields[3]
+	}
+
+	switch fields[1] {
+	case "TYPE":
+		if _, ok := openMetricsTypes[value]; !ok {
+			return false, fmt.Errorf("unknown metric type %q", value)
+		}
+
+		p.startFamily(fields[2])
+		p.familyType = value
+		p.family.Type = openMetricsTypes[value].Enum()
+	case "HELP":
+		p.startFamily(fields[2])
+		p.family.Help = proto.String(unescapeHelp(value))
+	case "UNIT":
+		p.startFamily(fields[2])
+		p.family.Unit = proto.String(value)
+	default:
+		return false, fmt.Errorf("unknown comment %q", fields[1])
+	}
+
+	return false, nil
+}
+
+// startFamily makes name the current family, creating it when first seen.
+func (p *openMetricsParser) startFamily(name string) {
+	if p.family != nil && p.family.GetName() == name {
+		return
+	}
+
+	family, ok := p.families[name]
+	if !ok {
+		family = &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum()}
+		p.families[name] = family
+	}
+
+	p.family = family
+	p.familyType = strings.ToLower(family.GetType().String())
+	p.metrics = make(map[string]*dto.Metric)
+
+	switch family.GetType() {
+	case dto.MetricType_UNTYPED:
+		p.familyType = "unknown"
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		p.familyType = "gaugehistogram"
+	}
+
+	for _, m := range family.Metric {
+		p.metrics[labelKey(m.Label)] = m
+	}
+}
+
+// suffix returns the suffix of name relative to the current family, if name
+// is a valid sample name of that family.
+func (p *openMetricsParser) suffix(name string) (string, bool) {
+	if p.family == nil || !strings.HasPrefix(name, p.family.GetName()) {
+		return "", false
+	}
+
+	suffix := name[len(p.family.GetName()):]
+	for _, s := range openMetricsSuffixes[p.familyType] {
+		if s == suffix {
+			return suffix, true
+		}
+	}
+
+	return "", false
+}
+
+// parseSample parses a sample line and adds it to the current family.
+func (p *openMetricsParser) parseSample(line string) error {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return fmt.Errorf("malformed sample %q", line)
+	}
+
+	name, rest := line[:end], line[end:]
+
+	var (
+		labels []*dto.LabelPair
+		err    error
+	)
+
+	if strings.HasPrefix(rest, "{") {
+		labels, rest, err = parseLabelSet(rest)
+		if err != nil {
+			return err
+		}
+	}
+
+	var exemplar *dto.Exemplar
+
+	if i := strings.Index(rest, " # "); i >= 0 {
+		exemplar, err = parseExemplar(rest[i+3:])
+		if err != nil {
+			return err
+		}
+
+		rest = rest[:i]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("malformed sample %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %w", fields[0], err)
+	}
+
+	suffix, ok := p.suffix(name)
+	if !ok {
+		// Samples without metadata form an unknown-typed family of their own.
+		p.startFamily(name)
+		suffix = ""
+	}
+
+	// Bucket bounds and quantiles are part of the metric, not its identity.
+	var special *dto.LabelPair
+
+	identity := labels[:0:0]
+
+	for _, l := range labels {
+		if (l.GetName() == "le" && suffix == "_bucket") || (l.GetName() == "quantile" && p.familyType == "summary" && suffix == "") {
+			special = l
+			continue
+		}
+
+		identity = append(identity, l)
+	}
+
+	metric := p.metric(identity)
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", fields[1], err)
+		}
+
+		metric.TimestampMs = proto.Int64(int64(math.Round(ts * 1000)))
+	}
+
+	return p.setValue(metric, suffix, special, value, exemplar)
+}
+
+// metric returns the metric of the current family with the given labels.
+func (p *openMetricsParser) metric(labels []*dto.LabelPair) *dto.Metric {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+
+	key := labelKey(labels)
+	if m, ok := p.metrics[key]; ok {
+		return m
+	}
+
+	m := &dto.Metric{Label: labels}
+
+	switch p.family.GetType() {
+	case dto.MetricType_COUNTER:
+		m.Counter = &dto.Counter{}
+	case dto.MetricType_GAUGE:
+		m.Gauge = &dto.Gauge{}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		m.Histogram = &dto.Histogram{}
+	case dto.MetricType_SUMMARY:
+		m.Summary = &dto.Summary{}
+	default:
+		m.Untyped = &dto.Untyped{}
+	}
+
+	p.family.Metric = append(p.family.Metric, m)
+	p.metrics[key] = m
+
+	return m
+}
+
+// setValue stores a sample value on its metric according to the family type and suffix.
+func (p *openMetricsParser) setValue(m *dto.Metric, suffix string, special *dto.LabelPair, value float64, exemplar *dto.Exemplar) error {
+	switch p.family.GetType() {
+	case dto.MetricType_COUNTER:
+		if suffix == "_created" {
+			m.Counter.CreatedTimestamp = secondsToTimestamp(value)
+			return nil
+		}
+
+		m.Counter.Value = proto.Float64(value)
+		m.Counter.Exemplar = exemplar
+	case dto.MetricType_GAUGE:
+		m.Gauge.Value = proto.Float64(value)
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		switch suffix {
+		case "_bucket":
+			if special == nil {
+				return fmt.Errorf("bucket of %s has no le label", p.family.GetName())
+			}
+
+			upper, err := strconv.ParseFloat(special.GetValue(), 64)
+			if err != nil {
+				return fmt.Errorf("invalid le %q: %w", special.GetValue(), err)
+			}
+
+			m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+				UpperBound:      proto.Float64(upper),
+				CumulativeCount: proto.Uint64(uint64(value)),
+				Exemplar:        exemplar,
+			})
+		case "_count", "_gcount":
+			m.Histogram.SampleCount = proto.Uint64(uint64(value))
+		case "_sum", "_gsum":
+			m.Histogram.SampleSum = proto.Float64(value)
+		case "_created":
+			m.Histogram.CreatedTimestamp = secondsToTimestamp(value)
+		}
+	case dto.MetricType_SUMMARY:
+		switch suffix {
+		case "":
+			if special == nil {
+				return fmt.Errorf("quantile of %s has no quantile label", p.family.GetName())
+			}
+
+			q, err := strconv.ParseFloat(special.GetValue(), 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantile %q: %w", special.GetValue(), err)
+			}
+
+			m.Summary.Quantile = append(m.Summary.Quantile, &dto.Quantile{
+				Quantile: proto.Float64(q),
+				Value:    proto.Float64(value),
+			})
+		case "_count":
+			m.Summary.SampleCount = proto.Uint64(uint64(value))
+		case "_sum":
+			m.Summary.SampleSum = proto.Float64(value)
+		case "_created":
+			m.Summary.CreatedTimestamp = secondsToTimestamp(value)
+		}
+	default:
+		m.Untyped.Value = proto.Float64(value)
+	}
+
+	return nil
+}
+
+// parseExemplar parses the "{labels} value [timestamp]" part of a sample line.
+func parseExemplar(s string) (*dto.Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("malformed exemplar %q", s)
+	}
+
+	labels, rest, err := parseLabelSet(s)
+	if err != nil {
+		return nil, fmt.Errorf("exemplar: %w", err)
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("malformed exemplar %q", s)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar value %q: %w", fields[0], err)
+	}
+
+	exemplar := &dto.Exemplar{Label: labels, Value: proto.Float64(value)}
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exemplar timestamp %q: %w", fields[1], err)
+		}
+
+		exemplar.Timestamp = secondsToTimestamp(ts)
+	}
+
+	return exemplar, nil
+}
+
+// parseLabelSet parses a {name="value",...} label set at the start of s and
+// returns the labels and the remainder of s.
+func parseLabelSet(s string) ([]*dto.LabelPair, string, error) {
+	var labels []*dto.LabelPair
+
+	s = s[1:]
+
+	for {
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("malformed label set")
+		}
+
+		name := s[:eq]
+		s = s[eq+2:]
+
+		var (
+			value   strings.Builder
+			escaped bool
+			closed  bool
+		)
+
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+
+			switch {
+			case escaped:
+				if c == 'n' {
+					c = '\n'
+				}
+
+				value.WriteByte(c)
+
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				s = s[i+1:]
+				closed = true
+			default:
+				value.WriteByte(c)
+			}
+
+			if closed {
+				break
+			}
+		}
+
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value for label %s", name)
+		}
+
+		labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value.String())})
+
+		s = strings.TrimPrefix(s, ",")
+	}
+}
+
+// labelKey identifies a metric within a family by its labels.
+func labelKey(labels []*dto.LabelPair) string {
+	var b strings.Builder
+
+	for _, l := range labels {
+		b.WriteString(l.GetName())
+		b.WriteByte(0)
+		b.WriteString(l.GetValue())
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+// unescapeHelp reverses the escaping of HELP text.
+func unescapeHelp(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(s)
+}
+
+// secondsToTimestamp converts a timestamp in fractional seconds.
+func secondsToTimestamp(seconds float64) *timestamppb.Timestamp {
+	sec, frac := math.Modf(seconds)
+	return timestamppb.New(time.Unix(int64(sec), int64(frac*1e9)))
+}
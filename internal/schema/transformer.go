@@ -2,48 +2,167 @@ package schema
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
 )
 
 // Transformer converts Prometheus metrics to ECS documents.
 type Transformer struct {
 	observerHostname string
 	observerVersion  string
+	histogramMode    HistogramMode
+}
+
+// WithHistogramMode sets how histogram and summary samples are represented.
+func WithHistogramMode(mode HistogramMode) func(*Transformer) {
+	return func(t *Transformer) {
+		t.histogramMode = mode
+	}
 }
 
 // NewTransformer creates a new transformer instance.
-func NewTransformer(observerHostname, observerVersion string) *Transformer {
-	return &Transformer{
+func NewTransformer(observerHostname, observerVersion string, opts ...func(*Transformer)) *Transformer {
+	t := &Transformer{
 		observerHostname: observerHostname,
 		observerVersion:  observerVersion,
+		histogramMode:    HistogramModeFlattened,
+	}
+
+	for _, opt := range opts {
+		opt(t)
 	}
+
+	return t
 }
 
-// TransformMetrics converts raw metrics data to a document.
-func (t *Transformer) TransformMetrics(target string, metricsData []byte) (*Document, error) {
-	var parser expfmt.TextParser
-	metrics, err := parser.TextToMetricFamilies(strings.NewReader(string(metricsData)))
+// SampleFilter selects which samples are kept during transformation.
+type SampleFilter interface {
+	// MatchName reports whether any sample of the named metric could be kept.
+	MatchName(name string) bool
+	// Match reports whether a sample with the given name and labels is kept.
+	Match(name string, labels map[string]string) bool
+}
 
+// TransformMetrics parses raw exporter output of the given content type,
+// scraped at the given time, into samples, keeping only those accepted by
+// filter. A nil filter keeps all samples.
+func (t *Transformer) TransformMetrics(target string, scrapedAt time.Time, contentType string, metricsData []byte, filter SampleFilter) (*Scrape, error) {
+	families, err := ParseFamilies(contentType, metricsData)
 	if err != nil {
 		return nil, fmt.Errorf("parsing metrics: %w", err)
 	}
 
-	now := time.Now().UTC()
+	return t.TransformFamilies(target, scrapedAt, families, filter), nil
+}
+
+// TransformFamilies converts parsed metric families into samples, keeping only
+// those accepted by filter. A nil filter keeps all samples.
+func (t *Transformer) TransformFamilies(target string, scrapedAt time.Time, families map[string]*dto.MetricFamily, filter SampleFilter) *Scrape {
+	scrape := &Scrape{
+		Target:    target,
+		Timestamp: scrapedAt.UTC(),
+		Samples:   make([]Sample, 0, len(families)),
+	}
+
+	// Iterate in name order so documents are produced deterministically.
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if filter != nil && !filter.MatchName(name) {
+			continue
+		}
+
+		family := families[name]
+		metricType := strings.ToLower(family.GetType().String())
+
+		for _, metric := range family.Metric {
+			sampleLabels := labels(metric)
+			if filter != nil && !filter.Match(name, sampleLabels) {
+				continue
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				scrape.Samples = appendCounter(scrape.Samples, name, metricType, metric.GetCounter(), sampleLabels)
+			case dto.MetricType_GAUGE:
+				scrape.Samples = appendScalar(scrape.Samples, name, metricType, metric.GetGauge().GetValue(), sampleLabels)
+			case dto.MetricType_UNTYPED:
+				scrape.Samples = appendScalar(scrape.Samples, name, metricType, metric.GetUntyped().GetValue(), sampleLabels)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				scrape.Samples = t.appendHistogram(scrape.Samples, name, metricType, metric.GetHistogram(), sampleLabels)
+			case dto.MetricType_SUMMARY:
+				scrape.Samples = t.appendSummary(scrape.Samples, name, metricType, metric.GetSummary(), sampleLabels)
+			}
+		}
+	}
+
+	return scrape
+}
+
+// labels returns the label pairs of a metric as a map.
+func labels(metric *dto.Metric) map[string]string {
+	if len(metric.Label) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(metric.Label))
+	for _, label := range metric.Label {
+		result[label.GetName()] = label.GetValue()
+	}
+
+	return result
+}
+
+// appendScalar appends a single-valued sample. JSON cannot represent NaN or
+// infinities, so such samples are dropped.
+func appendScalar(samples []Sample, name, metricType string, value float64, labels map[string]string) []Sample {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return samples
+	}
+
+	return append(samples, Sample{
+		Name:   name,
+		Type:   metricType,
+		Value:  value,
+		Labels: labels,
+	})
+}
 
-	doc := &Document{
-		Timestamp: now,
+// appendCounter appends a counter sample with its created time and exemplar.
+func appendCounter(samples []Sample, name, metricType string, counter *dto.Counter, labels map[string]string) []Sample {
+	n := len(samples)
+
+	samples = appendScalar(samples, name, metricType, counter.GetValue(), labels)
+	if len(samples) > n {
+		samples[n].Created = protoTime(counter.GetCreatedTimestamp())
+		samples[n].Exemplar = exemplar(counter.GetExemplar())
+	}
+
+	return samples
+}
+
+// Documents builds the documents for a scrape according to the document mode.
+func (t *Transformer) Documents(scrape *Scrape, device DeviceInfo, mode DocumentMode) []Document {
+	base := Document{
+		Timestamp: scrape.Timestamp,
 		Event: EventInfo{
 			Kind:     "metric",
 			Category: "network",
 			Type:     "info",
-			Created:  now,
+			Dataset:  "snmp.metrics",
+			Created:  time.Now().UTC(),
 		},
 		Host: HostInfo{
-			Hostname: target,
+			Hostname: scrape.Target,
 			Type:     "network-device",
 		},
 		Observer: ObserverInfo{
@@ -51,42 +170,50 @@ func (t *Transformer) TransformMetrics(target string, metricsData []byte) (*Docu
 			Version:  t.observerVersion,
 			Hostname: t.observerHostname,
 		},
-		SNMP: SNMPMetrics{
-			SysInfo:    make(map[string]interface{}),
-			Interfaces: make(map[string]interface{}),
-			Metrics:    make(map[string]interface{}),
-			Resources:  make([]Resource, 0),
-		},
+		Device: device,
 	}
 
-	// Process metrics
-	for name, family := range metrics {
-		for _, metric := range family.Metric {
-			resource := Resource{
-				Name:   name,
-				Type:   family.GetType().String(),
-				Values: make(map[string]interface{}),
-			}
+	if mode == DocumentModeScrape {
+		doc := base
+		doc.Samples = scrape.Samples
 
-			switch family.GetType() {
-			case dto.MetricType_COUNTER:
-				resource.Values["value"] = metric.Counter.GetValue()
-			case dto.MetricType_GAUGE:
-				resource.Values["value"] = metric.Gauge.GetValue()
-			case dto.MetricType_UNTYPED:
-				resource.Values["value"] = metric.GetUntyped().GetValue()
-			}
-
-			// Add labels as values
-			for _, label := range metric.Label {
-				resource.Values[label.GetName()] = label.GetValue()
-			}
+		return []Document{doc}
+	}
 
-			doc.SNMP.Resources = append(doc.SNMP.Resources, resource)
-		}
+	docs := make([]Document, len(scrape.Samples))
+	for i := range scrape.Samples {
+		docs[i] = base
+		docs[i].Metric = &scrape.Samples[i]
 	}
 
-	return doc, nil
+	return docs
+}
+
+// TrapDocument builds the alert event document for a received trap. Host is
+// the device's configured host.
+func (t *Transformer) TrapDocument(trap *Trap, receivedAt time.Time, host string, source SourceInfo, device DeviceInfo) Document {
+	return Document{
+		Timestamp: receivedAt,
+		Event: EventInfo{
+			Kind:     "alert",
+			Category: "network",
+			Type:     "info",
+			Dataset:  "snmp.trap",
+			Created:  time.Now().UTC(),
+		},
+		Host: HostInfo{
+			Hostname: host,
+			Type:     "network-device",
+		},
+		Observer: ObserverInfo{
+			Type:     "snmp-collector",
+			Version:  t.observerVersion,
+			Hostname: t.observerHostname,
+		},
+		Device: device,
+		Source: &source,
+		Trap:   trap,
+	}
 }
 
 // ValidateDocument checks if a document meets our schema requirements.
@@ -95,16 +222,28 @@ func (t *Transformer) ValidateDocument(doc *Document) error {
 		return fmt.Errorf("document is nil")
 	}
 
+	if doc.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+
 	if doc.Host.Hostname == "" {
 		return fmt.Errorf("hostname is required")
 	}
 
+	if doc.Device.ID == "" {
+		return fmt.Errorf("device ID is required")
+	}
+
 	if doc.Observer.Type == "" {
 		return fmt.Errorf("observer type is required")
 	}
 
-	if len(doc.SNMP.Resources) == 0 {
-		return fmt.Errorf("at least one metric resource is required")
+	if doc.Metric == nil && len(doc.Samples) == 0 && doc.Trap == nil {
+		return fmt.Errorf("at least one metric sample or a trap is required")
+	}
+
+	if doc.Metric != nil && doc.Metric.Name == "" {
+		return fmt.Errorf("metric name is required")
 	}
 
 	return nil
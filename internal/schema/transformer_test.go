@@ -0,0 +1,438 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+const testMetrics = `# HELP ifInOctets The total number of octets received on the interface.
+# TYPE ifInOctets counter
+ifInOctets{ifIndex="1",ifDescr="Gi0/1"} 1000
+ifInOctets{ifIndex="2",ifDescr="Gi0/2"} 2000
+# HELP sysUpTime The time since the network management portion of the system was last re-initialized.
+# TYPE sysUpTime gauge
+sysUpTime 123456
+# HELP snmp_scrape_walk_duration_seconds Time SNMP walk/bulkwalk took.
+# TYPE snmp_scrape_walk_duration_seconds gauge
+snmp_scrape_walk_duration_seconds NaN
+`
+
+func TestTransformer_TransformMetrics(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+	scrapedAt := time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC)
+
+	scrape, err := transformer.TransformMetrics("switch01", scrapedAt, "", []byte(testMetrics), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	if !scrape.Timestamp.Equal(scrapedAt) {
+		t.Errorf("expected timestamp %v, got %v", scrapedAt, scrape.Timestamp)
+	}
+
+	// The NaN sample cannot be stored and is dropped.
+	if len(scrape.Samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(scrape.Samples))
+	}
+
+	first := scrape.Samples[0]
+	if first.Name != "ifInOctets" || first.Type != "counter" || first.Value != 1000 {
+		t.Errorf("unexpected first sample: %+v", first)
+	}
+
+	if first.Labels["ifDescr"] != "Gi0/1" {
+		t.Errorf("expected ifDescr label Gi0/1, got %q", first.Labels["ifDescr"])
+	}
+
+	if _, err := transformer.TransformMetrics("switch01", scrapedAt, "", []byte("not metrics {"), nil); err == nil {
+		t.Error("expected error for invalid exposition format")
+	}
+}
+
+func TestTransformer_Documents(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+	scrapedAt := time.Date(2025, 2, 18, 23, 5, 0, 0, time.UTC)
+	device := DeviceInfo{ID: "switch01", Name: "Switch 01", Tags: DeviceTags{Environment: "development"}}
+
+	scrape, err := transformer.TransformMetrics("switch01", scrapedAt, "", []byte(testMetrics), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	t.Run("sample mode", func(t *testing.T) {
+		docs := transformer.Documents(scrape, device, DocumentModeSample)
+		if len(docs) != len(scrape.Samples) {
+			t.Fatalf("expected %d documents, got %d", len(scrape.Samples), len(docs))
+		}
+
+		for i := range docs {
+			if err := transformer.ValidateDocument(&docs[i]); err != nil {
+				t.Errorf("document %d invalid: %v", i, err)
+			}
+
+			if docs[i].Metric.Name != scrape.Samples[i].Name {
+				t.Errorf("document %d has metric %s, want %s", i, docs[i].Metric.Name, scrape.Samples[i].Name)
+			}
+		}
+
+		data, err := json.Marshal(docs[0])
+		if err != nil {
+			t.Fatalf("marshalling document: %v", err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("unmarshalling document: %v", err)
+		}
+
+		if decoded["@timestamp"] != "2025-02-18T23:05:00Z" {
+			t.Errorf("expected scrape timestamp, got %v", decoded["@timestamp"])
+		}
+
+		if _, ok := decoded["samples"]; ok {
+			t.Error("sample mode documents should not carry a samples array")
+		}
+	})
+
+	t.Run("scrape mode", func(t *testing.T) {
+		docs := transformer.Documents(scrape, device, DocumentModeScrape)
+		if len(docs) != 1 {
+			t.Fatalf("expected 1 document, got %d", len(docs))
+		}
+
+		if err := transformer.ValidateDocument(&docs[0]); err != nil {
+			t.Errorf("document invalid: %v", err)
+		}
+
+		if len(docs[0].Samples) != len(scrape.Samples) {
+			t.Errorf("expected %d samples, got %d", len(scrape.Samples), len(docs[0].Samples))
+		}
+	})
+}
+
+func TestParseDocumentMode(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    DocumentMode
+		wantErr bool
+	}{
+		{in: "", want: DocumentModeSample},
+		{in: "sample", want: DocumentModeSample},
+		{in: "scrape", want: DocumentModeScrape},
+		{in: "bulk", wantErr: true},
+	} {
+		got, err := ParseDocumentMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDocumentMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseDocumentMode(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// nameFilter keeps samples whose name is in the set.
+type nameFilter map[string]bool
+
+func (f nameFilter) MatchName(name string) bool { return f[name] }
+
+func (f nameFilter) Match(name string, labels map[string]string) bool {
+	return f[name] && labels["ifDescr"] != "Gi0/2"
+}
+
+func TestTransformer_TransformMetricsFilter(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+
+	scrape, err := transformer.TransformMetrics("switch01", time.Now(), "", []byte(testMetrics), nameFilter{"ifInOctets": true})
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	if len(scrape.Samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(scrape.Samples))
+	}
+
+	if got := scrape.Samples[0].Labels["ifDescr"]; got != "Gi0/1" {
+		t.Errorf("expected the Gi0/1 sample to be kept, got %s", got)
+	}
+}
+
+const testHistogram = `# HELP snmp_scrape_seconds Scrape duration.
+# TYPE snmp_scrape_seconds histogram
+snmp_scrape_seconds_bucket{le="0.1"} 2
+snmp_scrape_seconds_bucket{le="0.5"} 5
+snmp_scrape_seconds_bucket{le="1"} 5
+snmp_scrape_seconds_bucket{le="+Inf"} 6
+snmp_scrape_seconds_sum 3.5
+snmp_scrape_seconds_count 6
+# HELP snmp_walk_seconds Walk duration.
+# TYPE snmp_walk_seconds summary
+snmp_walk_seconds{quantile="0.5"} 0.2
+snmp_walk_seconds{quantile="0.99"} 0.9
+snmp_walk_seconds_sum 4
+snmp_walk_seconds_count 10
+`
+
+func TestTransformer_HistogramsFlattened(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+
+	scrape, err := transformer.TransformMetrics("switch01", time.Now(), "", []byte(testHistogram), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, s := range scrape.Samples {
+		key := s.Name
+		if le, ok := s.Labels["le"]; ok {
+			key += "{le=" + le + "}"
+		}
+
+		if q, ok := s.Labels["quantile"]; ok {
+			key += "{quantile=" + q + "}"
+		}
+
+		values[key] = s.Value
+	}
+
+	want := map[string]float64{
+		"snmp_scrape_seconds_bucket{le=0.1}":  2,
+		"snmp_scrape_seconds_bucket{le=0.5}":  5,
+		"snmp_scrape_seconds_bucket{le=1}":    5,
+		"snmp_scrape_seconds_bucket{le=+Inf}": 6,
+		"snmp_scrape_seconds_sum":             3.5,
+		"snmp_scrape_seconds_count":           6,
+		"snmp_walk_seconds{quantile=0.5}":     0.2,
+		"snmp_walk_seconds{quantile=0.99}":    0.9,
+		"snmp_walk_seconds_sum":               4,
+		"snmp_walk_seconds_count":             10,
+	}
+
+	if len(values) != len(want) {
+		t.Fatalf("expected %d samples, got %d: %v", len(want), len(values), values)
+	}
+
+	for key, v := range want {
+		if got, ok := values[key]; !ok || got != v {
+			t.Errorf("%s = %v (present %v), want %v", key, got, ok, v)
+		}
+	}
+}
+
+func TestTransformer_HistogramsNative(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0", WithHistogramMode(HistogramModeNative))
+
+	scrape, err := transformer.TransformMetrics("switch01", time.Now(), "", []byte(testHistogram), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	if len(scrape.Samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(scrape.Samples))
+	}
+
+	hist := scrape.Samples[0]
+	if hist.Name != "snmp_scrape_seconds" || hist.Count != 6 || hist.Value != 3.5 {
+		t.Errorf("unexpected histogram sample: %+v", hist)
+	}
+
+	if hist.Histogram == nil {
+		t.Fatal("expected histogram field")
+	}
+
+	// Buckets are represented by their midpoints; the empty (0.5, 1] bucket is
+	// skipped and +Inf observations are placed at the last finite bound.
+	wantValues := []float64{0.05, 0.3, 1}
+	wantCounts := []uint64{2, 3, 1}
+
+	if !reflect.DeepEqual(hist.Histogram.Values, wantValues) || !reflect.DeepEqual(hist.Histogram.Counts, wantCounts) {
+		t.Errorf("histogram = %v/%v, want %v/%v", hist.Histogram.Values, hist.Histogram.Counts, wantValues, wantCounts)
+	}
+
+	summary := scrape.Samples[1]
+	if summary.Count != 10 || summary.Value != 4 {
+		t.Errorf("unexpected summary sample: %+v", summary)
+	}
+
+	if summary.Quantiles["p50"] != 0.2 || summary.Quantiles["p99"] != 0.9 {
+		t.Errorf("unexpected quantiles: %v", summary.Quantiles)
+	}
+}
+
+func TestParseHistogramMode(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    HistogramMode
+		wantErr bool
+	}{
+		{in: "", want: HistogramModeFlattened},
+		{in: "flattened", want: HistogramModeFlattened},
+		{in: "native", want: HistogramModeNative},
+		{in: "exponential", wantErr: true},
+	} {
+		got, err := ParseHistogramMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHistogramMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseHistogramMode(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+const testOpenMetrics = `# TYPE ifInOctets counter
+# HELP ifInOctets The total number of octets received on the interface.
+ifInOctets_total{ifIndex="1",ifDescr="Gi0/1"} 1000 # {trace_id="abc"} 12 1700000000.5
+ifInOctets_created{ifIndex="1",ifDescr="Gi0/1"} 1700000000
+# TYPE snmp_scrape_seconds histogram
+snmp_scrape_seconds_bucket{le="0.5"} 3
+snmp_scrape_seconds_bucket{le="+Inf"} 4
+snmp_scrape_seconds_sum 1.5
+snmp_scrape_seconds_count 4
+snmp_scrape_seconds_created 1690000000
+# TYPE sysDescr info
+sysDescr_info{sysDescr="Cisco IOS"} 1
+# EOF
+`
+
+func TestTransformer_OpenMetrics(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+
+	scrape, err := transformer.TransformMetrics("switch01", time.Now(), "application/openmetrics-text; version=1.0.0; charset=utf-8", []byte(testOpenMetrics), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	samples := make(map[string]Sample)
+	for _, s := range scrape.Samples {
+		samples[s.Name+s.Labels["le"]] = s
+	}
+
+	counter, ok := samples["ifInOctets_total"]
+	if !ok || counter.Type != "counter" || counter.Value != 1000 || counter.Labels["ifDescr"] != "Gi0/1" {
+		t.Fatalf("unexpected counter sample: %+v", counter)
+	}
+
+	if counter.Created == nil || !counter.Created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("counter created = %v", counter.Created)
+	}
+
+	if counter.Exemplar == nil || counter.Exemplar.Value != 12 || counter.Exemplar.Labels["trace_id"] != "abc" {
+		t.Fatalf("unexpected exemplar: %+v", counter.Exemplar)
+	}
+
+	if counter.Exemplar.Timestamp == nil || !counter.Exemplar.Timestamp.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("exemplar timestamp = %v", counter.Exemplar.Timestamp)
+	}
+
+	if s := samples["snmp_scrape_seconds_bucket0.5"]; s.Value != 3 {
+		t.Errorf("0.5 bucket = %v, want 3", s.Value)
+	}
+
+	if s := samples["snmp_scrape_seconds_count"]; s.Value != 4 || s.Created == nil {
+		t.Errorf("unexpected histogram count sample: %+v", s)
+	}
+
+	if s, ok := samples["sysDescr"]; !ok || s.Type != "gauge" || s.Labels["sysDescr"] != "Cisco IOS" {
+		t.Errorf("unexpected info sample: %+v", s)
+	}
+}
+
+func TestParseFamilies_CounterNames(t *testing.T) {
+	formats := []struct {
+		contentType string
+		data        string
+	}{
+		{contentType: "text/plain; version=0.0.4", data: "# TYPE ifHCInOctets_total counter\nifHCInOctets_total 1\n"},
+		{contentType: "application/openmetrics-text; version=1.0.0", data: "# TYPE ifHCInOctets counter\nifHCInOctets_total 1\n# EOF\n"},
+		{contentType: "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", data: protoCounter(t)},
+	}
+
+	for _, f := range formats {
+		families, err := ParseFamilies(f.contentType, []byte(f.data))
+		if err != nil {
+			t.Fatalf("ParseFamilies(%s) error = %v", f.contentType, err)
+		}
+
+		family, ok := families["ifHCInOctets_total"]
+		if !ok || family.GetName() != "ifHCInOctets_total" {
+			t.Errorf("ParseFamilies(%s) = %v, want the counter named ifHCInOctets_total", f.contentType, families)
+		}
+	}
+}
+
+// protoCounter encodes a counter family named after its samples as
+// delimited protobuf.
+func protoCounter(t *testing.T) string {
+	t.Helper()
+
+	var parser expfmt.TextParser
+
+	families, err := parser.TextToMetricFamilies(strings.NewReader("# TYPE ifHCInOctets_total counter\nifHCInOctets_total 1\n"))
+	if err != nil {
+		t.Fatalf("parsing counter: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeProtoDelim)).Encode(families["ifHCInOctets_total"]); err != nil {
+		t.Fatalf("encoding counter: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestTransformer_OpenMetricsErrors(t *testing.T) {
+	transformer := NewTransformer("collector", "1.0.0")
+
+	for name, input := range map[string]string{
+		"missing EOF":       "# TYPE up gauge\nup 1\n",
+		"content after EOF": "up 1\n# EOF\nup 2\n",
+		"unknown type":      "# TYPE up widget\n# EOF\n",
+		"bad label set":     "up{job=unquoted} 1\n# EOF\n",
+	} {
+		if _, err := transformer.TransformMetrics("switch01", time.Now(), "application/openmetrics-text", []byte(input), nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTransformer_Protobuf(t *testing.T) {
+	var parser expfmt.TextParser
+
+	families, err := parser.TextToMetricFamilies(strings.NewReader(testMetrics))
+	if err != nil {
+		t.Fatalf("parsing test metrics: %v", err)
+	}
+
+	format := expfmt.NewFormat(expfmt.TypeProtoDelim)
+
+	var buf bytes.Buffer
+
+	encoder := expfmt.NewEncoder(&buf, format)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			t.Fatalf("encoding: %v", err)
+		}
+	}
+
+	transformer := NewTransformer("collector", "1.0.0")
+
+	scrape, err := transformer.TransformMetrics("switch01", time.Now(), string(format), buf.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("TransformMetrics() error = %v", err)
+	}
+
+	// NaN samples are dropped as in the text format.
+	if len(scrape.Samples) != 3 {
+		t.Errorf("expected 3 samples, got %d", len(scrape.Samples))
+	}
+}
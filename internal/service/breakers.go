@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/breaker"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/exporter"
+)
+
+// Circuit breaker scopes used in logs and metrics.
+const (
+	breakerScopeExporter = "exporter"
+	breakerScopeDevice   = "device"
+)
+
+// newBreakers creates the circuit breakers of a scope, reporting their
+// changes of state in logs and metrics.
+func (s *Service) newBreakers(scope string, cfg breaker.Config) *breaker.Set {
+	return breaker.New(cfg, breaker.WithObserver(func(key string, from, to breaker.State) {
+		s.metrics.BreakerTransitions.WithLabelValues(scope, to.String()).Inc()
+
+		if to == breaker.Closed {
+			s.metrics.BreakerState.DeleteLabelValues(scope, key)
+		} else {
+			s.metrics.BreakerState.WithLabelValues(scope, key).Set(float64(to))
+		}
+
+		log := s.logger.Info
+		if to == breaker.Open {
+			log = s.logger.Warn
+		}
+
+		log("circuit breaker "+to.String(),
+			"scope", scope,
+			"key", key,
+			"previous", from.String(),
+		)
+	}))
+}
+
+// recordDevice reports the outcome of fetching a device's metrics to its
+// breaker. Collections that were cancelled, or skipped because the exporter's
+// breaker is open, say nothing about the device.
+func (s *Service) recordDevice(id string, err error) {
+	switch {
+	case err == nil:
+		s.deviceBreakers.Success(id)
+	case errors.Is(err, context.Canceled), errors.Is(err, breaker.ErrOpen):
+		s.deviceBreakers.Release(id)
+	default:
+		s.deviceBreakers.Failure(id)
+	}
+}
+
+// recordExporter reports the outcome of an exporter request to the
+// exporter's breaker and to the health checker. An error status is an answer
+// from the exporter about the device, so it counts as a success: only
+// transport failures say the exporter itself is unreachable.
+func (s *Service) recordExporter(baseURL string, err error) {
+	var exporterErr *exporter.Error
+
+	switch {
+	case err == nil, errors.As(err, &exporterErr) && exporterErr.StatusCode != 0:
+		s.exporterBreakers.Success(baseURL)
+		s.health.ReportExporter(baseURL, nil)
+	case errors.Is(err, context.Canceled):
+		s.exporterBreakers.Release(baseURL)
+	default:
+		s.exporterBreakers.Failure(baseURL)
+		s.health.ReportExporter(baseURL, err)
+	}
+}
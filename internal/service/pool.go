@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// pool limits the number of concurrent operations. Its size can change while
+// it is in use: growing it admits waiting operations at once, shrinking it
+// lets running operations finish and holds back new ones until enough have.
+type pool struct {
+	mu    sync.Mutex
+	size  int
+	inUse int
+	// freed is closed, and replaced, whenever a slot may have become free.
+	freed chan struct{}
+}
+
+// newPool creates a pool of the given size.
+func newPool(size int) *pool {
+	return &pool{size: size, freed: make(chan struct{})}
+}
+
+// acquire waits for a free slot.
+func (p *pool) acquire(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+
+		if p.inUse < p.size {
+			p.inUse++
+			p.mu.Unlock()
+
+			return nil
+		}
+
+		freed := p.freed
+		p.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a slot taken by acquire.
+func (p *pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inUse--
+	p.notify()
+}
+
+// resize changes the number of slots.
+func (p *pool) resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.size = size
+	p.notify()
+}
+
+// usage returns the slots in use and the size of the pool.
+func (p *pool) usage() (inUse, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.inUse, p.size
+}
+
+// notify wakes operations waiting for a slot. p.mu must be held.
+func (p *pool) notify() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool_Resize(t *testing.T) {
+	p := newPool(1)
+	ctx := context.Background()
+
+	if err := p.acquire(ctx); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	acquired := make(chan struct{})
+
+	go func() {
+		if err := p.acquire(ctx); err == nil {
+			close(acquired)
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire() succeeded on a full pool")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.resize(2)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire() still waiting after the pool grew")
+	}
+
+	// Shrinking keeps both running operations; a new one waits until the
+	// pool is below its new size.
+	p.resize(1)
+
+	if inUse, size := p.usage(); inUse != 2 || size != 1 {
+		t.Errorf("usage() = %d, %d, want 2, 1", inUse, size)
+	}
+
+	p.release()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.acquire(waitCtx); err == nil {
+		t.Fatal("acquire() succeeded while the shrunk pool was full")
+	}
+
+	p.release()
+
+	if err := p.acquire(ctx); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+}
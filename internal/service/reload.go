@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/config"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/telemetry"
+)
+
+// Reload loads the bootstrap configuration from path and applies the
+// settings that can change while running: concurrency, timing, backoff,
+// circuit breakers and the Elasticsearch connection. Other changed settings
+// are logged and only take effect after a restart. An invalid file leaves
+// the running configuration untouched.
+//
+// Collections in flight finish with the settings they started with; pools
+// that shrink admit new work only once enough of it has finished.
+func (s *Service) Reload(path string) error {
+	next, err := config.LoadBootstrapConfiguration(path)
+	if err == nil {
+		err = s.apply(next)
+	}
+
+	outcome := telemetry.OutcomeSuccess
+	if err != nil {
+		outcome = telemetry.OutcomeFailure
+	}
+
+	s.metrics.ConfigReloads.WithLabelValues(outcome).Inc()
+
+	return err
+}
+
+// apply switches to the reloadable settings of a validated configuration.
+func (s *Service) apply(next *config.BootstrapConfiguration) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	current := s.config()
+
+	applied := *current
+	applied.Concurrency = next.Concurrency
+	applied.Timing = next.Timing
+	applied.Backoff = next.Backoff
+	applied.Breakers = next.Breakers
+	applied.Elasticsearch.Hosts = next.Elasticsearch.Hosts
+	applied.Elasticsearch.CertificateHash = next.Elasticsearch.CertificateHash
+	applied.Elasticsearch.Auth = next.Elasticsearch.Auth
+
+	if ignored := changedSections(&applied, next); len(ignored) > 0 {
+		s.logger.Warn("configuration changes need a restart to take effect",
+			"sections", strings.Join(ignored, ","),
+		)
+	}
+
+	if connectionChanged(&current.Elasticsearch, &applied.Elasticsearch) {
+		if err := s.esTransport.Reload(elasticsearchConfig(&applied.Elasticsearch)); err != nil {
+			return fmt.Errorf("reconnecting to elasticsearch: %w", err)
+		}
+
+		s.logger.Info("reconnected to elasticsearch", "hosts", applied.Elasticsearch.Hosts)
+	}
+
+	s.exporterBreakers.SetConfig(applied.Breakers.BreakerConfig())
+	s.deviceBreakers.SetConfig(applied.Breakers.BreakerConfig())
+
+	s.workerPool.resize(applied.Concurrency.MaxScrapers)
+	s.writerPool.resize(applied.Concurrency.MaxWriters)
+
+	if applied.Timing.ConfigReloadInterval != current.Timing.ConfigReloadInterval {
+		s.configRefresh.Reset(applied.Timing.ConfigReloadInterval.Duration)
+	}
+
+	s.cfg.Store(&applied)
+
+	s.logger.Info("reloaded configuration",
+		"max_scrapers", applied.Concurrency.MaxScrapers,
+		"max_writers", applied.Concurrency.MaxWriters,
+		"scrape_timeout", applied.Timing.ScrapeTimeout.Duration,
+		"config_reload_interval", applied.Timing.ConfigReloadInterval.Duration,
+	)
+
+	return nil
+}
+
+// connectionChanged reports whether the Elasticsearch connection settings differ.
+func connectionChanged(a, b *config.ElasticsearchSettings) bool {
+	return !slices.Equal(a.Hosts, b.Hosts) ||
+		a.CertificateHash != b.CertificateHash ||
+		a.Auth != b.Auth
+}
+
+// changedSections returns the configuration sections, by TOML key, that
+// differ between two configurations.
+func changedSections(a, b *config.BootstrapConfiguration) []string {
+	var changed []string
+
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			key, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("toml"), ",")
+			changed = append(changed, key)
+		}
+	}
+
+	return changed
+}
@@ -6,44 +6,328 @@ import (
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	esapi "github.com/elastic/go-elasticsearch/v8"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/breaker"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cluster"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/config"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/discovery"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/exporter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/filter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/health"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/rate"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/scheduler"
 	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/sink"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/spool"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/telemetry"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/trap"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
+// Error classes reported in scrape metrics.
+const (
+	errorClassNone        = ""
+	errorClassTimeout     = "timeout"
+	errorClassCanceled    = "canceled"
+	errorClassExporter    = "exporter"
+	errorClassSNMP        = "snmp"
+	errorClassParse       = "parse_error"
+	errorClassStore       = "store"
+	errorClassUnavailable = "elasticsearch_unavailable"
+	errorClassMapping     = "mapping_rejected"
+	errorClassBreaker     = "circuit_open"
+	errorClassUnknown     = "unknown"
+)
+
+// stageError records which collection stage an error came from.
+type stageError struct {
+	class string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// counterWidths returns the width of the device's counters by sample name.
+// The expositions do not say how wide a counter is: native module counters
+// take theirs from the MIB, and the device's counter_bits add to or override
+// them. Counters of unknown width read any decrease as a reset.
+func counterWidths(cfg *elasticsearch.Config) map[string]int {
+	widths := map[string]int{}
+	if cfg.CollectorSettings.Backend == elasticsearch.BackendNative {
+		widths = snmp.CounterWidths(cfg.CollectorSettings.Modules)
+	}
+
+	for name, bits := range cfg.CollectorSettings.CounterBits {
+		widths[name] = bits
+	}
+
+	return widths
+}
+
+// errorClass returns the class of a collection error for metrics. Exporter
+// errors are classed by their kind. The Elasticsearch classes apply when the
+// spool is disabled and documents are sent as they are written; the spool
+// queues documents, and its failures reach the writer observer and the spool
+// metrics instead.
+func errorClass(err error) string {
+	var (
+		se          *stageError
+		exporterErr *exporter.Error
+		parseErr    *schema.ParseError
+		unavailable *elasticsearch.UnavailableError
+		itemErr     *elasticsearch.ItemError
+	)
+
+	switch {
+	case err == nil:
+		return errorClassNone
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return errorClassCanceled
+	case errors.As(err, &exporterErr):
+		return string(exporterErr.Kind)
+	case errors.As(err, &parseErr):
+		return errorClassParse
+	case errors.As(err, &unavailable):
+		return errorClassUnavailable
+	case errors.As(err, &itemErr) && itemErr.MappingRejected():
+		return errorClassMapping
+	case errors.As(err, &se):
+		return se.class
+	default:
+		return errorClassUnknown
+	}
+}
+
+// retryable reports whether a failed collection attempt may succeed if
+// repeated. Exporter and Elasticsearch errors tell themselves; of the others
+// only timeouts and SNMP polling failures are transient, so that a bad module
+// or a rejected document is not retried until the scrape timeout.
+func retryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	switch errorClass(err) {
+	case errorClassTimeout, errorClassSNMP:
+		return true
+	default:
+		return false
+	}
+}
+
 // Service handles the main application logic.
 type Service struct {
-	cfg           *config.BootstrapConfiguration
+	cfg           atomic.Pointer[config.BootstrapConfiguration]
+	reloadMu      sync.Mutex
 	esClient      *elasticsearch.Client
+	esTransport   *elasticsearch.ReloadableTransport
+	writer        elasticsearch.Writer
 	transformer   *schema.Transformer
+	documentMode  schema.DocumentMode
+	histogramMode schema.HistogramMode
+	indexPrefix   string
+	rates         *rate.Calculator
 	logger        *slog.Logger
 	configCache   *cache.ConfigCache
 	configRefresh *time.Ticker
-	workerPool    chan struct{}
-	writerPool    chan struct{}
-	wg            sync.WaitGroup
+	scheduler     *scheduler.Scheduler
+	metrics       *telemetry.Metrics
+	telemetry     *telemetry.Server
+	health        *health.Checker
+	transport     http.RoundTripper
+	probes        map[string]exporter.Probe
+	snmp          *snmp.Collector
+	traps         *trap.Receiver
+	spool         *spool.Spool
+	cluster       *cluster.Coordinator
+	workerPool    *pool
+	writerPool    *pool
+	// exporterBreakers and deviceBreakers skip collections from exporters,
+	// keyed by base URL, and devices, keyed by ID, that keep failing.
+	exporterBreakers *breaker.Set
+	deviceBreakers   *breaker.Set
+	// statusWriter is nil unless status documents are enabled.
+	statusWriter *elasticsearch.StatusWriter
+	statuses     *statusTracker
+	wg           sync.WaitGroup
 }
 
 // NewService creates a new service instance.
 func NewService(cfg *config.BootstrapConfiguration, logger *slog.Logger) (*Service, error) {
-	// Create Elasticsearch client configuration
+	// Create Elasticsearch API client; its connection settings can be
+	// reloaded without replacing it.
+	esclient, esTransport, err := elasticsearch.NewReloadableClient(elasticsearchConfig(&cfg.Elasticsearch))
+	if err != nil {
+		return nil, fmt.Errorf("creating elasticsearch client: %w", err)
+	}
+
+	// Create our Elasticsearch client wrapper
+	esWrapper := elasticsearch.NewClient(esclient, cfg.Elasticsearch.Index)
+
+	writerConfig := writerConfiguration(&cfg.Elasticsearch.Output)
+
+	documentMode, err := schema.ParseDocumentMode(cfg.Elasticsearch.Output.DocumentMode)
+	if err != nil {
+		return nil, fmt.Errorf("parsing document mode: %w", err)
+	}
+
+	histogramMode, err := schema.ParseHistogramMode(cfg.Elasticsearch.Output.HistogramMode)
+	if err != nil {
+		return nil, fmt.Errorf("parsing histogram mode: %w", err)
+	}
+
+	// Create service components
+	transformer := schema.NewTransformer(cfg.Instance.Name, "1.0.0", schema.WithHistogramMode(histogramMode))
+	configCache := cache.New(cfg.Timing.ConfigReloadInterval.Duration)
+	configRefresh := time.NewTicker(cfg.Timing.ConfigReloadInterval.Duration)
+	workerPool := newPool(cfg.Concurrency.MaxScrapers)
+	writerPool := newPool(cfg.Concurrency.MaxWriters)
+	metrics := telemetry.NewMetrics()
+	checker := health.New(health.Config{
+		UnavailableThreshold: cfg.Health.UnavailableThreshold.Duration,
+		StallThreshold:       cfg.Health.StallThreshold.Duration,
+	})
+
+	s := &Service{
+		esClient:      esWrapper,
+		esTransport:   esTransport,
+		transformer:   transformer,
+		documentMode:  documentMode,
+		histogramMode: histogramMode,
+		rates:         rate.New(),
+		probes:        cfg.Probes(),
+		snmp:          snmp.New(logger),
+		logger:        logger,
+		configCache:   configCache,
+		configRefresh: configRefresh,
+		metrics:       metrics,
+		health:        checker,
+		transport:     promhttp.InstrumentRoundTripperCounter(metrics.ExporterRequests, http.DefaultTransport),
+		workerPool:    workerPool,
+		writerPool:    writerPool,
+	}
+
+	s.cfg.Store(cfg)
+
+	s.exporterBreakers = s.newBreakers(breakerScopeExporter, cfg.Breakers.BreakerConfig())
+	s.deviceBreakers = s.newBreakers(breakerScopeDevice, cfg.Breakers.BreakerConfig())
+
+	writer, err := elasticsearch.NewWriter(esclient, writerConfig, logger, elasticsearch.WithObserver(&writerObserver{s: s}))
+	if err != nil {
+		return nil, fmt.Errorf("creating metrics writer: %w", err)
+	}
+
+	// Without the spool documents are sent as they are written, so that a
+	// failed write fails, and may retry, the collection that made it.
+	s.writer = elasticsearch.SendWriter{ESWriter: writer}
+	s.indexPrefix = writerConfig.IndexPrefix
+
+	// With the spool enabled every document is written to disk first and
+	// sent on synchronously, so nothing is lost while Elasticsearch is down.
+	if cfg.Spool.Enabled {
+		sp, err := spool.Open(cfg.Spool.SpoolConfig(), logger)
+		if err != nil {
+			return nil, fmt.Errorf("opening spool: %w", err)
+		}
+
+		s.spool = sp
+		s.writer = spool.NewWriter(sp, writer, writerConfig.FlushInterval, logger)
+	}
+
+	if cfg.Status.Enabled {
+		statusWriter, err := elasticsearch.NewStatusWriter(esclient, cfg.Status.StatusIndex(), writerConfig.FlushInterval, logger)
+		if err != nil {
+			return nil, fmt.Errorf("creating status writer: %w", err)
+		}
+
+		s.statusWriter = statusWriter
+		s.statuses = newStatusTracker()
+	}
+
+	if len(cfg.Sinks) > 0 {
+		multi, err := s.newSinks(s.writer)
+		if err != nil {
+			return nil, fmt.Errorf("creating sinks: %w", err)
+		}
+
+		s.writer = multi
+	}
+
+	if cfg.Traps.Enabled {
+		receiver, err := trap.New(cfg.Traps.ReceiverConfig(), configCache, transformer, s.writer, logger,
+			trap.WithObserver(func(outcome string) {
+				metrics.Traps.WithLabelValues(outcome).Inc()
+			}))
+		if err != nil {
+			return nil, fmt.Errorf("creating trap receiver: %w", err)
+		}
+
+		s.traps = receiver
+	}
+
+	if cfg.Cluster.Enabled {
+		store := elasticsearch.NewMemberStore(esclient, cfg.Cluster.MembersIndex())
+
+		coordinator, err := cluster.New(cfg.Cluster.CoordinatorConfig(cfg.Instance.Name), store, logger)
+		if err != nil {
+			return nil, fmt.Errorf("creating cluster coordinator: %w", err)
+		}
+
+		s.cluster = coordinator
+	}
+
+	s.scheduler = scheduler.New(s.collectDevice, scheduler.Config{
+		DefaultInterval: scheduler.DefaultInterval,
+		Jitter:          scheduler.DefaultJitter,
+	}, logger)
+
+	s.health.WatchProgress(s.scheduler.Stalled)
+
+	s.registerGauges()
+
+	if cfg.Metrics.Port > 0 {
+		s.telemetry = telemetry.NewServer(cfg.Metrics.Port, cfg.Metrics.Path, metrics, logger)
+		s.telemetry.Handle("/healthz", s.health.LivenessHandler())
+		s.telemetry.Handle("/readyz", s.health.ReadinessHandler())
+	}
+
+	return s, nil
+}
+
+// elasticsearchConfig builds the Elasticsearch client configuration from the
+// connection settings.
+func elasticsearchConfig(es *config.ElasticsearchSettings) esapi.Config {
 	escfg := esapi.Config{
-		Addresses: cfg.Elasticsearch.Hosts,
+		Addresses: es.Hosts,
 	}
 
 	// Configure TLS if certificate hash is provided
-	if cfg.Elasticsearch.CertificateHash != "" {
+	if es.CertificateHash != "" {
+		certificateHash := es.CertificateHash
+
 		transport := &http.Transport{
 			TLSClientConfig: &tls.Config{
 				MinVersion: tls.VersionTLS12, // Minimum TLS 1.2 for security
@@ -53,9 +337,9 @@ func NewService(cfg *config.BootstrapConfiguration, logger *slog.Logger) (*Servi
 					certHashHex := hex.EncodeToString(certHash[:])
 
 					// Compare with configured hash
-					if certHashHex != cfg.Elasticsearch.CertificateHash {
+					if certHashHex != certificateHash {
 						return fmt.Errorf("certificate hash mismatch: got %s, want %s",
-							certHashHex, cfg.Elasticsearch.CertificateHash)
+							certHashHex, certificateHash)
 					}
 					return nil
 				},
@@ -65,232 +349,803 @@ func NewService(cfg *config.BootstrapConfiguration, logger *slog.Logger) (*Servi
 	}
 
 	// Configure authentication if provided
-	if cfg.Elasticsearch.Auth.Username != "" {
-		escfg.Username = cfg.Elasticsearch.Auth.Username
-		escfg.Password = cfg.Elasticsearch.Auth.Password
+	if es.Auth.Username != "" {
+		escfg.Username = es.Auth.Username
+		escfg.Password = es.Auth.Password
+	}
+
+	return escfg
+}
+
+// config returns the current bootstrap configuration.
+func (s *Service) config() *config.BootstrapConfiguration {
+	return s.cfg.Load()
+}
+
+// writerConfiguration builds the bulk writer configuration, applying defaults
+// for unset output settings.
+func writerConfiguration(out *config.OutputSettings) elasticsearch.WriterConfig {
+	wc := elasticsearch.WriterConfig{
+		IndexPrefix:   out.IndexPrefix,
+		BatchSize:     out.BatchSize,
+		FlushInterval: out.FlushInterval.Duration,
+		NumWorkers:    out.Workers,
+	}
+
+	if wc.IndexPrefix == "" {
+		wc.IndexPrefix = config.DefaultMetricsIndexPrefix
+	}
+
+	if wc.BatchSize == 0 {
+		wc.BatchSize = config.DefaultBatchSize
+	}
+
+	if wc.FlushInterval == 0 {
+		wc.FlushInterval = config.DefaultFlushInterval
+	}
+
+	if wc.NumWorkers == 0 {
+		wc.NumWorkers = config.DefaultBulkWorkers
 	}
 
-	// Create Elasticsearch API client
-	esclient, err := esapi.NewClient(escfg)
+	return wc
+}
+
+// newSinks fans documents out to Elasticsearch, through writer, and the
+// configured sinks. Elasticsearch is the primary output: its failures fail
+// the write, whatever the other sinks do.
+func (s *Service) newSinks(writer elasticsearch.Writer) (*sink.Multi, error) {
+	outputs := []sink.Output{{Name: sink.TypeElasticsearch, Sink: writer, Primary: true}}
+
+	sinks := s.config().Sinks
+
+	for i := range sinks {
+		settings := &sinks[i]
+
+		f, err := settings.Filter()
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", settings.Name, err)
+		}
+
+		if settings.Type == sink.TypeElasticsearch {
+			outputs[0].Name = settings.Name
+			outputs[0].Filter = f
+
+			continue
+		}
+
+		var out sink.Sink
+
+		switch settings.Type {
+		case sink.TypeRemoteWrite:
+			out, err = sink.NewRemoteWrite(settings.RemoteWriteConfig())
+		case sink.TypeFile:
+			out, err = sink.NewFile(settings.FileConfig())
+		case sink.TypeStdout:
+			out = sink.NewStdout()
+		default:
+			err = fmt.Errorf("unknown type: %s", settings.Type)
+		}
+
+		if err != nil {
+			for _, o := range outputs[1:] {
+				o.Sink.Close()
+			}
+
+			return nil, fmt.Errorf("sink %s: %w", settings.Name, err)
+		}
+
+		outputs = append(outputs, sink.Output{Name: settings.Name, Sink: out, Filter: f, QueueSize: settings.QueueSize})
+	}
+
+	return sink.NewMulti(outputs, s.logger, sink.WithObserver(func(name string, documents int, err error) {
+		if errors.Is(err, sink.ErrDropped) {
+			s.metrics.SinkDrops.WithLabelValues(name).Add(float64(documents))
+			return
+		}
+
+		outcome := telemetry.OutcomeSuccess
+		if err != nil {
+			outcome = telemetry.OutcomeFailure
+		}
+
+		s.metrics.SinkWrites.WithLabelValues(name, outcome).Add(float64(documents))
+	})), nil
+}
+
+// writerObserver feeds bulk indexing outcomes into metrics and health.
+type writerObserver struct {
+	s *Service
+}
+
+// Flushed implements elasticsearch.WriterObserver.
+func (o *writerObserver) Flushed(duration time.Duration, err error) {
+	o.s.metrics.WriteDuration.Observe(duration.Seconds())
+	o.s.health.ReportElasticsearch(err)
+
 	if err != nil {
-		return nil, fmt.Errorf("creating elasticsearch client: %w", err)
+		o.s.metrics.WriteErrors.Inc()
 	}
+}
 
-	// Create our Elasticsearch client wrapper
-	esWrapper := elasticsearch.NewClient(esclient, cfg.Elasticsearch.Index)
+// ItemFailed implements elasticsearch.WriterObserver.
+func (o *writerObserver) ItemFailed(_ *elasticsearch.ItemError) {
+	o.s.metrics.WriteErrors.Inc()
+}
 
-	// Create service components
-	transformer := schema.NewTransformer(cfg.Instance.Name, "1.0.0")
-	configCache := cache.New(cfg.Timing.ConfigReloadInterval.Duration)
-	configRefresh := time.NewTicker(cfg.Timing.ConfigReloadInterval.Duration)
-	workerPool := make(chan struct{}, cfg.Concurrency.MaxScrapers)
-	writerPool := make(chan struct{}, cfg.Concurrency.MaxWriters)
+// registerGauges exposes pool saturation and configuration state as metrics.
+func (s *Service) registerGauges() {
+	s.metrics.GaugeFunc("worker_pool_in_use", "Scrape workers currently busy.", func() float64 {
+		inUse, _ := s.workerPool.usage()
+		return float64(inUse)
+	})
+	s.metrics.GaugeFunc("worker_pool_size", "Maximum number of concurrent scrape workers.", func() float64 {
+		_, size := s.workerPool.usage()
+		return float64(size)
+	})
+	s.metrics.GaugeFunc("writer_pool_in_use", "Writers currently busy.", func() float64 {
+		inUse, _ := s.writerPool.usage()
+		return float64(inUse)
+	})
+	s.metrics.GaugeFunc("writer_pool_size", "Maximum number of concurrent writers.", func() float64 {
+		_, size := s.writerPool.usage()
+		return float64(size)
+	})
+	s.metrics.GaugeFunc("config_cache_age_seconds", "Seconds since device configurations were last loaded.", func() float64 {
+		updated := s.configCache.LastUpdated()
+		if updated.IsZero() {
+			return 0
+		}
 
-	return &Service{
-		cfg:           cfg,
-		esClient:      esWrapper,
-		transformer:   transformer,
-		logger:        logger,
-		configCache:   configCache,
-		configRefresh: configRefresh,
-		workerPool:    workerPool,
-		writerPool:    writerPool,
-	}, nil
+		return time.Since(updated).Seconds()
+	})
+	s.metrics.GaugeFunc("configured_devices", "Device configurations held in the cache.", func() float64 {
+		return float64(s.configCache.Count())
+	})
+	s.metrics.GaugeFunc("cluster_members", "Live getter instances sharing the device fleet; 0 when clustering is disabled.", func() float64 {
+		if s.cluster == nil {
+			return 0
+		}
+
+		return float64(len(s.cluster.Members()))
+	})
+	if s.spool != nil {
+		s.registerSpoolMetrics()
+	}
+
+	s.metrics.GaugeFunc("scheduled_devices", "Enabled devices with an active collection schedule.", func() float64 {
+		return float64(s.scheduler.Count())
+	})
 }
 
-// Start begins the service operation.
+// registerSpoolMetrics exposes the spooled backlog as metrics.
+func (s *Service) registerSpoolMetrics() {
+	s.metrics.GaugeFunc("spool_backlog_documents", "Documents spooled on disk waiting to be indexed.", func() float64 {
+		return float64(s.spool.Stats().Documents)
+	})
+	s.metrics.GaugeFunc("spool_backlog_bytes", "Size of the spool segment files.", func() float64 {
+		return float64(s.spool.Stats().Bytes)
+	})
+	s.metrics.GaugeFunc("spool_backlog_segments", "Spool segment files waiting to be indexed.", func() float64 {
+		return float64(s.spool.Stats().Segments)
+	})
+	s.metrics.GaugeFunc("spool_oldest_entry_age_seconds", "Age of the oldest spooled document; 0 when the spool is empty.", func() float64 {
+		oldest := s.spool.Stats().Oldest
+		if oldest.IsZero() {
+			return 0
+		}
+
+		return time.Since(oldest).Seconds()
+	})
+	s.metrics.CounterFunc("spool_dropped_documents_total", "Spooled documents discarded by the size and age caps.", func() float64 {
+		return float64(s.spool.Stats().Dropped)
+	})
+}
+
+// Start runs the service until ctx is cancelled, then shuts it down,
+// draining collections and pending writes (see shutdown). The service is
+// shut down as well when it fails to start.
 func (s *Service) Start(ctx context.Context) error {
+	cfg := s.config()
+
+	// Background tasks stop with this context, also when Start fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	s.logger.Info("starting service",
-		"instance", s.cfg.Instance.Name,
-		"elasticsearch_hosts", s.cfg.Elasticsearch.Hosts,
-		"max_scrapers", s.cfg.Concurrency.MaxScrapers,
-		"max_writers", s.cfg.Concurrency.MaxWriters,
+		"instance", cfg.Instance.Name,
+		"elasticsearch_hosts", cfg.Elasticsearch.Hosts,
+		"max_scrapers", cfg.Concurrency.MaxScrapers,
+		"max_writers", cfg.Concurrency.MaxWriters,
 	)
 
+	if s.telemetry != nil {
+		go func() {
+			if err := s.telemetry.Run(ctx); err != nil {
+				s.logger.Error("running telemetry server", "error", err)
+			}
+		}()
+	}
+
+	// Native histograms need an explicit mapping; without it they are indexed
+	// as plain arrays, so carry on if the template cannot be installed.
+	if s.histogramMode == schema.HistogramModeNative {
+		if err := s.esClient.InstallMetricsTemplate(ctx, s.indexPrefix); err != nil {
+			s.logger.Warn("installing metrics index template", "error", err)
+		}
+	}
+
+	if s.statusWriter != nil {
+		if err := s.esClient.InstallStatusTemplate(ctx, cfg.Status.StatusIndex()); err != nil {
+			s.logger.Warn("installing status index template", "error", err)
+		}
+	}
+
+	// Join the cluster first. The configurations are loaded below without
+	// waiting for it: until the membership has settled, Owns reports no
+	// device as ours, so devices are scheduled by the rebalance that follows.
+	var rebalance <-chan struct{}
+
+	if s.cluster != nil {
+		rebalance = s.cluster.Changed()
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+
+			if err := s.cluster.Run(ctx); err != nil {
+				s.logger.Error("running cluster coordinator", "error", err)
+			}
+		}()
+	}
+
 	// Initial configuration load
 	if err := s.refreshConfigurations(ctx); err != nil {
+		cancel()
+		s.shutdown()
+
 		return fmt.Errorf("initial configuration load failed: %w", err)
 	}
 
+	// Traps are resolved against the configuration cache, so start
+	// receiving once it has been loaded.
+	if s.traps != nil {
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+
+			if err := s.traps.Run(ctx); err != nil {
+				s.logger.Error("running trap receiver", "error", err)
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.shutdown()
+			return nil
+		case <-rebalance:
+			s.rebalance(ctx)
+		case <-s.configRefresh.C:
+			if err := s.refreshConfigurations(ctx); err != nil {
+				s.logger.Error("refreshing configurations", "error", err)
+			}
+		}
+	}
+}
+
+// Close shuts down a service that was not started, such as after Discover,
+// flushing pending documents. Start shuts the service down itself.
+func (s *Service) Close() {
+	s.shutdown()
+}
+
+// shutdown stops scheduling collections and drains the service. Collections
+// in progress are given the shutdown timeout to finish before they are
+// cancelled; pending documents are then given as long again to be flushed.
+func (s *Service) shutdown() {
+	timeout := s.config().Timing.ShutdownTimeout.Duration
+	inProgress, _ := s.workerPool.usage()
+
+	s.logger.Info("shutting down service",
+		"collections_in_progress", inProgress,
+		"timeout", timeout,
+	)
+
+	s.configRefresh.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if abandoned := s.scheduler.Shutdown(ctx); abandoned > 0 {
+		s.logger.Warn("abandoned collections still running at the shutdown timeout",
+			"collections", abandoned,
+		)
+	}
+
+	// The trap receiver and cluster coordinator stop with the service
+	// context; wait for them so that no document is written after the
+	// writer is closed.
+	s.wg.Wait()
+
+	// Only hand the devices over once their collections have finished, so
+	// that no other instance polls them meanwhile.
+	if s.cluster != nil {
+		s.cluster.Leave()
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), timeout)
+	defer cancelFlush()
+
+	closed := make(chan error, 1)
+
 	go func() {
-		defer s.wg.Done()
-
-		for {
-			select {
-			case <-ctx.Done():
-				s.logger.Info("shutting down service")
-				s.configRefresh.Stop()
-				return
-			case <-s.configRefresh.C:
-				if err := s.refreshConfigurations(ctx); err != nil {
-					s.logger.Error("refreshing configurations", "error", err)
-				}
+		if s.statusWriter != nil {
+			if err := s.statusWriter.Close(); err != nil {
+				s.logger.Error("closing status writer", "error", err)
 			}
 		}
+
+		closed <- s.writer.Close()
 	}()
 
+	select {
+	case err := <-closed:
+		if err != nil {
+			s.logger.Error("closing metrics writer", "error", err)
+			return
+		}
+	case <-flushCtx.Done():
+		s.logger.Warn("abandoned pending documents still being flushed at the shutdown timeout")
+		return
+	}
+
+	if s.spool != nil {
+		if backlog := s.spool.Stats().Documents; backlog > 0 {
+			s.logger.Warn("documents left in spool for the next run", "documents", backlog)
+		}
+	}
+
+	s.logger.Info("service stopped")
+}
+
+// Discover sweeps the configured subnets and saves a disabled configuration
+// for every device found that is not configured yet.
+func (s *Service) Discover(ctx context.Context) error {
+	discoverer, err := discovery.New(s.config().Discovery.DiscoveryConfig(), s.snmp.Identify, s.logger)
+	if err != nil {
+		return fmt.Errorf("configuring discovery: %w", err)
+	}
+
+	devices, err := discoverer.Sweep(ctx)
+	if err != nil {
+		return fmt.Errorf("sweeping subnets: %w", err)
+	}
+
+	created, err := discoverer.Save(ctx, s.esClient, devices)
+	if err != nil {
+		return fmt.Errorf("saving discovered devices: %w", err)
+	}
+
+	s.logger.Info("discovery complete",
+		"found", len(devices),
+		"created", created,
+	)
+
 	return nil
 }
 
-// refreshConfigurations fetches and processes device configurations.
+// refreshConfigurations synchronises the cached device configurations with
+// Elasticsearch. Only configurations whose update time changed are fetched,
+// and only their devices are rescheduled.
 func (s *Service) refreshConfigurations(ctx context.Context) error {
-	// Check if cache is still valid
-	if !s.configCache.IsExpired() {
-		s.logger.Debug("using cached configurations",
+	versions, err := s.esClient.ListConfigVersions(ctx)
+	s.health.ReportElasticsearch(err)
+
+	if err != nil {
+		return fmt.Errorf("listing configuration versions: %w", err)
+	}
+
+	var fetched []elasticsearch.Config
+
+	if stale := s.configCache.Stale(versions); len(stale) > 0 {
+		fetched, err = s.esClient.GetConfigs(ctx, stale)
+		s.health.ReportElasticsearch(err)
+
+		if err != nil {
+			return fmt.Errorf("fetching configurations: %w", err)
+		}
+	}
+
+	s.health.ConfigLoaded()
+
+	diff := s.configCache.Apply(versions, fetched)
+	if diff.Empty() {
+		s.logger.Debug("configurations unchanged",
 			"count", s.configCache.Count(),
-			"last_updated", s.configCache.LastUpdated(),
 		)
+
 		return nil
 	}
 
-	// Fetch configurations from Elasticsearch
-	configs, err := s.esClient.ListConfigs(ctx)
-	if err != nil {
-		return fmt.Errorf("listing configurations: %w", err)
+	s.logger.Info("synchronised configurations",
+		"count", s.configCache.Count(),
+		"added", len(diff.Added),
+		"changed", len(diff.Changed),
+		"disabled", len(diff.Disabled),
+		"removed", len(diff.Removed),
+	)
+
+	// Reschedule changed devices; unchanged devices keep their timers
+	s.scheduler.Apply(ctx, s.owned(diff))
+
+	// Drop counter baselines and health of devices and exporters that are
+	// no longer configured
+	configs := s.configCache.GetAll()
+
+	deviceIDs := make(map[string]bool, len(configs))
+	exporters := make(map[string]bool)
+
+	for i := range configs {
+		deviceIDs[configs[i].ID] = true
+
+		if configs[i].CollectorSettings.Backend != elasticsearch.BackendNative {
+			exporters[exporterBaseURL(&configs[i])] = true
+		}
+	}
+
+	s.rates.Retain(deviceIDs)
+	s.deviceBreakers.Retain(deviceIDs)
+	s.exporterBreakers.Retain(exporters)
+	s.health.RetainExporters(exporters)
+
+	if s.statuses != nil {
+		s.statuses.retain(deviceIDs)
 	}
 
-	s.logger.Info("fetched configurations",
-		"count", len(configs),
+	s.logger.Info("scheduled devices",
+		"count", s.scheduler.Count(),
 	)
 
-	// Update cache
-	s.configCache.SetAll(configs)
+	return nil
+}
 
-	// Process each configuration
-	for i := range configs {
-		cfg := configs[i] // Create a new variable to avoid aliasing
-		if !cfg.Enabled {
-			s.logger.Debug("skipping disabled device",
-				"id", cfg.ID,
-				"name", cfg.Name,
-			)
-			continue
+// owned restricts a configuration diff to the devices this instance polls;
+// devices owned by other cluster members are unscheduled.
+func (s *Service) owned(diff cache.Diff) cache.Diff {
+	if s.cluster == nil {
+		return diff
+	}
+
+	owned := cache.Diff{Disabled: diff.Disabled, Removed: diff.Removed}
+
+	for _, cfg := range diff.Added {
+		if s.cluster.Owns(cfg.ID) {
+			owned.Added = append(owned.Added, cfg)
+		} else {
+			owned.Removed = append(owned.Removed, cfg.ID)
 		}
+	}
 
-		if err := s.processConfiguration(ctx, &cfg); err != nil {
-			s.logger.Error("Failed to process configuration",
-				"error", err,
-				"id", cfg.ID)
-			continue
+	for _, cfg := range diff.Changed {
+		if s.cluster.Owns(cfg.ID) {
+			owned.Changed = append(owned.Changed, cfg)
+		} else {
+			owned.Removed = append(owned.Removed, cfg.ID)
 		}
 	}
 
-	return nil
+	return owned
+}
+
+// rebalance reschedules devices after the cluster membership changed.
+// Devices that stay with this instance keep their timers.
+func (s *Service) rebalance(ctx context.Context) {
+	var configs []elasticsearch.Config
+
+	for _, cfg := range s.configCache.GetAll() {
+		if s.cluster.Owns(cfg.ID) {
+			configs = append(configs, cfg)
+		}
+	}
+
+	s.scheduler.Update(ctx, configs)
+
+	s.logger.Info("rebalanced devices",
+		"members", s.cluster.Members(),
+		"scheduled", s.scheduler.Count(),
+	)
+}
+
+// collectDevice is the scheduler callback for a single device collection.
+func (s *Service) collectDevice(ctx context.Context, cfg *elasticsearch.Config) {
+	if err := s.processConfiguration(ctx, cfg); err != nil && ctx.Err() == nil {
+		s.logger.Error("Failed to process configuration",
+			"error", err,
+			"id", cfg.ID)
+	}
 }
 
+// source fetches the metric families of a device.
+type source func(ctx context.Context) (map[string]*dto.MetricFamily, error)
+
 // processConfiguration handles a single device configuration.
 func (s *Service) processConfiguration(ctx context.Context, cfg *elasticsearch.Config) error {
-	// Create exporter client for this device's configuration
-	hostname := cfg.CollectorSettings.Hostname
-	if !strings.HasPrefix(hostname, "http://") && !strings.HasPrefix(hostname, "https://") {
-		hostname = "http://" + hostname
+	fetch, err := s.newSource(cfg)
+	if err != nil {
+		return err
 	}
-	exporterClient, err := exporter.NewClient(exporter.Config{
-		BaseURL: hostname,
-		Timeout: s.cfg.Timing.ScrapeTimeout.Duration,
-	})
+
+	// Compile the device's metric filters once for all retries
+	metricFilter, err := filter.Compile(cfg.CollectorSettings.Metrics.Include, cfg.CollectorSettings.Metrics.Exclude)
 	if err != nil {
-		return fmt.Errorf("creating exporter client: %w", err)
+		return fmt.Errorf("compiling metric filters: %w", err)
 	}
 
-	// Create backoff configuration
+	// Create backoff configuration from the settings current at the start
+	// of the collection; a reload applies from the next one.
+	settings := s.config()
+
 	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = s.cfg.Backoff.InitialInterval.Duration
-	b.MaxInterval = s.cfg.Backoff.MaxInterval.Duration
-	b.Multiplier = s.cfg.Backoff.Multiplier
-	b.MaxElapsedTime = s.cfg.Timing.ScrapeTimeout.Duration
+	b.InitialInterval = settings.Backoff.InitialInterval.Duration
+	b.MaxInterval = settings.Backoff.MaxInterval.Duration
+	b.Multiplier = settings.Backoff.Multiplier
+	b.MaxElapsedTime = settings.Timing.ScrapeTimeout.Duration
 
 	// Acquire worker from pool
-	select {
-	case s.workerPool <- struct{}{}:
-		s.wg.Add(1)
-		go func() {
-			defer s.wg.Done()
-			defer func() { <-s.workerPool }()
+	if err := s.workerPool.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.workerPool.release()
 
-			operation := func() error {
-				return s.collectMetrics(ctx, cfg, exporterClient)
-			}
+	// Only transient failures are retried. A breaker that opens stops the
+	// retries too; the collection is only skipped if no attempt was made,
+	// otherwise the last failure counts.
+	result := collection{start: time.Now()}
 
-			if err := backoff.Retry(operation, b); err != nil {
-				s.logger.Error("collecting metrics after retries",
-					"device", cfg.Name,
-					"error", err,
-				)
-			}
-		}()
-	case <-ctx.Done():
-		return ctx.Err()
+	var attemptErr error
+
+	operation := func() error {
+		samples, err := s.collectMetrics(ctx, cfg, fetch, metricFilter)
+		if !errors.Is(err, breaker.ErrOpen) {
+			result.attempts++
+			result.samples = samples
+			attemptErr = err
+		}
+
+		if err != nil && !retryable(err) {
+			return backoff.Permanent(err)
+		}
+
+		return err
 	}
 
-	return nil
+	err = backoff.Retry(operation, backoff.WithContext(b, ctx))
+	if errors.Is(err, breaker.ErrOpen) && result.attempts > 0 {
+		err = attemptErr
+	}
+
+	result.err = err
+
+	switch {
+	case errors.Is(err, breaker.ErrOpen):
+		result.outcome = telemetry.OutcomeSkipped
+	case err != nil:
+		result.outcome = telemetry.OutcomeFailure
+	default:
+		result.outcome = telemetry.OutcomeSuccess
+	}
+
+	s.metrics.Scrapes.WithLabelValues(cfg.ID, result.outcome, errorClass(err)).Inc()
+	s.reportStatus(ctx, cfg, &result)
+
+	switch result.outcome {
+	case telemetry.OutcomeSkipped:
+		s.logger.Debug("skipped collection", "id", cfg.ID, "reason", err)
+		return nil
+	case telemetry.OutcomeFailure:
+		return fmt.Errorf("collecting metrics after retries: %w", err)
+	default:
+		return nil
+	}
+}
+
+// newSource returns the collection backend configured for a device.
+func (s *Service) newSource(cfg *elasticsearch.Config) (source, error) {
+	switch cfg.CollectorSettings.Backend {
+	case "", elasticsearch.BackendExporter:
+		return s.exporterSource(cfg)
+	case elasticsearch.BackendNative:
+		return s.nativeSource(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown collection backend: %s", cfg.CollectorSettings.Backend)
+	}
 }
 
-// collectMetrics collects and processes metrics for a device.
-func (s *Service) collectMetrics(ctx context.Context, cfg *elasticsearch.Config, exporterClient *exporter.Client) error {
+// exporterSource scrapes the device through its multi-target exporter.
+func (s *Service) exporterSource(cfg *elasticsearch.Config) (source, error) {
+	probe, ok := s.probes[exporterType(cfg)]
+	if !ok {
+		return nil, fmt.Errorf("unknown exporter type: %s", exporterType(cfg))
+	}
+
+	if cfg.Exporter.Path != "" {
+		probe.Path = cfg.Exporter.Path
+	}
+
+	exporterClient, err := exporter.NewClient(exporter.Config{
+		BaseURL:   exporterBaseURL(cfg),
+		Timeout:   s.config().Timing.ScrapeTimeout.Duration,
+		Transport: s.transport,
+		Probe:     &probe,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating exporter client: %w", err)
+	}
+
 	params := exporter.QueryParams{
 		Target:    cfg.SNMPSettings.Host,
 		Port:      cfg.SNMPSettings.Port,
 		Transport: "udp",
 		Module:    cfg.CollectorSettings.Modules,
 		Auth:      cfg.SNMPSettings.AuthName,
+		Context:   cfg.SNMPSettings.ContextName,
+		Params:    cfg.Exporter.Params,
 	}
 
-	metrics, err := exporterClient.GetMetrics(ctx, &params)
-	if err != nil {
-		return fmt.Errorf("getting metrics: %w", err)
+	return func(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+		if err := s.exporterBreakers.Allow(exporterClient.BaseURL()); err != nil {
+			return nil, &stageError{class: errorClassBreaker, err: fmt.Errorf("exporter %s: %w", exporterClient.BaseURL(), err)}
+		}
+
+		metrics, err := exporterClient.GetMetrics(ctx, &params)
+		s.recordExporter(exporterClient.BaseURL(), err)
+
+		if err != nil {
+			return nil, &stageError{class: errorClassExporter, err: fmt.Errorf("getting metrics: %w", err)}
+		}
+
+		families, err := schema.ParseFamilies(metrics.ContentType, metrics.Body)
+		if err != nil {
+			return nil, &stageError{class: errorClassParse, err: fmt.Errorf("parsing metrics: %w", err)}
+		}
+
+		return families, nil
+	}, nil
+}
+
+// nativeSource polls the device directly over SNMP.
+func (s *Service) nativeSource(cfg *elasticsearch.Config) source {
+	target := snmp.Target{
+		Host:      cfg.SNMPSettings.Host,
+		Port:      cfg.SNMPSettings.Port,
+		Version:   cfg.SNMPSettings.Version,
+		Community: cfg.SNMPSettings.Community,
+		Retries:   cfg.SNMPSettings.Retries,
+	}
+
+	if cfg.SNMPSettings.Version == "3" {
+		target.USM = cfg.SNMPSettings.USM()
+	}
+
+	// An unparsable timeout falls back to the SNMP default.
+	if timeout, err := time.ParseDuration(cfg.SNMPSettings.Timeout); err == nil {
+		target.Timeout = timeout
 	}
 
-	doc, err := s.transformer.TransformMetrics(cfg.SNMPSettings.Host, metrics)
+	return func(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+		families, err := s.snmp.Collect(ctx, target, cfg.CollectorSettings.Modules)
+		if err != nil {
+			return nil, &stageError{class: errorClassSNMP, err: fmt.Errorf("polling device: %w", err)}
+		}
+
+		return families, nil
+	}
+}
+
+// collectMetrics collects and processes metrics for a device, returning the
+// number of samples kept.
+func (s *Service) collectMetrics(ctx context.Context, cfg *elasticsearch.Config, fetch source, metricFilter *filter.Filter) (int, error) {
+	if err := s.deviceBreakers.Allow(cfg.ID); err != nil {
+		return 0, &stageError{class: errorClassBreaker, err: fmt.Errorf("device %s: %w", cfg.ID, err)}
+	}
+
+	start := time.Now()
+	families, err := fetch(ctx)
+	s.recordDevice(cfg.ID, err)
+	s.metrics.ScrapeDuration.
+		WithLabelValues(cfg.ID, strings.Join(cfg.CollectorSettings.Modules, ",")).
+		Observe(time.Since(start).Seconds())
+
 	if err != nil {
-		return fmt.Errorf("transforming metrics: %w", err)
+		return 0, err
+	}
+
+	scrape := s.transformer.TransformFamilies(cfg.SNMPSettings.Host, start, families, metricFilter)
+
+	widths := counterWidths(cfg)
+	for i := range scrape.Samples {
+		scrape.Samples[i].CounterBits = widths[scrape.Samples[i].Name]
 	}
 
+	s.rates.Apply(cfg.ID, scrape)
+
+	docs := s.transformer.Documents(scrape, deviceInfo(cfg), s.documentMode)
+
 	// Acquire writer from pool for document processing
-	select {
-	case s.writerPool <- struct{}{}:
-		defer func() { <-s.writerPool }()
+	if err := s.writerPool.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer s.writerPool.release()
 
-		// Create metrics document
-		metricsDoc := elasticsearch.MetricsDocument{
-			DeviceID:    cfg.ID,
-			Environment: cfg.Tags.Environment,
-			Location:    cfg.Tags.Location,
-			Role:        cfg.Tags.Role,
-			Metrics:     doc.Metrics,
-		}
+	// Documents the bulk API rejects outright are reported by the writer
+	// observer rather than failing the collection.
+	if err := s.writer.Write(ctx, docs); err != nil {
+		s.logger.Error("storing metrics",
+			"device", cfg.Name,
+			"error", err,
+		)
+		return len(scrape.Samples), &stageError{class: errorClassStore, err: fmt.Errorf("storing metrics: %w", err)}
+	}
 
-		// Store metrics in Elasticsearch
-		if err := s.esClient.StoreMetrics(ctx, &metricsDoc); err != nil {
-			s.logger.Error("storing metrics",
-				"device", cfg.Name,
-				"error", err,
-			)
-			return fmt.Errorf("storing metrics: %w", err)
-		}
-
-		if s.logger.Enabled(ctx, slog.LevelDebug) {
-			jsonDoc, err := json.MarshalIndent(metricsDoc, "", "  ")
-			if err != nil {
-				s.logger.Warn("failed to marshal metrics document", "error", err)
-			} else {
-				s.logger.Debug("stored metrics document",
-					"device", cfg.Name,
-					"json", string(jsonDoc),
-				)
-			}
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		jsonDocs, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			s.logger.Warn("failed to marshal metrics documents", "error", err)
 		} else {
-			s.logger.Info("stored metrics",
+			s.logger.Debug("queued metrics documents",
 				"device", cfg.Name,
-				"host", cfg.SNMPSettings.Host,
-				"modules", cfg.CollectorSettings.Modules,
-				"timestamp", doc.Timestamp,
+				"json", string(jsonDocs),
 			)
 		}
+	} else {
+		s.logger.Info("queued metrics",
+			"device", cfg.Name,
+			"host", cfg.SNMPSettings.Host,
+			"modules", cfg.CollectorSettings.Modules,
+			"samples", len(scrape.Samples),
+			"documents", len(docs),
+			"timestamp", scrape.Timestamp,
+		)
+	}
 
-		return nil
+	return len(scrape.Samples), nil
+}
+
+// exporterBaseURL returns the base URL of a device's exporter, assuming
+// HTTP when the configured hostname has no scheme.
+func exporterBaseURL(cfg *elasticsearch.Config) string {
+	hostname := cfg.CollectorSettings.Hostname
+	if !strings.HasPrefix(hostname, "http://") && !strings.HasPrefix(hostname, "https://") {
+		hostname = "http://" + hostname
+	}
+
+	return strings.TrimRight(hostname, "/")
+}
+
+// exporterType returns the probe type of a device, defaulting to SNMP.
+func exporterType(cfg *elasticsearch.Config) string {
+	if cfg.Exporter.Type == "" {
+		return exporter.ProbeSNMP
+	}
+
+	return cfg.Exporter.Type
+}
 
-	case <-ctx.Done():
-		return ctx.Err()
+// deviceInfo describes a device configuration for metrics documents.
+func deviceInfo(cfg *elasticsearch.Config) schema.DeviceInfo {
+	return schema.DeviceInfo{
+		ID:       cfg.ID,
+		Name:     cfg.Name,
+		Type:     cfg.Type,
+		Exporter: exporterType(cfg),
+		Tags: schema.DeviceTags{
+			Environment: cfg.Tags.Environment,
+			Location:    cfg.Tags.Location,
+			Role:        cfg.Tags.Role,
+		},
 	}
 }
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/breaker"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/exporter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/telemetry"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		class     string
+		retryable bool
+	}{
+		{
+			name:      "exporter 5xx",
+			err:       &stageError{class: errorClassExporter, err: &exporter.Error{Kind: exporter.ErrorServer, StatusCode: 503}},
+			class:     "exporter_5xx",
+			retryable: true,
+		},
+		{
+			name:  "unknown module",
+			err:   &stageError{class: errorClassExporter, err: &exporter.Error{Kind: exporter.ErrorUnknownModule, StatusCode: 400}},
+			class: "unknown_module",
+		},
+		{
+			name:      "exporter timeout",
+			err:       &exporter.Error{Kind: exporter.ErrorTimeout, Err: context.DeadlineExceeded},
+			class:     errorClassTimeout,
+			retryable: true,
+		},
+		{
+			name:  "parse error",
+			err:   &stageError{class: errorClassParse, err: &schema.ParseError{MediaType: "text/plain", Err: errors.New("bad")}},
+			class: errorClassParse,
+		},
+		{
+			name:      "elasticsearch unavailable",
+			err:       &stageError{class: errorClassStore, err: &elasticsearch.UnavailableError{Status: 503, Err: errors.New("down")}},
+			class:     errorClassUnavailable,
+			retryable: true,
+		},
+		{
+			name:  "mapping rejection",
+			err:   &stageError{class: errorClassStore, err: &elasticsearch.ItemError{Status: 400, Type: "mapper_parsing_exception"}},
+			class: errorClassMapping,
+		},
+		{
+			name:      "snmp",
+			err:       &stageError{class: errorClassSNMP, err: errors.New("request timeout")},
+			class:     errorClassSNMP,
+			retryable: true,
+		},
+		{
+			name:  "open breaker",
+			err:   &stageError{class: errorClassBreaker, err: fmt.Errorf("device a: %w", breaker.ErrOpen)},
+			class: errorClassBreaker,
+		},
+		{
+			name:  "canceled",
+			err:   fmt.Errorf("collecting: %w", context.Canceled),
+			class: errorClassCanceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.class {
+				t.Errorf("errorClass() = %q, want %q", got, tt.class)
+			}
+
+			if got := retryable(tt.err); got != tt.retryable {
+				t.Errorf("retryable() = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestCounterWidths(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings elasticsearch.CollectorSettings
+		want     map[string]int
+	}{
+		{
+			name:     "exporter",
+			settings: elasticsearch.CollectorSettings{Modules: []string{"if_mib"}},
+			want:     map[string]int{"ifInOctets": 0, "ifHCInOctets_total": 0},
+		},
+		{
+			name: "exporter with widths",
+			settings: elasticsearch.CollectorSettings{
+				Modules:     []string{"if_mib"},
+				CounterBits: map[string]int{"ifHCInOctets_total": 64},
+			},
+			want: map[string]int{"ifInOctets": 0, "ifHCInOctets_total": 64},
+		},
+		{
+			name: "native",
+			settings: elasticsearch.CollectorSettings{
+				Backend:     elasticsearch.BackendNative,
+				Modules:     []string{"if_mib"},
+				CounterBits: map[string]int{"ifInOctets": 64},
+			},
+			want: map[string]int{"ifInOctets": 64, "ifHCInOctets": 64, "ifOutOctets": 32},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widths := counterWidths(&elasticsearch.Config{CollectorSettings: tt.settings})
+
+			for name, want := range tt.want {
+				if got := widths[name]; got != want {
+					t.Errorf("counterWidths()[%s] = %d, want %d", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusTracker(t *testing.T) {
+	tracker := newStatusTracker()
+	start := time.Date(2025, 2, 18, 23, 0, 0, 0, time.UTC)
+
+	outcomes := []struct {
+		outcome     string
+		failures    int
+		lastSuccess time.Time
+	}{
+		{outcome: telemetry.OutcomeFailure, failures: 1},
+		{outcome: telemetry.OutcomeSuccess, failures: 0, lastSuccess: start.Add(time.Minute)},
+		{outcome: telemetry.OutcomeFailure, failures: 1, lastSuccess: start.Add(time.Minute)},
+		{outcome: telemetry.OutcomeSkipped, failures: 2, lastSuccess: start.Add(time.Minute)},
+	}
+
+	for i, want := range outcomes {
+		got := tracker.record("a", want.outcome, start.Add(time.Duration(i)*time.Minute))
+
+		if got.failures != want.failures || !got.lastSuccess.Equal(want.lastSuccess) {
+			t.Errorf("record(%s) = %+v, want %d failures since %v", want.outcome, got, want.failures, want.lastSuccess)
+		}
+	}
+
+	tracker.retain(map[string]bool{})
+
+	if got := tracker.record("a", telemetry.OutcomeFailure, start); got.failures != 1 || !got.lastSuccess.IsZero() {
+		t.Errorf("record() after retain = %+v, want a new history", got)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/scheduler"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/telemetry"
+)
+
+// collection is the result of a device collection, retries included.
+type collection struct {
+	start    time.Time
+	attempts int
+	samples  int
+	outcome  string
+	err      error
+}
+
+// statusTracker remembers, per device, the last successful collection and
+// the number of collections without success since.
+type statusTracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceHistory
+}
+
+// deviceHistory is the collection history of one device.
+type deviceHistory struct {
+	lastSuccess time.Time
+	failures    int
+}
+
+// newStatusTracker creates an empty tracker.
+func newStatusTracker() *statusTracker {
+	return &statusTracker{devices: make(map[string]*deviceHistory)}
+}
+
+// record adds a collection outcome to a device's history and returns the
+// updated history. Skipped collections count as failures: the device is
+// still not being collected.
+func (t *statusTracker) record(id, outcome string, at time.Time) deviceHistory {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.devices[id]
+	if !ok {
+		h = &deviceHistory{}
+		t.devices[id] = h
+	}
+
+	if outcome == telemetry.OutcomeSuccess {
+		h.lastSuccess = at
+		h.failures = 0
+	} else {
+		h.failures++
+	}
+
+	return *h
+}
+
+// retain drops the history of devices not in ids.
+func (t *statusTracker) retain(ids map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id := range t.devices {
+		if !ids[id] {
+			delete(t.devices, id)
+		}
+	}
+}
+
+// reportStatus writes a device's status document after a collection.
+// Cancelled collections say nothing about the device and are not reported.
+func (s *Service) reportStatus(ctx context.Context, cfg *elasticsearch.Config, c *collection) {
+	if s.statusWriter == nil || errors.Is(c.err, context.Canceled) {
+		return
+	}
+
+	now := time.Now()
+	history := s.statuses.record(cfg.ID, c.outcome, now)
+
+	status := &elasticsearch.DeviceStatus{
+		Timestamp:           now.UTC(),
+		Device:              deviceInfo(cfg),
+		Observer:            s.config().Instance.Name,
+		Host:                cfg.SNMPSettings.Host,
+		Modules:             cfg.CollectorSettings.Modules,
+		Outcome:             c.outcome,
+		DurationSeconds:     now.Sub(c.start).Seconds(),
+		Samples:             c.samples,
+		Attempts:            c.attempts,
+		IntervalSeconds:     scheduler.Interval(cfg, scheduler.DefaultInterval).Seconds(),
+		ConsecutiveFailures: history.failures,
+	}
+
+	if cfg.CollectorSettings.Backend != elasticsearch.BackendNative {
+		status.Exporter = exporterBaseURL(cfg)
+	}
+
+	if !history.lastSuccess.IsZero() {
+		lastSuccess := history.lastSuccess.UTC()
+		status.LastSuccess = &lastSuccess
+	}
+
+	if c.err != nil {
+		status.ErrorClass = errorClass(c.err)
+		status.ErrorMessage = c.err.Error()
+	}
+
+	// The status is queued, not sent, so it is written even if the
+	// collection's context has just ended.
+	if err := s.statusWriter.Write(context.WithoutCancel(ctx), status); err != nil {
+		s.logger.Warn("writing device status", "id", cfg.ID, "error", err)
+	}
+}
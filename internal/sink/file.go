@@ -0,0 +1,232 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// Defaults for file sinks.
+const (
+	DefaultMaxFileSize = 100 << 20
+	DefaultMaxBackups  = 5
+)
+
+// FileConfig configures a newline-delimited JSON file sink.
+type FileConfig struct {
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups int
+}
+
+// File writes documents as newline-delimited JSON, rotating the file once it
+// reaches its maximum size. Rotated files are renamed with a timestamp
+// suffix, path-20060102T150405.000, and the oldest are removed.
+type File struct {
+	cfg  FileConfig
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFile opens, or creates, the file a sink appends to.
+func NewFile(cfg FileConfig) (*File, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("file sink path must be specified")
+	}
+
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxFileSize
+	}
+
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = DefaultMaxBackups
+	}
+
+	f := &File{cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write implements Sink.
+func (f *File) Write(_ context.Context, docs []schema.Document) error {
+	data, err := encodeLines(docs)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return fmt.Errorf("file sink is closed")
+	}
+
+	if f.size > 0 && f.size+int64(len(data)) > f.cfg.MaxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", f.cfg.Path, err)
+	}
+
+	return nil
+}
+
+// Close implements Sink.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// open opens the file for appending.
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.cfg.Path), 0o755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", f.cfg.Path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("reading %s: %w", f.cfg.Path, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+// rotate renames the current file, opens a new one and removes the oldest
+// rotated files beyond the backup limit.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", f.cfg.Path, err)
+	}
+
+	f.file = nil
+
+	rotated := f.cfg.Path + "-" + time.Now().UTC().Format("20060102T150405.000")
+	if err := os.Rename(f.cfg.Path, rotated); err != nil {
+		return fmt.Errorf("rotating %s: %w", f.cfg.Path, err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.prune()
+}
+
+// prune removes rotated files beyond the backup limit, oldest first.
+func (f *File) prune() error {
+	backups, err := filepath.Glob(f.cfg.Path + "-*")
+	if err != nil {
+		return err
+	}
+
+	// The timestamp suffixes sort chronologically.
+	sort.Strings(backups)
+
+	for len(backups) > f.cfg.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", backups[0], err)
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Stream writes documents as newline-delimited JSON to a writer such as
+// standard output.
+type Stream struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewStream creates a sink writing to w.
+func NewStream(w io.Writer) *Stream {
+	return &Stream{w: bufio.NewWriter(w)}
+}
+
+// NewStdout creates a sink writing to standard output.
+func NewStdout() *Stream {
+	return NewStream(os.Stdout)
+}
+
+// Write implements Sink. Every batch is flushed so that output is not held
+// back between scrapes.
+func (s *Stream) Write(_ context.Context, docs []schema.Document) error {
+	data, err := encodeLines(docs)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+
+	return s.w.Flush()
+}
+
+// Close implements Sink.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.w.Flush()
+}
+
+// encodeLines encodes documents as newline-delimited JSON.
+func encodeLines(docs []schema.Document) ([]byte, error) {
+	var b bytes.Buffer
+
+	enc := json.NewEncoder(&b)
+
+	for i := range docs {
+		if err := enc.Encode(&docs[i]); err != nil {
+			return nil, fmt.Errorf("encoding document: %w", err)
+		}
+	}
+
+	return b.Bytes(), nil
+}
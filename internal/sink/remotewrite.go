@@ -0,0 +1,224 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultRemoteWriteTimeout bounds a remote write request.
+const DefaultRemoteWriteTimeout = 30 * time.Second
+
+// RemoteWriteConfig configures a Prometheus remote write endpoint.
+type RemoteWriteConfig struct {
+	URL      string
+	Username string
+	Password string
+	// Headers are added to every request.
+	Headers map[string]string
+	Timeout time.Duration
+	// Transport defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// RemoteWrite sends samples to a Prometheus remote write (1.0) endpoint as
+// snappy compressed protobuf. Trap documents are ignored.
+type RemoteWrite struct {
+	cfg    RemoteWriteConfig
+	client *http.Client
+}
+
+// NewRemoteWrite creates a remote write sink.
+func NewRemoteWrite(cfg RemoteWriteConfig) (*RemoteWrite, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("remote write URL must be specified")
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultRemoteWriteTimeout
+	}
+
+	return &RemoteWrite{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+	}, nil
+}
+
+// Write implements Sink.
+func (r *RemoteWrite) Write(ctx context.Context, docs []schema.Document) error {
+	series := timeSeries(docs)
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := s2.EncodeSnappy(nil, encodeWriteRequest(series))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	for name, value := range r.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending samples: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("remote write returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	return nil
+}
+
+// Close implements Sink.
+func (r *RemoteWrite) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// series is a remote write time series with a single sample.
+type series struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// label is a remote write label.
+type label struct {
+	name, value string
+}
+
+// timeSeries converts the samples of metric documents to time series.
+// Native histograms and summaries are sent as their _sum and _count series
+// and, for summaries, their quantiles; histogram buckets are not sent.
+func timeSeries(docs []schema.Document) []series {
+	var out []series
+
+	for i := range docs {
+		doc := &docs[i]
+
+		samples := doc.Samples
+		if doc.Metric != nil {
+			samples = []schema.Sample{*doc.Metric}
+		}
+
+		ts := doc.Timestamp.UnixMilli()
+
+		for _, sample := range samples {
+			if sample.Histogram == nil && sample.Quantiles == nil {
+				out = append(out, series{labels: seriesLabels(doc, sample.Name, sample.Labels, nil), value: sample.Value, timestamp: ts})
+				continue
+			}
+
+			out = append(out,
+				series{labels: seriesLabels(doc, sample.Name+"_sum", sample.Labels, nil), value: sample.Value, timestamp: ts},
+				series{labels: seriesLabels(doc, sample.Name+"_count", sample.Labels, nil), value: float64(sample.Count), timestamp: ts},
+			)
+
+			for q, value := range sample.Quantiles {
+				extra := map[string]string{"quantile": q}
+				out = append(out, series{labels: seriesLabels(doc, sample.Name, sample.Labels, extra), value: value, timestamp: ts})
+			}
+		}
+	}
+
+	return out
+}
+
+// seriesLabels builds the sorted label set of a series. The sample's own
+// labels take precedence over the device labels added here.
+func seriesLabels(doc *schema.Document, name string, sampleLabels, extra map[string]string) []label {
+	set := map[string]string{
+		"instance":    doc.Host.Hostname,
+		"device_id":   doc.Device.ID,
+		"device_name": doc.Device.Name,
+		"device_type": doc.Device.Type,
+		"environment": doc.Device.Tags.Environment,
+		"location":    doc.Device.Tags.Location,
+		"role":        doc.Device.Tags.Role,
+	}
+
+	maps.Copy(set, sampleLabels)
+	maps.Copy(set, extra)
+	set["__name__"] = name
+
+	labels := make([]label, 0, len(set))
+
+	for name, value := range set {
+		if value != "" {
+			labels = append(labels, label{name: name, value: value})
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+
+	return labels
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(all []series) []byte {
+	var req []byte
+
+	for _, s := range all {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
@@ -0,0 +1,283 @@
+// Package sink delivers documents to one or more outputs alongside
+// Elasticsearch, each with its own filter.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/filter"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// Sink types.
+const (
+	TypeElasticsearch = "elasticsearch"
+	TypeRemoteWrite   = "remote_write"
+	TypeFile          = "file"
+	TypeStdout        = "stdout"
+)
+
+// DefaultQueueSize is the number of writes queued for a secondary output.
+const DefaultQueueSize = 100
+
+// ErrDropped is observed for the documents of a write dropped because the
+// output's queue was full.
+var ErrDropped = errors.New("sink queue full")
+
+// Sink receives documents produced by the pipeline.
+type Sink interface {
+	// Write delivers documents to the output.
+	Write(ctx context.Context, docs []schema.Document) error
+
+	// Close flushes pending documents and releases any resources.
+	Close() error
+}
+
+// Filter selects the documents a sink receives.
+type Filter struct {
+	// Kinds lists the event kinds accepted, "metric" or "alert"; empty
+	// accepts both.
+	Kinds []string
+	// Metrics selects samples by name and labels; nil keeps every sample.
+	Metrics *filter.Filter
+}
+
+// NewFilter compiles a filter from event kinds and metric patterns.
+func NewFilter(kinds, include, exclude []string) (*Filter, error) {
+	for _, kind := range kinds {
+		if kind != "metric" && kind != "alert" {
+			return nil, fmt.Errorf("unknown event kind: %s", kind)
+		}
+	}
+
+	metrics, err := filter.Compile(include, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{Kinds: kinds, Metrics: metrics}, nil
+}
+
+// Apply returns the documents, or parts of documents, the filter keeps.
+// Scrape documents keep only their matching samples.
+func (f *Filter) Apply(docs []schema.Document) []schema.Document {
+	if f == nil {
+		return docs
+	}
+
+	kept := make([]schema.Document, 0, len(docs))
+
+	for _, doc := range docs {
+		if len(f.Kinds) > 0 && !slices.Contains(f.Kinds, doc.Event.Kind) {
+			continue
+		}
+
+		switch {
+		case doc.Metric != nil:
+			if !f.Metrics.Match(doc.Metric.Name, doc.Metric.Labels) {
+				continue
+			}
+		case len(doc.Samples) > 0:
+			samples := make([]schema.Sample, 0, len(doc.Samples))
+
+			for _, sample := range doc.Samples {
+				if f.Metrics.Match(sample.Name, sample.Labels) {
+					samples = append(samples, sample)
+				}
+			}
+
+			if len(samples) == 0 {
+				continue
+			}
+
+			doc.Samples = samples
+		}
+
+		kept = append(kept, doc)
+	}
+
+	return kept
+}
+
+// Output is a named sink with its filter.
+type Output struct {
+	Name   string
+	Sink   Sink
+	Filter *Filter
+	// Primary outputs must accept the documents for a write to succeed;
+	// the others are delivered to on a best-effort basis, in the background.
+	Primary bool
+	// QueueSize is the number of writes queued for a secondary output;
+	// DefaultQueueSize when zero. Writes are dropped while the queue is full.
+	QueueSize int
+}
+
+// queue holds the writes waiting for a secondary output.
+type queue struct {
+	out    Output
+	writes chan []schema.Document
+}
+
+// Observer is notified of every write to an output.
+type Observer func(name string, documents int, err error)
+
+// Multi fans documents out to several outputs. It implements
+// elasticsearch.Writer so that it can stand in for the Elasticsearch writer.
+type Multi struct {
+	outputs []Output
+	// queues holds the queue of each secondary output, by output index.
+	queues   []*queue
+	logger   *slog.Logger
+	observer Observer
+	wg       sync.WaitGroup
+}
+
+// WithObserver registers an observer for writes to the outputs.
+func WithObserver(observer Observer) func(*Multi) {
+	return func(m *Multi) {
+		m.observer = observer
+	}
+}
+
+// NewMulti creates a fan-out writer over the outputs. Each secondary output
+// is written to from its own queue until Close.
+func NewMulti(outputs []Output, logger *slog.Logger, opts ...func(*Multi)) *Multi {
+	m := &Multi{
+		outputs: outputs,
+		queues:  make([]*queue, len(outputs)),
+		logger:  logger,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	for i, out := range outputs {
+		if out.Primary {
+			continue
+		}
+
+		size := out.QueueSize
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+
+		q := &queue{out: out, writes: make(chan []schema.Document, size)}
+		m.queues[i] = q
+
+		m.wg.Add(1)
+
+		go m.drain(q)
+	}
+
+	return m
+}
+
+// Write delivers documents to every output, filtered per output. Primary
+// outputs are written to before Write returns; the error joins their
+// failures, each wrapped with the output's name, so that a failing primary
+// output is retried even though the others succeeded. Secondary outputs are
+// queued for, so that a slow one holds up neither the caller nor the others;
+// their failures and drops are logged and observed only.
+func (m *Multi) Write(ctx context.Context, docs []schema.Document) error {
+	var errs []error
+
+	for i, out := range m.outputs {
+		selected := out.Filter.Apply(docs)
+		if len(selected) == 0 {
+			continue
+		}
+
+		if !out.Primary {
+			m.enqueue(m.queues[i], selected)
+			continue
+		}
+
+		if err := m.write(ctx, out, selected); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", out.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// enqueue queues documents for a secondary output, dropping them if its queue
+// is full.
+func (m *Multi) enqueue(q *queue, docs []schema.Document) {
+	select {
+	case q.writes <- docs:
+		return
+	default:
+	}
+
+	m.logger.Warn("sink queue full, dropping documents",
+		"sink", q.out.Name,
+		"documents", len(docs),
+	)
+
+	if m.observer != nil {
+		m.observer(q.out.Name, len(docs), ErrDropped)
+	}
+}
+
+// drain writes the queued documents to a secondary output until its queue is
+// closed.
+func (m *Multi) drain(q *queue) {
+	defer m.wg.Done()
+
+	for docs := range q.writes {
+		_ = m.write(context.Background(), q.out, docs)
+	}
+}
+
+// write writes documents to an output, logging and observing the outcome.
+func (m *Multi) write(ctx context.Context, out Output, docs []schema.Document) error {
+	err := out.Sink.Write(ctx, docs)
+
+	if m.observer != nil {
+		m.observer(out.Name, len(docs), err)
+	}
+
+	if err != nil {
+		m.logger.Error("writing to sink",
+			"sink", out.Name,
+			"primary", out.Primary,
+			"documents", len(docs),
+			"error", err,
+		)
+	}
+
+	return err
+}
+
+// WriteOne delivers a single document to every output.
+func (m *Multi) WriteOne(ctx context.Context, doc schema.Document) error {
+	return m.Write(ctx, []schema.Document{doc})
+}
+
+// Close writes the queued documents, then closes every output. Write must not
+// be called after Close.
+func (m *Multi) Close() error {
+	for _, q := range m.queues {
+		if q != nil {
+			close(q.writes)
+		}
+	}
+
+	m.wg.Wait()
+
+	var errs []error
+
+	for _, out := range m.outputs {
+		if err := out.Sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", out.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,425 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testDocuments() []schema.Document {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return []schema.Document{
+		{
+			Timestamp: ts,
+			Event:     schema.EventInfo{Kind: "metric"},
+			Device:    schema.DeviceInfo{ID: "sw1", Name: "switch-1"},
+			Metric:    &schema.Sample{Name: "ifInOctets", Value: 1, Labels: map[string]string{"ifIndex": "1"}},
+		},
+		{
+			Timestamp: ts,
+			Event:     schema.EventInfo{Kind: "metric"},
+			Device:    schema.DeviceInfo{ID: "sw1", Name: "switch-1"},
+			Samples: []schema.Sample{
+				{Name: "ifInOctets", Value: 2},
+				{Name: "sysUpTime", Value: 3},
+			},
+		},
+		{
+			Timestamp: ts,
+			Event:     schema.EventInfo{Kind: "alert"},
+			Device:    schema.DeviceInfo{ID: "sw1"},
+			Trap:      &schema.Trap{},
+		},
+	}
+}
+
+// recorder is a sink that records the documents written to it.
+type recorder struct {
+	docs   []schema.Document
+	err    error
+	closed bool
+}
+
+func (r *recorder) Write(_ context.Context, docs []schema.Document) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	r.docs = append(r.docs, docs...)
+
+	return nil
+}
+
+func (r *recorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+// blocking is a sink whose writes wait until release is closed.
+type blocking struct {
+	recorder
+	release chan struct{}
+}
+
+func (b *blocking) Write(ctx context.Context, docs []schema.Document) error {
+	<-b.release
+	return b.recorder.Write(ctx, docs)
+}
+
+func TestFilter_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		kinds   []string
+		include []string
+		want    int
+		samples int
+	}{
+		{name: "no filter", want: 3, samples: 2},
+		{name: "alerts only", kinds: []string{"alert"}, want: 1},
+		{name: "metrics only", kinds: []string{"metric"}, want: 2, samples: 2},
+		{name: "include drops scrape samples", include: []string{"sysUpTime"}, want: 2, samples: 1},
+		{name: "include drops documents", kinds: []string{"metric"}, include: []string{"ifOutOctets"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.kinds, tt.include, nil)
+			if err != nil {
+				t.Fatalf("NewFilter() error = %v", err)
+			}
+
+			docs := testDocuments()
+
+			got := f.Apply(docs)
+			if len(got) != tt.want {
+				t.Fatalf("Apply() kept %d documents, want %d", len(got), tt.want)
+			}
+
+			for _, doc := range got {
+				if doc.Samples != nil && len(doc.Samples) != tt.samples {
+					t.Errorf("Apply() kept %d samples, want %d", len(doc.Samples), tt.samples)
+				}
+			}
+
+			if len(docs[1].Samples) != 2 {
+				t.Error("Apply() modified the input documents")
+			}
+		})
+	}
+
+	if _, err := NewFilter([]string{"log"}, nil, nil); err == nil {
+		t.Error("NewFilter() accepted an unknown event kind")
+	}
+}
+
+func TestMulti_Write(t *testing.T) {
+	alerts, err := NewFilter([]string{"alert"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+
+	all := &recorder{}
+	failing := &recorder{err: errors.New("unavailable")}
+	traps := &recorder{}
+
+	var mu sync.Mutex
+
+	written := map[string]int{}
+
+	m := NewMulti([]Output{
+		{Name: "all", Sink: all},
+		{Name: "failing", Sink: failing},
+		{Name: "traps", Sink: traps, Filter: alerts},
+	}, testLogger(), WithObserver(func(name string, documents int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err == nil {
+			written[name] += documents
+		}
+	}))
+
+	if err := m.Write(context.Background(), testDocuments()); err != nil {
+		t.Fatalf("Write() error = %v, want nil when only a secondary sink fails", err)
+	}
+
+	// Close writes the queued documents.
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if !all.closed || !failing.closed || !traps.closed {
+		t.Error("Close() did not close every sink")
+	}
+
+	if len(all.docs) != 3 || len(traps.docs) != 1 || traps.docs[0].Trap == nil {
+		t.Errorf("Write() delivered %d and %d documents, want 3 and 1 alert", len(all.docs), len(traps.docs))
+	}
+
+	if written["all"] != 3 || written["traps"] != 1 || written["failing"] != 0 {
+		t.Errorf("observer saw %v", written)
+	}
+
+	primary := NewMulti([]Output{
+		{Name: "failing", Sink: failing, Primary: true},
+		{Name: "all", Sink: &recorder{}},
+	}, testLogger())
+
+	if err := primary.Write(context.Background(), testDocuments()); !errors.Is(err, failing.err) {
+		t.Errorf("Write() error = %v, want the primary sink's error while a secondary sink succeeds", err)
+	}
+
+	if err := primary.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestMulti_WriteQueuesSecondaries(t *testing.T) {
+	primary := &recorder{}
+	slow := &blocking{release: make(chan struct{})}
+
+	var mu sync.Mutex
+
+	dropped := 0
+
+	m := NewMulti([]Output{
+		{Name: "primary", Sink: primary, Primary: true},
+		{Name: "slow", Sink: slow, QueueSize: 1},
+	}, testLogger(), WithObserver(func(name string, documents int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if errors.Is(err, ErrDropped) {
+			dropped += documents
+		}
+	}))
+
+	// The first write is taken by the slow sink, the second is queued and the
+	// third finds the queue full. None waits for the slow sink.
+	docs := testDocuments()[:1]
+
+	for i := 0; i < 3; i++ {
+		if err := m.Write(context.Background(), docs); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		// Let the slow sink take its first write off the queue.
+		if i == 0 {
+			deadline := time.Now().Add(5 * time.Second)
+			for len(m.queues[1].writes) != 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	if len(primary.docs) != 3 {
+		t.Errorf("primary sink received %d documents, want 3", len(primary.docs))
+	}
+
+	close(slow.release)
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if len(slow.docs) != 2 || dropped != 1 {
+		t.Errorf("slow sink received %d documents with %d dropped, want 2 and 1", len(slow.docs), dropped)
+	}
+}
+
+func TestFile_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "metrics.ndjson")
+
+	f, err := NewFile(FileConfig{Path: path, MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := f.Write(context.Background(), testDocuments()[:1]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		// Rotated files are named by the millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	backups, err := filepath.Glob(path + "-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Errorf("kept %d rotated files, want 2", len(backups))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		lines++
+	}
+
+	if lines != 1 {
+		t.Errorf("current file holds %d lines, want 1", lines)
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+
+		compressed, _ := io.ReadAll(r.Body)
+
+		var err error
+		if body, err = s2.Decode(nil, compressed); err != nil {
+			t.Errorf("decoding snappy body: %v", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	rw, err := NewRemoteWrite(RemoteWriteConfig{URL: server.URL, Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewRemoteWrite() error = %v", err)
+	}
+	defer rw.Close()
+
+	if err := rw.Write(context.Background(), testDocuments()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+
+	if _, _, ok := (&http.Request{Header: headers}).BasicAuth(); !ok {
+		t.Error("basic auth was not sent")
+	}
+
+	series := decodeSeries(t, body)
+	if len(series) != 3 {
+		t.Fatalf("sent %d series, want 3", len(series))
+	}
+
+	first := series[0]
+	if first.labels["__name__"] != "ifInOctets" || first.labels["ifIndex"] != "1" || first.labels["device_id"] != "sw1" {
+		t.Errorf("unexpected labels %v", first.labels)
+	}
+
+	if first.value != 1 || first.timestamp != time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("unexpected sample %v @ %d", first.value, first.timestamp)
+	}
+}
+
+func TestRemoteWrite_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	rw, err := NewRemoteWrite(RemoteWriteConfig{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewRemoteWrite() error = %v", err)
+	}
+
+	if err := rw.Write(context.Background(), testDocuments()); err == nil {
+		t.Error("Write() error = nil, want the rejection")
+	}
+}
+
+// decodedSeries is a time series read back from a write request.
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeSeries decodes the time series of a remote write request.
+func decodeSeries(t *testing.T, b []byte) []decodedSeries {
+	t.Helper()
+
+	var out []decodedSeries
+
+	for _, ts := range fields(t, b)[1] {
+		s := decodedSeries{labels: map[string]string{}}
+
+		tsFields := fields(t, ts)
+
+		for _, l := range tsFields[1] {
+			lf := fields(t, l)
+			s.labels[string(lf[1][0])] = string(lf[2][0])
+		}
+
+		sample := tsFields[2][0]
+
+		bits, n := protowire.ConsumeFixed64(sample[protowire.SizeTag(1):])
+		s.value = math.Float64frombits(bits)
+
+		ts, _ := protowire.ConsumeVarint(sample[protowire.SizeTag(1)+n+protowire.SizeTag(2):])
+		s.timestamp = int64(ts)
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// fields returns the length-delimited fields of a message by number.
+func fields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	t.Helper()
+
+	out := map[protowire.Number][][]byte{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			t.Fatalf("unexpected field %d of type %d", num, typ)
+		}
+
+		b = b[n:]
+
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("truncated field %d", num)
+		}
+
+		out[num] = append(out[num], value)
+		b = b[n:]
+	}
+
+	return out
+}
@@ -0,0 +1,141 @@
+package snmp
+
+import "sort"
+
+// Metric types understood by the native backend.
+const (
+	// TypeGauge is reported as a gauge.
+	TypeGauge = "gauge"
+	// TypeCounter32 and TypeCounter64 are reported as counters. The width,
+	// fixed by the MIB, tells where the counter wraps.
+	TypeCounter32 = "counter32"
+	TypeCounter64 = "counter64"
+	// TypeDisplayString is reported as a gauge of 1 with the string as a label
+	// named after the metric, as snmp_exporter does.
+	TypeDisplayString = "DisplayString"
+)
+
+// Metric maps an OID to a metric.
+type Metric struct {
+	Name string
+	OID  string
+	Type string
+	Help string
+}
+
+// Lookup adds the value of a table column as a label on every row.
+type Lookup struct {
+	Label string
+	OID   string
+}
+
+// Table describes the columns of an SNMP table that are walked.
+type Table struct {
+	// IndexLabel names the label holding the row index.
+	IndexLabel string
+	Lookups    []Lookup
+	Columns    []Metric
+}
+
+// Module is a named set of scalars and tables, mirroring snmp_exporter modules.
+type Module struct {
+	// Scalars are fetched with a GET of OID.0.
+	Scalars []Metric
+	Tables  []Table
+}
+
+// modules holds the built-in modules.
+var modules = map[string]Module{
+	"system": {
+		Scalars: []Metric{
+			{Name: "sysDescr", OID: "1.3.6.1.2.1.1.1", Type: TypeDisplayString, Help: "A textual description of the entity."},
+			{Name: "sysUpTime", OID: "1.3.6.1.2.1.1.3", Type: TypeGauge, Help: "The time (in hundredths of a second) since the network management portion of the system was last re-initialized."},
+			{Name: "sysContact", OID: "1.3.6.1.2.1.1.4", Type: TypeDisplayString, Help: "The contact person for this managed node."},
+			{Name: "sysName", OID: "1.3.6.1.2.1.1.5", Type: TypeDisplayString, Help: "An administratively-assigned name for this managed node."},
+			{Name: "sysLocation", OID: "1.3.6.1.2.1.1.6", Type: TypeDisplayString, Help: "The physical location of this node."},
+		},
+	},
+	"if_mib": {
+		Scalars: []Metric{
+			{Name: "sysUpTime", OID: "1.3.6.1.2.1.1.3", Type: TypeGauge, Help: "The time (in hundredths of a second) since the network management portion of the system was last re-initialized."},
+			{Name: "ifNumber", OID: "1.3.6.1.2.1.2.1", Type: TypeGauge, Help: "The number of network interfaces present on this system."},
+		},
+		Tables: []Table{
+			{
+				IndexLabel: "ifIndex",
+				Lookups: []Lookup{
+					{Label: "ifDescr", OID: "1.3.6.1.2.1.2.2.1.2"},
+					{Label: "ifName", OID: "1.3.6.1.2.1.31.1.1.1.1"},
+					{Label: "ifAlias", OID: "1.3.6.1.2.1.31.1.1.1.18"},
+				},
+				Columns: []Metric{
+					{Name: "ifMtu", OID: "1.3.6.1.2.1.2.2.1.4", Type: TypeGauge, Help: "The size of the largest packet which can be sent/received on the interface."},
+					{Name: "ifSpeed", OID: "1.3.6.1.2.1.2.2.1.5", Type: TypeGauge, Help: "An estimate of the interface's current bandwidth in bits per second."},
+					{Name: "ifAdminStatus", OID: "1.3.6.1.2.1.2.2.1.7", Type: TypeGauge, Help: "The desired state of the interface."},
+					{Name: "ifOperStatus", OID: "1.3.6.1.2.1.2.2.1.8", Type: TypeGauge, Help: "The current operational state of the interface."},
+					{Name: "ifLastChange", OID: "1.3.6.1.2.1.2.2.1.9", Type: TypeGauge, Help: "The value of sysUpTime at the time the interface entered its current operational state."},
+					{Name: "ifInOctets", OID: "1.3.6.1.2.1.2.2.1.10", Type: TypeCounter32, Help: "The total number of octets received on the interface."},
+					{Name: "ifInUcastPkts", OID: "1.3.6.1.2.1.2.2.1.11", Type: TypeCounter32, Help: "The number of unicast packets delivered to a higher-layer protocol."},
+					{Name: "ifInDiscards", OID: "1.3.6.1.2.1.2.2.1.13", Type: TypeCounter32, Help: "The number of inbound packets which were discarded."},
+					{Name: "ifInErrors", OID: "1.3.6.1.2.1.2.2.1.14", Type: TypeCounter32, Help: "The number of inbound packets that contained errors."},
+					{Name: "ifOutOctets", OID: "1.3.6.1.2.1.2.2.1.16", Type: TypeCounter32, Help: "The total number of octets transmitted out of the interface."},
+					{Name: "ifOutUcastPkts", OID: "1.3.6.1.2.1.2.2.1.17", Type: TypeCounter32, Help: "The total number of unicast packets requested to be transmitted."},
+					{Name: "ifOutDiscards", OID: "1.3.6.1.2.1.2.2.1.19", Type: TypeCounter32, Help: "The number of outbound packets which were discarded."},
+					{Name: "ifOutErrors", OID: "1.3.6.1.2.1.2.2.1.20", Type: TypeCounter32, Help: "The number of outbound packets that could not be transmitted because of errors."},
+					{Name: "ifHCInOctets", OID: "1.3.6.1.2.1.31.1.1.1.6", Type: TypeCounter64, Help: "The total number of octets received on the interface (64-bit)."},
+					{Name: "ifHCInUcastPkts", OID: "1.3.6.1.2.1.31.1.1.1.7", Type: TypeCounter64, Help: "The number of unicast packets delivered to a higher-layer protocol (64-bit)."},
+					{Name: "ifHCOutOctets", OID: "1.3.6.1.2.1.31.1.1.1.10", Type: TypeCounter64, Help: "The total number of octets transmitted out of the interface (64-bit)."},
+					{Name: "ifHCOutUcastPkts", OID: "1.3.6.1.2.1.31.1.1.1.11", Type: TypeCounter64, Help: "The total number of unicast packets requested to be transmitted (64-bit)."},
+					{Name: "ifHighSpeed", OID: "1.3.6.1.2.1.31.1.1.1.15", Type: TypeGauge, Help: "An estimate of the interface's current bandwidth in units of 1,000,000 bits per second."},
+				},
+			},
+		},
+	},
+}
+
+// CounterWidths returns the width in bits of every counter of the named
+// built-in modules, by metric name. Unknown modules are ignored.
+func CounterWidths(names []string) map[string]int {
+	widths := make(map[string]int)
+
+	add := func(metrics []Metric) {
+		for _, metric := range metrics {
+			switch metric.Type {
+			case TypeCounter32:
+				widths[metric.Name] = 32
+			case TypeCounter64:
+				widths[metric.Name] = 64
+			}
+		}
+	}
+
+	for _, name := range names {
+		module := modules[name]
+
+		add(module.Scalars)
+
+		for _, table := range module.Tables {
+			add(table.Columns)
+		}
+	}
+
+	return widths
+}
+
+// HasModule reports whether a module is built in.
+func HasModule(name string) bool {
+	_, ok := modules[name]
+	return ok
+}
+
+// ModuleNames returns the names of the built-in modules.
+func ModuleNames() []string {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,419 @@
+// Package snmp polls devices directly over SNMP, producing the same metric
+// families an snmp_exporter scrape would.
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Defaults used when a target leaves them unset.
+const (
+	DefaultPort           = 161
+	DefaultTimeout        = 5 * time.Second
+	DefaultMaxRepetitions = 25
+)
+
+// Target describes how to reach a device.
+type Target struct {
+	Host      string
+	Port      int
+	Version   string
+	Community string
+	Timeout   time.Duration
+	Retries   int
+	// USM holds the SNMPv3 security settings; required for version 3.
+	USM *USM
+}
+
+// session is the subset of SNMP operations used to collect a module.
+type session interface {
+	Get(oids []string) ([]gosnmp.SnmpPDU, error)
+	Walk(root string) ([]gosnmp.SnmpPDU, error)
+}
+
+// Collector polls devices directly over SNMP.
+type Collector struct {
+	logger *slog.Logger
+}
+
+// New creates a new native SNMP collector.
+func New(logger *slog.Logger) *Collector {
+	return &Collector{logger: logger}
+}
+
+// Collect polls the given built-in modules from a device.
+func (c *Collector) Collect(ctx context.Context, target Target, moduleNames []string) (map[string]*dto.MetricFamily, error) {
+	selected := make([]Module, 0, len(moduleNames))
+	for _, name := range moduleNames {
+		module, ok := modules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown module: %s", name)
+		}
+
+		selected = append(selected, module)
+	}
+
+	client, err := newClient(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", target.Host, err)
+	}
+
+	defer func() {
+		if err := client.Conn.Close(); err != nil {
+			c.logger.Debug("closing SNMP connection", "target", target.Host, "error", err)
+		}
+	}()
+
+	return collect(&gosnmpSession{client: client}, selected)
+}
+
+// System identifies a device by its SNMPv2-MIB system group.
+type System struct {
+	ObjectID string
+	Name     string
+	Descr    string
+}
+
+// System group instances fetched by Identify.
+const (
+	oidSysDescr    = ".1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = ".1.3.6.1.2.1.1.2.0"
+	oidSysName     = ".1.3.6.1.2.1.1.5.0"
+)
+
+// Identify fetches the sysObjectID, sysName and sysDescr of a device. It
+// fails when the device does not answer or has no sysObjectID.
+func (c *Collector) Identify(ctx context.Context, target Target) (*System, error) {
+	client, err := newClient(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", target.Host, err)
+	}
+
+	defer func() {
+		if err := client.Conn.Close(); err != nil {
+			c.logger.Debug("closing SNMP connection", "target", target.Host, "error", err)
+		}
+	}()
+
+	return identify(&gosnmpSession{client: client})
+}
+
+// identify reads the system group from a session.
+func identify(sess session) (*System, error) {
+	pdus, err := sess.Get([]string{oidSysObjectID, oidSysName, oidSysDescr})
+	if err != nil {
+		return nil, err
+	}
+
+	system := &System{}
+
+	for _, pdu := range pdus {
+		switch pdu.Name {
+		case oidSysObjectID:
+			if pdu.Type == gosnmp.ObjectIdentifier {
+				system.ObjectID, _ = pdu.Value.(string)
+			}
+		case oidSysName:
+			system.Name, _ = stringValue(pdu)
+		case oidSysDescr:
+			system.Descr, _ = stringValue(pdu)
+		}
+	}
+
+	if system.ObjectID == "" {
+		return nil, fmt.Errorf("device did not return a sysObjectID")
+	}
+
+	system.ObjectID = strings.TrimPrefix(system.ObjectID, ".")
+
+	return system, nil
+}
+
+// newClient configures a gosnmp client for the target.
+func newClient(ctx context.Context, target Target) (*gosnmp.GoSNMP, error) {
+	client := &gosnmp.GoSNMP{
+		Context:        ctx,
+		Target:         target.Host,
+		Port:           uint16(target.Port),
+		Transport:      "udp",
+		Community:      target.Community,
+		Timeout:        target.Timeout,
+		Retries:        target.Retries,
+		MaxOids:        gosnmp.MaxOids,
+		MaxRepetitions: DefaultMaxRepetitions,
+	}
+
+	if client.Port == 0 {
+		client.Port = DefaultPort
+	}
+
+	if client.Timeout <= 0 {
+		client.Timeout = DefaultTimeout
+	}
+
+	switch target.Version {
+	case "1":
+		client.Version = gosnmp.Version1
+	case "", "2c":
+		client.Version = gosnmp.Version2c
+	case "3":
+		if target.USM == nil {
+			return nil, fmt.Errorf("SNMPv3 requires USM settings")
+		}
+
+		if err := target.USM.apply(client); err != nil {
+			return nil, fmt.Errorf("configuring USM: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version: %s", target.Version)
+	}
+
+	return client, nil
+}
+
+// gosnmpSession adapts a gosnmp client to the session interface.
+type gosnmpSession struct {
+	client *gosnmp.GoSNMP
+}
+
+func (s *gosnmpSession) Get(oids []string) ([]gosnmp.SnmpPDU, error) {
+	var pdus []gosnmp.SnmpPDU
+
+	// Devices reject requests with more varbinds than MaxOids.
+	for start := 0; start < len(oids); start += s.client.MaxOids {
+		end := min(start+s.client.MaxOids, len(oids))
+
+		packet, err := s.client.Get(oids[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		pdus = append(pdus, packet.Variables...)
+	}
+
+	return pdus, nil
+}
+
+func (s *gosnmpSession) Walk(root string) ([]gosnmp.SnmpPDU, error) {
+	// GETBULK does not exist in SNMPv1.
+	if s.client.Version == gosnmp.Version1 {
+		return s.client.WalkAll(root)
+	}
+
+	return s.client.BulkWalkAll(root)
+}
+
+// collect fetches every scalar and table of the modules.
+func collect(sess session, selected []Module) (map[string]*dto.MetricFamily, error) {
+	families := make(map[string]*dto.MetricFamily)
+
+	// Modules may share scalars such as sysUpTime; fetch each once.
+	scalars := make(map[string]Metric)
+
+	for _, module := range selected {
+		for _, metric := range module.Scalars {
+			scalars["."+metric.OID+".0"] = metric
+		}
+	}
+
+	if len(scalars) > 0 {
+		oids := make([]string, 0, len(scalars))
+		for oid := range scalars {
+			oids = append(oids, oid)
+		}
+
+		sort.Strings(oids)
+
+		pdus, err := sess.Get(oids)
+		if err != nil {
+			return nil, fmt.Errorf("getting scalars: %w", err)
+		}
+
+		for _, pdu := range pdus {
+			if metric, ok := scalars[pdu.Name]; ok {
+				addSample(families, metric, nil, pdu)
+			}
+		}
+	}
+
+	for _, module := range selected {
+		for i := range module.Tables {
+			if err := collectTable(sess, families, &module.Tables[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return families, nil
+}
+
+// collectTable walks the lookup and metric columns of a table.
+func collectTable(sess session, families map[string]*dto.MetricFamily, table *Table) error {
+	lookups := make(map[string]map[string]string)
+
+	for _, lookup := range table.Lookups {
+		pdus, err := sess.Walk(lookup.OID)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", lookup.Label, err)
+		}
+
+		for _, pdu := range pdus {
+			value, ok := stringValue(pdu)
+			if !ok {
+				continue
+			}
+
+			index := rowIndex(lookup.OID, pdu.Name)
+			if lookups[index] == nil {
+				lookups[index] = make(map[string]string)
+			}
+
+			lookups[index][lookup.Label] = value
+		}
+	}
+
+	for _, column := range table.Columns {
+		pdus, err := sess.Walk(column.OID)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", column.Name, err)
+		}
+
+		for _, pdu := range pdus {
+			index := rowIndex(column.OID, pdu.Name)
+
+			labels := map[string]string{table.IndexLabel: index}
+			for label, value := range lookups[index] {
+				labels[label] = value
+			}
+
+			addSample(families, column, labels, pdu)
+		}
+	}
+
+	return nil
+}
+
+// rowIndex returns the index part of a column instance OID.
+func rowIndex(columnOID, name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "."), columnOID+".")
+}
+
+// addSample appends a PDU to its metric family. PDUs without a usable value,
+// such as noSuchObject, are skipped.
+func addSample(families map[string]*dto.MetricFamily, metric Metric, labels map[string]string, pdu gosnmp.SnmpPDU) {
+	m := &dto.Metric{}
+
+	var metricType dto.MetricType
+
+	switch metric.Type {
+	case TypeDisplayString:
+		value, ok := stringValue(pdu)
+		if !ok {
+			return
+		}
+
+		labels = withLabel(labels, metric.Name, value)
+		metricType = dto.MetricType_GAUGE
+		m.Gauge = &dto.Gauge{Value: proto.Float64(1)}
+	case TypeCounter32, TypeCounter64:
+		value, ok := numericValue(pdu)
+		if !ok {
+			return
+		}
+
+		metricType = dto.MetricType_COUNTER
+		m.Counter = &dto.Counter{Value: proto.Float64(value)}
+	default:
+		value, ok := numericValue(pdu)
+		if !ok {
+			return
+		}
+
+		metricType = dto.MetricType_GAUGE
+		m.Gauge = &dto.Gauge{Value: proto.Float64(value)}
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(labels[name])})
+	}
+
+	family, ok := families[metric.Name]
+	if !ok {
+		family = &dto.MetricFamily{
+			Name: proto.String(metric.Name),
+			Help: proto.String(metric.Help),
+			Type: metricType.Enum(),
+		}
+		families[metric.Name] = family
+	}
+
+	family.Metric = append(family.Metric, m)
+}
+
+// numericValue converts an integer-valued PDU.
+func numericValue(pdu gosnmp.SnmpPDU) (float64, bool) {
+	switch pdu.Type {
+	case gosnmp.Counter32, gosnmp.Counter64, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Integer, gosnmp.Uinteger32:
+		value, _ := new(big.Float).SetInt(gosnmp.ToBigInt(pdu.Value)).Float64()
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+// stringValue converts an OCTET STRING PDU, replacing invalid UTF-8.
+func stringValue(pdu gosnmp.SnmpPDU) (string, bool) {
+	if pdu.Type != gosnmp.OctetString {
+		return "", false
+	}
+
+	b, ok := pdu.Value.([]byte)
+	if !ok {
+		return "", false
+	}
+
+	s := string(b)
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+
+	return s, true
+}
+
+// withLabel returns a copy of labels with name set to value.
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+
+	result[name] = value
+
+	return result
+}
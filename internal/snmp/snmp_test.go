@@ -0,0 +1,156 @@
+package snmp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeSession serves a fixed set of PDUs.
+type fakeSession struct {
+	pdus  []gosnmp.SnmpPDU
+	gets  int
+	walks []string
+}
+
+func (f *fakeSession) Get(oids []string) ([]gosnmp.SnmpPDU, error) {
+	f.gets++
+
+	var result []gosnmp.SnmpPDU
+
+	for _, oid := range oids {
+		found := false
+
+		for _, pdu := range f.pdus {
+			if pdu.Name == oid {
+				result = append(result, pdu)
+				found = true
+			}
+		}
+
+		if !found {
+			result = append(result, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.NoSuchObject})
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeSession) Walk(root string) ([]gosnmp.SnmpPDU, error) {
+	f.walks = append(f.walks, root)
+
+	var result []gosnmp.SnmpPDU
+
+	for _, pdu := range f.pdus {
+		if strings.HasPrefix(pdu.Name, "."+root+".") {
+			result = append(result, pdu)
+		}
+	}
+
+	return result, nil
+}
+
+func TestCollect(t *testing.T) {
+	sess := &fakeSession{pdus: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("Cisco IOS")},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(123456)},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: []byte("Gi0/1")},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: []byte("Gi0/2")},
+		{Name: ".1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint(1000)},
+		{Name: ".1.3.6.1.2.1.2.2.1.10.2", Type: gosnmp.Counter32, Value: uint(2000)},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(1 << 40)},
+	}}
+
+	families, err := collect(sess, []Module{modules["system"], modules["if_mib"]})
+	if err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+
+	if sess.gets != 1 {
+		t.Errorf("expected scalars to be fetched in one request, got %d", sess.gets)
+	}
+
+	uptime := families["sysUpTime"]
+	if uptime == nil || len(uptime.Metric) != 1 || uptime.Metric[0].GetGauge().GetValue() != 123456 {
+		t.Fatalf("expected a single sysUpTime sample shared by both modules, got %v", uptime)
+	}
+
+	descr := families["sysDescr"]
+	if descr == nil || descr.Metric[0].GetGauge().GetValue() != 1 || descr.Metric[0].Label[0].GetValue() != "Cisco IOS" {
+		t.Errorf("unexpected sysDescr family: %v", descr)
+	}
+
+	if _, ok := families["sysContact"]; ok {
+		t.Error("expected missing objects to be skipped")
+	}
+
+	octets := families["ifInOctets"]
+	if octets == nil || octets.GetType() != dto.MetricType_COUNTER || len(octets.Metric) != 2 {
+		t.Fatalf("unexpected ifInOctets family: %v", octets)
+	}
+
+	labels := make(map[string]string)
+	for _, l := range octets.Metric[1].Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	if labels["ifIndex"] != "2" || labels["ifDescr"] != "Gi0/2" || octets.Metric[1].GetCounter().GetValue() != 2000 {
+		t.Errorf("unexpected ifInOctets sample: %v %v", labels, octets.Metric[1].GetCounter().GetValue())
+	}
+
+	if hc := families["ifHCInOctets"]; hc == nil || hc.Metric[0].GetCounter().GetValue() != 1<<40 {
+		t.Errorf("unexpected ifHCInOctets family: %v", hc)
+	}
+}
+
+func TestCounterWidths(t *testing.T) {
+	widths := CounterWidths([]string{"if_mib", "unknown"})
+
+	for name, want := range map[string]int{"ifInOctets": 32, "ifHCInOctets": 64, "sysUpTime": 0, "unknown": 0} {
+		if got := widths[name]; got != want {
+			t.Errorf("CounterWidths(if_mib)[%s] = %d, want %d", name, got, want)
+		}
+	}
+
+	if widths := CounterWidths([]string{"system"}); len(widths) != 0 {
+		t.Errorf("CounterWidths(system) = %v, want no counters", widths)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	sess := &fakeSession{pdus: []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9.1.1208"},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("switch01")},
+	}}
+
+	system, err := identify(sess)
+	if err != nil {
+		t.Fatalf("identify() error = %v", err)
+	}
+
+	if system.ObjectID != "1.3.6.1.4.1.9.1.1208" || system.Name != "switch01" || system.Descr != "" {
+		t.Errorf("unexpected system: %+v", system)
+	}
+
+	if _, err := identify(&fakeSession{}); err == nil {
+		t.Error("expected an error when the device has no sysObjectID")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := newClient(context.Background(), Target{Host: "switch01", Version: "1"})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	if client.Port != DefaultPort || client.Timeout != DefaultTimeout || client.Version != gosnmp.Version1 {
+		t.Errorf("unexpected client defaults: port %d, timeout %s, version %s", client.Port, client.Timeout, client.Version)
+	}
+
+	if _, err := newClient(context.Background(), Target{Host: "switch01", Version: "4"}); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+}
@@ -0,0 +1,182 @@
+package snmp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMPv3 security levels.
+const (
+	LevelNoAuthNoPriv = "noAuthNoPriv"
+	LevelAuthNoPriv   = "authNoPriv"
+	LevelAuthPriv     = "authPriv"
+)
+
+// minPassphraseLength is the shortest passphrase USM accepts (RFC 3414).
+const minPassphraseLength = 8
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// USM holds SNMPv3 user-based security model settings. Protocol names are
+// case-insensitive; the authoritative engine is discovered on each session.
+type USM struct {
+	SecurityName  string
+	SecurityLevel string
+	AuthProtocol  string
+	AuthPassword  string
+	PrivProtocol  string
+	PrivPassword  string
+	ContextName   string
+	// ContextEngineID is hex encoded; empty means the authoritative engine.
+	ContextEngineID string
+}
+
+// Validate checks that the settings are complete for the security level.
+func (u *USM) Validate() error {
+	_, err := u.msgFlags()
+	if err != nil {
+		return err
+	}
+
+	if u.SecurityName == "" {
+		return fmt.Errorf("security name is required")
+	}
+
+	if u.requiresAuth() {
+		if _, ok := authProtocols[strings.ToUpper(u.AuthProtocol)]; !ok {
+			return fmt.Errorf("invalid auth protocol: %q", u.AuthProtocol)
+		}
+
+		if len(u.AuthPassword) < minPassphraseLength {
+			return fmt.Errorf("auth password must be at least %d characters", minPassphraseLength)
+		}
+	}
+
+	if u.SecurityLevel == LevelAuthPriv {
+		if _, ok := privProtocols[strings.ToUpper(u.PrivProtocol)]; !ok {
+			return fmt.Errorf("invalid priv protocol: %q", u.PrivProtocol)
+		}
+
+		if len(u.PrivPassword) < minPassphraseLength {
+			return fmt.Errorf("priv password must be at least %d characters", minPassphraseLength)
+		}
+	}
+
+	if _, err := u.contextEngineID(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u *USM) requiresAuth() bool {
+	return u.SecurityLevel == LevelAuthNoPriv || u.SecurityLevel == LevelAuthPriv
+}
+
+func (u *USM) msgFlags() (gosnmp.SnmpV3MsgFlags, error) {
+	switch u.SecurityLevel {
+	case LevelNoAuthNoPriv:
+		return gosnmp.NoAuthNoPriv, nil
+	case LevelAuthNoPriv:
+		return gosnmp.AuthNoPriv, nil
+	case LevelAuthPriv:
+		return gosnmp.AuthPriv, nil
+	default:
+		return 0, fmt.Errorf("invalid security level: %q", u.SecurityLevel)
+	}
+}
+
+func (u *USM) contextEngineID() (string, error) {
+	if u.ContextEngineID == "" {
+		return "", nil
+	}
+
+	id, err := decodeEngineID(u.ContextEngineID)
+	if err != nil {
+		return "", fmt.Errorf("invalid context engine ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// apply configures a gosnmp client for SNMPv3.
+func (u *USM) apply(client *gosnmp.GoSNMP) error {
+	params, err := u.SecurityParameters("")
+	if err != nil {
+		return err
+	}
+
+	flags, _ := u.msgFlags()
+	engineID, _ := u.contextEngineID()
+
+	client.Version = gosnmp.Version3
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.MsgFlags = flags
+	client.SecurityParameters = params
+	client.ContextName = u.ContextName
+	client.ContextEngineID = engineID
+
+	return nil
+}
+
+// SecurityParameters returns the gosnmp security parameters for the user.
+// The hex encoded authoritative engine ID may be empty when it is discovered
+// on the session; notifications received from an agent need the agent's.
+func (u *USM) SecurityParameters(authoritativeEngineID string) (*gosnmp.UsmSecurityParameters, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	engineID, err := decodeEngineID(authoritativeEngineID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authoritative engine ID: %w", err)
+	}
+
+	params := &gosnmp.UsmSecurityParameters{
+		UserName:               u.SecurityName,
+		AuthoritativeEngineID:  engineID,
+		AuthenticationProtocol: gosnmp.NoAuth,
+		PrivacyProtocol:        gosnmp.NoPriv,
+	}
+
+	if u.requiresAuth() {
+		params.AuthenticationProtocol = authProtocols[strings.ToUpper(u.AuthProtocol)]
+		params.AuthenticationPassphrase = u.AuthPassword
+	}
+
+	if u.SecurityLevel == LevelAuthPriv {
+		params.PrivacyProtocol = privProtocols[strings.ToUpper(u.PrivProtocol)]
+		params.PrivacyPassphrase = u.PrivPassword
+	}
+
+	return params, nil
+}
+
+// decodeEngineID decodes a hex engine ID with an optional 0x prefix.
+func decodeEngineID(s string) (string, error) {
+	id, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x"))
+	if err != nil {
+		return "", err
+	}
+
+	return string(id), nil
+}
@@ -0,0 +1,106 @@
+package snmp
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestUSM_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		usm     USM
+		wantErr bool
+	}{
+		{
+			name: "noAuthNoPriv",
+			usm:  USM{SecurityName: "monitor", SecurityLevel: LevelNoAuthNoPriv},
+		},
+		{
+			name: "authPriv",
+			usm: USM{
+				SecurityName:  "monitor",
+				SecurityLevel: LevelAuthPriv,
+				AuthProtocol:  "sha256",
+				AuthPassword:  "authpassword",
+				PrivProtocol:  "AES",
+				PrivPassword:  "privpassword",
+			},
+		},
+		{
+			name:    "missing security name",
+			usm:     USM{SecurityLevel: LevelNoAuthNoPriv},
+			wantErr: true,
+		},
+		{
+			name:    "invalid security level",
+			usm:     USM{SecurityName: "monitor", SecurityLevel: "authOnly"},
+			wantErr: true,
+		},
+		{
+			name:    "short auth password",
+			usm:     USM{SecurityName: "monitor", SecurityLevel: LevelAuthNoPriv, AuthProtocol: "SHA", AuthPassword: "short"},
+			wantErr: true,
+		},
+		{
+			name: "unknown priv protocol",
+			usm: USM{
+				SecurityName:  "monitor",
+				SecurityLevel: LevelAuthPriv,
+				AuthProtocol:  "SHA",
+				AuthPassword:  "authpassword",
+				PrivProtocol:  "3DES",
+				PrivPassword:  "privpassword",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid context engine ID",
+			usm:     USM{SecurityName: "monitor", SecurityLevel: LevelNoAuthNoPriv, ContextEngineID: "xyz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.usm.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUSM_apply(t *testing.T) {
+	usm := USM{
+		SecurityName:    "monitor",
+		SecurityLevel:   LevelAuthPriv,
+		AuthProtocol:    "SHA512",
+		AuthPassword:    "authpassword",
+		PrivProtocol:    "AES256C",
+		PrivPassword:    "privpassword",
+		ContextName:     "vlan-10",
+		ContextEngineID: "0x80001f8880",
+	}
+
+	client := &gosnmp.GoSNMP{}
+	if err := usm.apply(client); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	params, ok := client.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		t.Fatalf("expected USM security parameters, got %T", client.SecurityParameters)
+	}
+
+	if client.Version != gosnmp.Version3 || client.MsgFlags != gosnmp.AuthPriv || client.ContextName != "vlan-10" {
+		t.Errorf("unexpected client settings: version %s, flags %s, context %q", client.Version, client.MsgFlags, client.ContextName)
+	}
+
+	if client.ContextEngineID != "\x80\x00\x1f\x88\x80" {
+		t.Errorf("unexpected context engine ID %x", client.ContextEngineID)
+	}
+
+	if params.UserName != "monitor" || params.AuthenticationProtocol != gosnmp.SHA512 || params.PrivacyProtocol != gosnmp.AES256C {
+		t.Errorf("unexpected security parameters: %+v", params)
+	}
+}
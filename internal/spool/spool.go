@@ -0,0 +1,489 @@
+// Package spool keeps documents in segment files on disk until they have
+// been indexed, so that metrics collected while Elasticsearch is unavailable
+// are written once it recovers instead of being lost.
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+const (
+	// DefaultSegmentSize is the size at which a segment is sealed.
+	DefaultSegmentSize = 16 << 20
+	// DefaultMaxSize bounds the space taken by all segments.
+	DefaultMaxSize = 1 << 30
+	// DefaultMaxAge is how long spooled documents are kept.
+	DefaultMaxAge = 24 * time.Hour
+
+	// segmentExt is the extension of segment files.
+	segmentExt = ".seg"
+)
+
+// Config controls the spool. Zero values select the defaults.
+type Config struct {
+	Dir string
+	// SegmentSize is the size in bytes at which a segment is sealed.
+	SegmentSize int64
+	// MaxSize is the total size in bytes of all segments; the oldest are
+	// dropped beyond it.
+	MaxSize int64
+	// MaxAge drops segments whose newest document was spooled longer ago.
+	MaxAge time.Duration
+}
+
+// Validate checks the configuration.
+func (c Config) Validate() error {
+	c.setDefaults()
+
+	if c.Dir == "" {
+		return fmt.Errorf("spool directory must be specified")
+	}
+
+	if c.SegmentSize < 1 {
+		return fmt.Errorf("segment size must be positive")
+	}
+
+	if c.MaxSize < c.SegmentSize {
+		return fmt.Errorf("maximum size must be at least the segment size")
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("maximum age cannot be negative")
+	}
+
+	return nil
+}
+
+// setDefaults fills in unset values.
+func (c *Config) setDefaults() {
+	if c.SegmentSize == 0 {
+		c.SegmentSize = DefaultSegmentSize
+	}
+
+	if c.MaxSize == 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+
+	if c.MaxAge == 0 {
+		c.MaxAge = DefaultMaxAge
+	}
+}
+
+// record is a line of a segment file: the documents of one append.
+type record struct {
+	SpooledAt time.Time         `json:"spooled_at"`
+	Documents []schema.Document `json:"documents"`
+}
+
+// segment is a spool file. Documents are appended to the newest segment
+// until it is sealed; sealed segments are replayed oldest first.
+type segment struct {
+	seq       uint64
+	path      string
+	size      int64
+	documents int
+	oldest    time.Time
+	newest    time.Time
+}
+
+// Stats describes the spooled backlog.
+type Stats struct {
+	Segments  int
+	Bytes     int64
+	Documents int
+	// Oldest is when the oldest spooled document was written.
+	Oldest time.Time
+	// Dropped counts documents discarded by the size and age caps.
+	Dropped int
+}
+
+// Spool is a durable first-in, first-out queue of documents.
+type Spool struct {
+	cfg    Config
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	segments []*segment
+	active   *os.File
+	nextSeq  uint64
+	dropped  int
+}
+
+// WithClock sets the clock used to stamp and expire documents.
+func WithClock(now func() time.Time) func(*Spool) {
+	return func(s *Spool) {
+		s.now = now
+	}
+}
+
+// Open opens the spool in the configured directory, picking up segments left
+// by a previous run.
+func Open(cfg Config, logger *slog.Logger, opts ...func(*Spool)) (*Spool, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.setDefaults()
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	s := &Spool{
+		cfg:     cfg,
+		logger:  logger,
+		now:     time.Now,
+		nextSeq: 1,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load indexes the segment files in the spool directory.
+func (s *Spool) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.cfg.Dir, "*"+segmentExt))
+	if err != nil {
+		return fmt.Errorf("listing segments: %w", err)
+	}
+
+	for _, path := range paths {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		seg := &segment{seq: seq, path: path}
+
+		if err := s.scan(seg); err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, seg)
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+
+	if len(s.segments) > 0 {
+		s.logger.Info("found spooled documents",
+			"segments", len(s.segments),
+			"documents", s.stats().Documents,
+		)
+	}
+
+	return nil
+}
+
+// scan reads the size, document count and age of a segment file.
+func (s *Spool) scan(seg *segment) error {
+	var documents int
+
+	corrupt, err := readRecords(seg.path, func(rec *record) {
+		if seg.oldest.IsZero() {
+			seg.oldest = rec.SpooledAt
+		}
+
+		seg.newest = rec.SpooledAt
+		documents += len(rec.Documents)
+	})
+	if err != nil {
+		return err
+	}
+
+	if corrupt > 0 {
+		s.logger.Warn("skipping corrupt spool records", "segment", filepath.Base(seg.path), "records", corrupt)
+	}
+
+	info, err := os.Stat(seg.path)
+	if err != nil {
+		return fmt.Errorf("reading segment: %w", err)
+	}
+
+	seg.size = info.Size()
+	seg.documents = documents
+
+	if seg.oldest.IsZero() {
+		seg.oldest, seg.newest = info.ModTime(), info.ModTime()
+	}
+
+	return nil
+}
+
+// Append durably adds documents to the spool.
+func (s *Spool) Append(docs []schema.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	now := s.now()
+
+	line, err := json.Marshal(record{SpooledAt: now, Documents: docs})
+	if err != nil {
+		return fmt.Errorf("marshaling documents: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		if err := s.create(now); err != nil {
+			return err
+		}
+	}
+
+	seg := s.segments[len(s.segments)-1]
+
+	if _, err := s.active.Write(line); err != nil {
+		return fmt.Errorf("writing segment: %w", err)
+	}
+
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("syncing segment: %w", err)
+	}
+
+	seg.size += int64(len(line))
+	seg.documents += len(docs)
+	seg.newest = now
+
+	if seg.size >= s.cfg.SegmentSize {
+		if err := s.seal(); err != nil {
+			return err
+		}
+	}
+
+	s.enforce(now)
+
+	return nil
+}
+
+// create starts a new active segment. The caller must hold s.mu.
+func (s *Spool) create(now time.Time) error {
+	path := filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentExt))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating segment: %w", err)
+	}
+
+	s.active = f
+	s.segments = append(s.segments, &segment{seq: s.nextSeq, path: path, oldest: now, newest: now})
+	s.nextSeq++
+
+	return nil
+}
+
+// Seal closes the active segment so that it can be replayed.
+func (s *Spool) Seal() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.seal()
+}
+
+// seal closes the active segment, if any. The caller must hold s.mu.
+func (s *Spool) seal() error {
+	if s.active == nil {
+		return nil
+	}
+
+	err := s.active.Close()
+	s.active = nil
+
+	if err != nil {
+		return fmt.Errorf("closing segment: %w", err)
+	}
+
+	return nil
+}
+
+// enforce drops the oldest sealed segments beyond the size and age caps.
+// The caller must hold s.mu.
+func (s *Spool) enforce(now time.Time) {
+	for len(s.sealed()) > 0 {
+		seg := s.segments[0]
+		total := s.stats().Bytes
+
+		if total <= s.cfg.MaxSize && now.Sub(seg.newest) <= s.cfg.MaxAge {
+			return
+		}
+
+		s.logger.Warn("dropping spooled documents",
+			"segment", filepath.Base(seg.path),
+			"documents", seg.documents,
+			"spooled_at", seg.oldest,
+		)
+
+		s.dropped += seg.documents
+		s.remove(seg)
+	}
+}
+
+// Expire drops segments past the age cap. Caps are also enforced on append.
+func (s *Spool) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforce(s.now())
+}
+
+// sealed returns the segments that are no longer written to, oldest first.
+// The caller must hold s.mu.
+func (s *Spool) sealed() []*segment {
+	if s.active != nil {
+		return s.segments[:len(s.segments)-1]
+	}
+
+	return s.segments
+}
+
+// remove deletes a segment file. The caller must hold s.mu.
+func (s *Spool) remove(seg *segment) {
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Error("removing segment", "segment", seg.path, "error", err)
+	}
+
+	for i := range s.segments {
+		if s.segments[i] == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+// Replay passes the documents of each sealed segment, oldest first, to fn
+// and deletes the segment once fn succeeds. It stops at the first error,
+// leaving that segment to be replayed again.
+func (s *Spool) Replay(fn func(docs []schema.Document) error) (int, error) {
+	replayed := 0
+
+	for {
+		s.mu.Lock()
+		sealed := s.sealed()
+
+		if len(sealed) == 0 {
+			s.mu.Unlock()
+			return replayed, nil
+		}
+
+		seg := sealed[0]
+		s.mu.Unlock()
+
+		var docs []schema.Document
+
+		corrupt, err := readRecords(seg.path, func(rec *record) {
+			docs = append(docs, rec.Documents...)
+		})
+		if err != nil {
+			return replayed, err
+		}
+
+		if corrupt > 0 {
+			s.logger.Warn("skipping corrupt spool records", "segment", filepath.Base(seg.path), "records", corrupt)
+		}
+
+		if err := fn(docs); err != nil {
+			return replayed, err
+		}
+
+		s.mu.Lock()
+		s.remove(seg)
+		s.mu.Unlock()
+
+		replayed += len(docs)
+	}
+}
+
+// Stats returns the size of the backlog.
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats()
+}
+
+// stats sums the segments. The caller must hold s.mu.
+func (s *Spool) stats() Stats {
+	st := Stats{Segments: len(s.segments), Dropped: s.dropped}
+
+	for _, seg := range s.segments {
+		st.Bytes += seg.size
+		st.Documents += seg.documents
+	}
+
+	if len(s.segments) > 0 {
+		st.Oldest = s.segments[0].oldest
+	}
+
+	return st
+}
+
+// Close closes the active segment. Spooled documents stay on disk.
+func (s *Spool) Close() error {
+	return s.Seal()
+}
+
+// readRecords calls fn for every record of a segment file and returns the
+// number of records that could not be decoded. A torn record at the end of a
+// file, left by a crash during a write, is skipped.
+func readRecords(path string, fn func(*record)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("opening segment: %w", err)
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	corrupt := 0
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return corrupt, nil
+		}
+
+		if err != nil {
+			return corrupt, fmt.Errorf("reading segment: %w", err)
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			corrupt++
+			continue
+		}
+
+		fn(&rec)
+	}
+}
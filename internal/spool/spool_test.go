@@ -0,0 +1,241 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testDocuments(device string, n int) []schema.Document {
+	docs := make([]schema.Document, n)
+	for i := range docs {
+		docs[i] = schema.Document{
+			Timestamp: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			Device:    schema.DeviceInfo{ID: device},
+			Metric:    &schema.Sample{Name: "ifInOctets", Value: float64(i)},
+		}
+	}
+
+	return docs
+}
+
+// deviceIDs returns the device of every document, in order.
+func deviceIDs(docs []schema.Document) []string {
+	ids := make([]string, len(docs))
+	for i := range docs {
+		ids[i] = docs[i].Device.ID
+	}
+
+	return ids
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(Config{Dir: dir}, testLogger())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for _, device := range []string{"a", "b"} {
+		if err := s.Append(testDocuments(device, 2)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+
+		if err := s.Seal(); err != nil {
+			t.Fatalf("Seal() error = %v", err)
+		}
+	}
+
+	if err := s.Append(testDocuments("c", 1)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if st := s.Stats(); st.Segments != 3 || st.Documents != 5 || st.Oldest.IsZero() {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// A failed replay keeps the segment for the next attempt.
+	var replayed []string
+
+	n, err := s.Replay(func(docs []schema.Document) error {
+		if docs[0].Device.ID == "b" {
+			return errors.New("unavailable")
+		}
+
+		replayed = append(replayed, deviceIDs(docs)...)
+
+		return nil
+	})
+	if err == nil || n != 2 {
+		t.Fatalf("expected replay to stop after 2 documents, got %d, %v", n, err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// A torn record left by a crash is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, "00000000000000000003.seg"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+
+	if _, err := f.WriteString(`{"spooled_at":"2024-01-01T00:00:00Z","documents":[{`); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+
+	f.Close()
+
+	// Reopening picks up where the previous run stopped, in order.
+	s, err = Open(Config{Dir: dir}, testLogger())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if err := s.Append(testDocuments("d", 1)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if err := s.Seal(); err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	if _, err := s.Replay(func(docs []schema.Document) error {
+		replayed = append(replayed, deviceIDs(docs)...)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	want := []string{"a", "a", "b", "b", "c", "d"}
+	if len(replayed) != len(want) {
+		t.Fatalf("replayed %v, want %v", replayed, want)
+	}
+
+	for i := range want {
+		if replayed[i] != want[i] {
+			t.Fatalf("replayed %v, want %v", replayed, want)
+		}
+	}
+
+	if st := s.Stats(); st.Segments != 0 || st.Documents != 0 {
+		t.Errorf("expected an empty spool, got %+v", st)
+	}
+}
+
+func TestSpoolCaps(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := Open(Config{Dir: t.TempDir(), SegmentSize: 1, MaxSize: 4096, MaxAge: time.Hour}, testLogger(),
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Every append fills a segment; the oldest are dropped beyond MaxSize.
+	for range 50 {
+		if err := s.Append(testDocuments("a", 2)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	st := s.Stats()
+	if st.Bytes > 4096 || st.Dropped == 0 || st.Documents+st.Dropped != 100 {
+		t.Fatalf("expected the size cap to drop documents, got %+v", st)
+	}
+
+	now = now.Add(2 * time.Hour)
+	s.Expire()
+
+	if st := s.Stats(); st.Segments != 0 || st.Dropped != 100 {
+		t.Errorf("expected the age cap to drop everything, got %+v", st)
+	}
+}
+
+// flakySender fails until it is told to recover.
+type flakySender struct {
+	mu      sync.Mutex
+	healthy bool
+	sent    []string
+}
+
+func (f *flakySender) Send(_ context.Context, docs []schema.Document) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.healthy {
+		return errors.New("connection refused")
+	}
+
+	f.sent = append(f.sent, deviceIDs(docs)...)
+
+	return nil
+}
+
+func (f *flakySender) Close() error {
+	return nil
+}
+
+func (f *flakySender) devices() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.sent...)
+}
+
+func TestWriter(t *testing.T) {
+	s, err := Open(Config{Dir: t.TempDir()}, testLogger())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	sender := &flakySender{}
+	w := NewWriter(s, sender, 10*time.Millisecond, testLogger())
+
+	ctx := context.Background()
+	for _, device := range []string{"a", "b", "c"} {
+		if err := w.Write(ctx, testDocuments(device, 1)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if sent := sender.devices(); len(sent) != 0 || s.Stats().Documents != 3 {
+		t.Fatalf("expected documents to stay spooled, sent %v", sent)
+	}
+
+	sender.mu.Lock()
+	sender.healthy = true
+	sender.mu.Unlock()
+
+	if err := w.WriteOne(ctx, testDocuments("d", 1)[0]); err != nil {
+		t.Fatalf("WriteOne() error = %v", err)
+	}
+
+	// Close makes a last attempt regardless of the retry backoff.
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if sent := sender.devices(); len(sent) != 4 || sent[0] != "a" || sent[3] != "d" {
+		t.Errorf("expected the backlog to be replayed in order, got %v", sent)
+	}
+
+	if st := s.Stats(); st.Documents != 0 {
+		t.Errorf("expected an empty spool, got %+v", st)
+	}
+}
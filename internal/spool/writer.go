@@ -0,0 +1,169 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// DefaultFlushInterval is how often spooled documents are sent.
+const DefaultFlushInterval = 5 * time.Second
+
+// maxRetryInterval caps the wait between attempts while the sender fails.
+const maxRetryInterval = time.Minute
+
+// Sender indexes documents synchronously.
+type Sender interface {
+	// Send returns once the documents are indexed, or with an error if they
+	// should be sent again.
+	Send(ctx context.Context, docs []schema.Document) error
+
+	// Close releases the sender's resources.
+	Close() error
+}
+
+// Writer is an elasticsearch.Writer that appends documents to the spool and
+// sends them on in the background, in the order they were written. While
+// the sender fails, documents accumulate on disk and are replayed once it
+// recovers.
+type Writer struct {
+	spool    *Spool
+	sender   Sender
+	interval time.Duration
+	logger   *slog.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewWriter starts sending spooled documents every interval.
+func NewWriter(spool *Spool, sender Sender, interval time.Duration, logger *slog.Logger) *Writer {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &Writer{
+		spool:    spool,
+		sender:   sender,
+		interval: interval,
+		logger:   logger,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go w.run(ctx)
+
+	return w
+}
+
+// Write implements elasticsearch.Writer.
+func (w *Writer) Write(_ context.Context, docs []schema.Document) error {
+	if err := w.spool.Append(docs); err != nil {
+		return fmt.Errorf("spooling documents: %w", err)
+	}
+
+	return nil
+}
+
+// WriteOne implements elasticsearch.Writer.
+func (w *Writer) WriteOne(ctx context.Context, doc schema.Document) error {
+	return w.Write(ctx, []schema.Document{doc})
+}
+
+// Close stops sending, makes a last attempt to send the backlog and closes
+// the sender. Documents that could not be sent stay spooled for the next run.
+func (w *Writer) Close() error {
+	var err error
+
+	w.once.Do(func() {
+		w.cancel()
+		<-w.done
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+		defer cancel()
+
+		if _, flushErr := w.flush(ctx); flushErr != nil {
+			w.logger.Warn("documents left in spool", "error", flushErr, "documents", w.spool.Stats().Documents)
+		}
+
+		if closeErr := w.spool.Close(); closeErr != nil {
+			err = closeErr
+		}
+
+		if closeErr := w.sender.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	})
+
+	return err
+}
+
+// run sends the backlog every interval, backing off while the sender fails.
+func (w *Writer) run(ctx context.Context) {
+	defer close(w.done)
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = w.interval
+	b.MaxInterval = maxRetryInterval
+	b.MaxElapsedTime = 0
+
+	timer := time.NewTimer(w.interval)
+	defer timer.Stop()
+
+	failing := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		w.spool.Expire()
+
+		next := w.interval
+
+		sent, err := w.flush(ctx)
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			failing = true
+			next = b.NextBackOff()
+
+			w.logger.Warn("sending spooled documents",
+				"error", err,
+				"backlog", w.spool.Stats().Documents,
+				"retry_in", next,
+			)
+		case failing:
+			failing = false
+			b.Reset()
+
+			w.logger.Info("replayed spooled documents", "documents", sent)
+		}
+
+		timer.Reset(next)
+	}
+}
+
+// flush seals the active segment and sends every sealed segment in order,
+// returning the number of documents sent.
+func (w *Writer) flush(ctx context.Context) (int, error) {
+	if err := w.spool.Seal(); err != nil {
+		return 0, err
+	}
+
+	return w.spool.Replay(func(docs []schema.Document) error {
+		return w.sender.Send(ctx, docs)
+	})
+}
@@ -0,0 +1,154 @@
+// Package telemetry exposes the getter's own operational metrics.
+package telemetry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Namespace prefixes every metric exported by the getter.
+const Namespace = "snmp_getter"
+
+// Scrape outcomes used for the outcome label.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeSkipped = "skipped"
+)
+
+// Metrics holds the collectors describing the getter's behaviour.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	// ScrapeDuration observes the time taken to scrape a device, by device and module.
+	ScrapeDuration *prometheus.HistogramVec
+	// Scrapes counts scrape attempts by device, outcome and error class.
+	Scrapes *prometheus.CounterVec
+	// ExporterRequests counts exporter HTTP responses by status code and method.
+	ExporterRequests *prometheus.CounterVec
+	// WriteDuration observes the latency of Elasticsearch writes.
+	WriteDuration prometheus.Histogram
+	// WriteErrors counts failed Elasticsearch writes.
+	WriteErrors prometheus.Counter
+	// Traps counts received SNMP traps and informs by outcome.
+	Traps *prometheus.CounterVec
+	// SinkWrites counts documents written to each output sink by outcome.
+	SinkWrites *prometheus.CounterVec
+	// SinkDrops counts documents dropped because a sink's queue was full, by sink.
+	SinkDrops *prometheus.CounterVec
+	// ConfigReloads counts bootstrap configuration reloads by outcome.
+	ConfigReloads *prometheus.CounterVec
+	// BreakerState reports the circuit breakers that are not closed, by scope and key.
+	BreakerState *prometheus.GaugeVec
+	// BreakerTransitions counts circuit breaker changes of state by scope and new state.
+	BreakerTransitions *prometheus.CounterVec
+}
+
+// NewMetrics creates and registers the getter's metrics on a new registry.
+func NewMetrics() *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	m := &Metrics{
+		registry: reg,
+		ScrapeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "scrape_duration_seconds",
+			Help:      "Time taken to collect metrics from a device, through an exporter or over SNMP.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"device", "module"}),
+		Scrapes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "scrapes_total",
+			Help:      "Scrape attempts by device, outcome and error class.",
+		}, []string{"device", "outcome", "error_class"}),
+		ExporterRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "exporter_requests_total",
+			Help:      "Exporter HTTP responses by status code.",
+		}, []string{"code", "method"}),
+		WriteDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "elasticsearch_write_duration_seconds",
+			Help:      "Latency of Elasticsearch metric writes.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		WriteErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "elasticsearch_write_errors_total",
+			Help:      "Failed Elasticsearch metric writes.",
+		}),
+		Traps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "traps_received_total",
+			Help:      "SNMP traps and informs received, by outcome.",
+		}, []string{"outcome"}),
+		SinkWrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "sink_documents_total",
+			Help:      "Documents written to output sinks, by sink and outcome.",
+		}, []string{"sink", "outcome"}),
+		SinkDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "sink_documents_dropped_total",
+			Help:      "Documents dropped because an output sink's queue was full, by sink.",
+		}, []string{"sink"}),
+		ConfigReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "config_reloads_total",
+			Help:      "Bootstrap configuration reloads, by outcome.",
+		}, []string{"outcome"}),
+		BreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "circuit_breaker_state",
+			Help:      "Circuit breakers that are not closed, by scope and key: 1 open, 2 half-open.",
+		}, []string{"scope", "key"}),
+		BreakerTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "circuit_breaker_transitions_total",
+			Help:      "Circuit breaker changes of state, by scope and new state.",
+		}, []string{"scope", "state"}),
+	}
+
+	reg.MustRegister(
+		m.ScrapeDuration,
+		m.Scrapes,
+		m.ExporterRequests,
+		m.WriteDuration,
+		m.WriteErrors,
+		m.Traps,
+		m.SinkWrites,
+		m.SinkDrops,
+		m.ConfigReloads,
+		m.BreakerState,
+		m.BreakerTransitions,
+	)
+
+	return m
+}
+
+// Registry returns the registry holding the getter's metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// GaugeFunc registers a gauge whose value is sampled from fn at scrape time.
+func (m *Metrics) GaugeFunc(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// CounterFunc registers a counter whose value is sampled from fn at scrape time.
+func (m *Metrics) CounterFunc(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
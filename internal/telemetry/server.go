@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultPath is used when no metrics path is configured.
+const DefaultPath = "/metrics"
+
+// shutdownTimeout bounds how long the server waits for open requests on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the getter's own metrics over HTTP.
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+	logger *slog.Logger
+}
+
+// NewServer creates a metrics server listening on the given port and path.
+func NewServer(port int, path string, metrics *Metrics, logger *slog.Logger) *Server {
+	if path == "" {
+		path = DefaultPath
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(metrics.Registry(), promhttp.HandlerOpts{
+		Registry: metrics.Registry(),
+	}))
+
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		logger: logger,
+	}
+}
+
+// Handle registers an additional handler on the server.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves until the context is cancelled, then shuts the server down.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.server.Addr, err)
+	}
+
+	s.logger.Info("serving telemetry", "address", listener.Addr().String())
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- s.server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+
+		return fmt.Errorf("serving telemetry: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down telemetry server: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_ServesMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.Scrapes.WithLabelValues("switch01", OutcomeSuccess, "").Inc()
+	metrics.GaugeFunc("configured_devices", "Device configurations held in the cache.", func() float64 {
+		return 3
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := NewServer(0, "/custom", metrics, logger)
+
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/custom", http.NoBody))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`snmp_getter_scrapes_total{device="switch01",error_class="",outcome="success"} 1`,
+		`snmp_getter_configured_devices 3`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics output to contain %q", want)
+		}
+	}
+}
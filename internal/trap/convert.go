@@ -0,0 +1,138 @@
+package trap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+)
+
+// Notification objects from SNMPv2-MIB (RFC 3418).
+const (
+	oidSysUpTime   = ".1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+	// oidSnmpTraps is the parent of the generic traps, coldStart to egpNeighborLoss.
+	oidSnmpTraps = ".1.3.6.1.6.3.1.1.5"
+)
+
+// genericEnterpriseSpecific is the SNMPv1 generic trap number of enterprise traps.
+const genericEnterpriseSpecific = 6
+
+// PDU names recorded on trap documents.
+const (
+	pduTrap   = "trap"
+	pduInform = "inform"
+)
+
+// convert copies a received packet into a trap. The sysUpTime and
+// snmpTrapOID varbinds of SNMPv2 notifications become fields of the trap.
+func convert(packet *gosnmp.SnmpPacket) schema.Trap {
+	trap := schema.Trap{
+		Version: packet.Version.String(),
+		PDU:     pduTrap,
+	}
+
+	if packet.PDUType == gosnmp.InformRequest {
+		trap.PDU = pduInform
+	}
+
+	if usm, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok && packet.Version == gosnmp.Version3 {
+		trap.User = usm.UserName
+	}
+
+	if packet.Version == gosnmp.Version1 {
+		trap.OID = v1TrapOID(packet.Enterprise, packet.GenericTrap, packet.SpecificTrap)
+		trap.Enterprise = normalizeOID(packet.Enterprise)
+		trap.AgentAddress = packet.AgentAddress
+		trap.Uptime = uint32(packet.Timestamp)
+	}
+
+	for _, pdu := range packet.Variables {
+		switch normalizeOID(pdu.Name) {
+		case oidSysUpTime:
+			if ticks, ok := pdu.Value.(uint32); ok {
+				trap.Uptime = ticks
+				continue
+			}
+		case oidSnmpTrapOID:
+			if oid, ok := pdu.Value.(string); ok {
+				trap.OID = normalizeOID(oid)
+				continue
+			}
+		}
+
+		trap.Variables = append(trap.Variables, variable(pdu))
+	}
+
+	return trap
+}
+
+// v1TrapOID translates an SNMPv1 trap to its snmpTrapOID (RFC 3584, 3.1).
+func v1TrapOID(enterprise string, generic, specific int) string {
+	if generic >= 0 && generic < genericEnterpriseSpecific {
+		return fmt.Sprintf("%s.%d", oidSnmpTraps, generic+1)
+	}
+
+	return fmt.Sprintf("%s.0.%d", normalizeOID(enterprise), specific)
+}
+
+// normalizeOID returns an OID with the leading dot gosnmp uses.
+func normalizeOID(oid string) string {
+	if oid == "" || strings.HasPrefix(oid, ".") {
+		return oid
+	}
+
+	return "." + oid
+}
+
+// variable converts a varbind.
+func variable(pdu gosnmp.SnmpPDU) schema.Variable {
+	v := schema.Variable{
+		OID:  normalizeOID(pdu.Name),
+		Type: pdu.Type.String(),
+	}
+
+	switch pdu.Type {
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Counter64, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		n := gosnmp.ToBigInt(pdu.Value)
+		number, _ := new(big.Float).SetInt(n).Float64()
+
+		v.Value = n.String()
+		v.Number = &number
+	case gosnmp.OctetString:
+		b, _ := pdu.Value.([]byte)
+		v.Value = octetString(b)
+	default:
+		if pdu.Value != nil {
+			v.Value = fmt.Sprint(pdu.Value)
+		}
+	}
+
+	return v
+}
+
+// octetString returns printable strings as text and anything else, such as
+// MAC addresses, as colon-separated hex.
+func octetString(b []byte) string {
+	s := string(b)
+
+	printable := utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) < 0
+
+	if printable {
+		return s
+	}
+
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = hex.EncodeToString(b[i : i+1])
+	}
+
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,136 @@
+package trap
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+)
+
+// lookupTimeout bounds the resolution of a single device host name.
+const lookupTimeout = 2 * time.Second
+
+// resolver maps notification source addresses to device configurations. The
+// address index is rebuilt whenever the cached configurations change,
+// resolving host names at that point rather than for every notification.
+// Rebuilds run in the background so that slow lookups do not hold up
+// notifications, which are resolved against the previous index meanwhile.
+// resolve is only called from the receiver's processing goroutine.
+type resolver struct {
+	configs *cache.ConfigCache
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+	logger  *slog.Logger
+	// generation is the configuration generation of the latest rebuild.
+	generation uint64
+	started    bool
+	building   atomic.Bool
+	// built is closed once the first index is in place.
+	built     chan struct{}
+	byAddress atomic.Pointer[map[string]elasticsearch.Config]
+}
+
+func newResolver(configs *cache.ConfigCache, logger *slog.Logger) *resolver {
+	return &resolver{
+		configs: configs,
+		lookup:  net.DefaultResolver.LookupIPAddr,
+		logger:  logger,
+		built:   make(chan struct{}),
+	}
+}
+
+// resolve returns the configuration of the device with the given address.
+// Only the first call waits for the index to be built.
+func (r *resolver) resolve(ctx context.Context, ip net.IP) (*elasticsearch.Config, bool) {
+	r.refresh(ctx)
+
+	select {
+	case <-r.built:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	cfg, ok := (*r.byAddress.Load())[ip.String()]
+	if !ok {
+		return nil, false
+	}
+
+	return &cfg, true
+}
+
+// refresh starts rebuilding the index if the configurations changed since the
+// latest rebuild and no rebuild is running.
+func (r *resolver) refresh(ctx context.Context) {
+	generation := r.configs.Generation()
+	if r.started && generation == r.generation {
+		return
+	}
+
+	if !r.building.CompareAndSwap(false, true) {
+		return
+	}
+
+	r.started = true
+	r.generation = generation
+
+	go func() {
+		defer r.building.Store(false)
+
+		r.rebuild(ctx)
+	}()
+}
+
+// rebuild indexes the cached configurations by address and swaps the new
+// index in. When several devices share an address the one with the lowest ID
+// wins.
+func (r *resolver) rebuild(ctx context.Context) {
+	configs := r.configs.GetAll()
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].ID < configs[j].ID
+	})
+
+	byAddress := make(map[string]elasticsearch.Config, len(configs))
+
+	for i := range configs {
+		for _, addr := range r.addresses(ctx, configs[i].SNMPSettings.Host) {
+			if _, exists := byAddress[addr]; !exists {
+				byAddress[addr] = configs[i]
+			}
+		}
+	}
+
+	if r.byAddress.Swap(&byAddress) == nil {
+		close(r.built)
+	}
+}
+
+// addresses returns the IP addresses of a device host.
+func (r *resolver) addresses(ctx context.Context, host string) []string {
+	if host == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		r.logger.Warn("resolving device host for traps", "host", host, "error", err)
+		return nil
+	}
+
+	addrs := make([]string, len(ips))
+	for i := range ips {
+		addrs[i] = ips[i].IP.String()
+	}
+
+	return addrs
+}
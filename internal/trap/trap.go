@@ -0,0 +1,275 @@
+// Package trap receives SNMP traps and informs from configured devices and
+// indexes them as alert events.
+package trap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+)
+
+// DefaultListenAddress is the standard notification port on all interfaces.
+const DefaultListenAddress = "0.0.0.0:162"
+
+// DefaultQueueSize bounds the notifications waiting to be indexed.
+const DefaultQueueSize = 1024
+
+// Outcomes of a received notification, reported to the observer.
+const (
+	OutcomeIndexed       = "indexed"
+	OutcomeRejected      = "rejected"
+	OutcomeUnknownDevice = "unknown_device"
+	OutcomeDropped       = "dropped"
+	OutcomeFailed        = "failed"
+)
+
+// User is an SNMPv3 user notifications are accepted from. EngineID is the hex
+// encoded engine ID of the sending agent; it is required to authenticate traps.
+type User struct {
+	USM      snmp.USM
+	EngineID string
+}
+
+// Config configures a Receiver.
+type Config struct {
+	// ListenAddress is the UDP address to listen on; DefaultListenAddress when empty.
+	ListenAddress string
+	// Communities lists the SNMPv1 and v2c communities accepted; empty accepts any.
+	Communities []string
+	// Users lists the SNMPv3 users accepted; SNMPv3 notifications are dropped without any.
+	Users []User
+	// QueueSize is the number of notifications buffered for indexing;
+	// DefaultQueueSize when zero.
+	QueueSize int
+}
+
+// Receiver listens for notifications, resolves the device that sent them
+// against the configuration cache and writes them as alert documents.
+type Receiver struct {
+	config      Config
+	params      *gosnmp.GoSNMP
+	devices     *resolver
+	transformer *schema.Transformer
+	writer      elasticsearch.Writer
+	logger      *slog.Logger
+	observer    func(outcome string)
+	queue       chan notification
+}
+
+// notification is a received trap waiting to be indexed.
+type notification struct {
+	trap       schema.Trap
+	receivedAt time.Time
+	source     *net.UDPAddr
+}
+
+// WithObserver registers a function called with the outcome of every notification.
+func WithObserver(observer func(outcome string)) func(*Receiver) {
+	return func(r *Receiver) {
+		r.observer = observer
+	}
+}
+
+// New creates a trap receiver.
+func New(cfg Config, configs *cache.ConfigCache, transformer *schema.Transformer, writer elasticsearch.Writer, logger *slog.Logger, opts ...func(*Receiver)) (*Receiver, error) {
+	if cfg.ListenAddress == "" {
+		cfg.ListenAddress = DefaultListenAddress
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+
+	// An empty table makes gosnmp reject SNMPv3 notifications from unknown users.
+	users := gosnmp.NewSnmpV3SecurityParametersTable(gosnmp.Logger{})
+
+	for i := range cfg.Users {
+		params, err := cfg.Users[i].USM.SecurityParameters(cfg.Users[i].EngineID)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", cfg.Users[i].USM.SecurityName, err)
+		}
+
+		if err := users.Add(params.UserName, params); err != nil {
+			return nil, fmt.Errorf("user %s: %w", cfg.Users[i].USM.SecurityName, err)
+		}
+	}
+
+	r := &Receiver{
+		config: cfg,
+		// Received packets carry their own version, but gosnmp only
+		// authenticates SNMPv3 notifications when the listener is version 3.
+		params: &gosnmp.GoSNMP{
+			Context:                     context.Background(),
+			Version:                     gosnmp.Version3,
+			Timeout:                     snmp.DefaultTimeout,
+			TrapSecurityParametersTable: users,
+		},
+		devices:     newResolver(configs, logger),
+		transformer: transformer,
+		writer:      writer,
+		logger:      logger,
+		queue:       make(chan notification, cfg.QueueSize),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
+
+// Run receives notifications until the context is cancelled. Informs are
+// acknowledged as soon as they are received.
+func (r *Receiver) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	listener := gosnmp.NewTrapListener()
+	listener.Params = r.params
+	listener.OnNewTrap = r.receive
+
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- listener.Listen(r.config.ListenAddress)
+	}()
+
+	// Closing the listener before it has opened its socket would leave it running.
+	select {
+	case <-listener.Listening():
+	case err := <-errc:
+		return fmt.Errorf("listening on %s: %w", r.config.ListenAddress, err)
+	}
+
+	r.logger.Info("receiving SNMP traps", "address", r.config.ListenAddress)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		r.process(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		listener.Close()
+		<-done
+
+		return nil
+	case err := <-errc:
+		cancel()
+		<-done
+
+		return fmt.Errorf("listening on %s: %w", r.config.ListenAddress, err)
+	}
+}
+
+// receive queues a notification. It runs on the listener goroutine, so the
+// packet is converted immediately and slow writes never block the socket.
+func (r *Receiver) receive(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	if packet.Version != gosnmp.Version3 && len(r.config.Communities) > 0 &&
+		!slices.Contains(r.config.Communities, packet.Community) {
+		r.logger.Debug("rejected trap with unknown community", "source", addr.String())
+		r.observe(OutcomeRejected)
+
+		return
+	}
+
+	n := notification{
+		trap:       convert(packet),
+		receivedAt: time.Now().UTC(),
+		source:     addr,
+	}
+
+	select {
+	case r.queue <- n:
+	default:
+		r.logger.Warn("trap queue full, dropping notification", "source", addr.String(), "oid", n.trap.OID)
+		r.observe(OutcomeDropped)
+	}
+}
+
+// process indexes queued notifications until the context is cancelled.
+func (r *Receiver) process(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-r.queue:
+			r.index(ctx, &n)
+		}
+	}
+}
+
+// index resolves the sending device and writes the notification.
+func (r *Receiver) index(ctx context.Context, n *notification) {
+	cfg, ok := r.devices.resolve(ctx, n.source.IP)
+
+	// SNMPv1 traps name their agent, which differs from the source behind a relay.
+	if !ok && n.trap.AgentAddress != "" {
+		if ip := net.ParseIP(n.trap.AgentAddress); ip != nil && !ip.IsUnspecified() {
+			cfg, ok = r.devices.resolve(ctx, ip)
+		}
+	}
+
+	if !ok {
+		r.logger.Debug("dropped trap from unknown device",
+			"source", n.source.String(),
+			"oid", n.trap.OID,
+		)
+		r.observe(OutcomeUnknownDevice)
+
+		return
+	}
+
+	source := schema.SourceInfo{IP: n.source.IP.String(), Port: n.source.Port}
+	doc := r.transformer.TrapDocument(&n.trap, n.receivedAt, cfg.SNMPSettings.Host, source, deviceInfo(cfg))
+
+	if err := r.writer.WriteOne(ctx, doc); err != nil {
+		r.logger.Error("storing trap",
+			"device", cfg.Name,
+			"oid", n.trap.OID,
+			"error", err,
+		)
+		r.observe(OutcomeFailed)
+
+		return
+	}
+
+	r.logger.Debug("queued trap",
+		"device", cfg.Name,
+		"oid", n.trap.OID,
+		"pdu", n.trap.PDU,
+		"variables", len(n.trap.Variables),
+	)
+	r.observe(OutcomeIndexed)
+}
+
+func (r *Receiver) observe(outcome string) {
+	if r.observer != nil {
+		r.observer(outcome)
+	}
+}
+
+// deviceInfo describes a device configuration for trap documents.
+func deviceInfo(cfg *elasticsearch.Config) schema.DeviceInfo {
+	return schema.DeviceInfo{
+		ID:   cfg.ID,
+		Name: cfg.Name,
+		Type: cfg.Type,
+		Tags: schema.DeviceTags{
+			Environment: cfg.Tags.Environment,
+			Location:    cfg.Tags.Location,
+			Role:        cfg.Tags.Role,
+		},
+	}
+}
@@ -0,0 +1,382 @@
+package trap
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/cache"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/elasticsearch"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/schema"
+	"github.com/matthew-hollick/go-snmp-prometheus-getter/internal/snmp"
+)
+
+// recordingWriter keeps the documents written to it.
+type recordingWriter struct {
+	mu   sync.Mutex
+	docs []schema.Document
+}
+
+func (w *recordingWriter) Write(ctx context.Context, docs []schema.Document) error {
+	for i := range docs {
+		if err := w.WriteOne(ctx, docs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *recordingWriter) WriteOne(_ context.Context, doc schema.Document) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.docs = append(w.docs, doc)
+
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	return nil
+}
+
+// versions returns the version and user of every trap written.
+func (w *recordingWriter) versions() map[string]bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	versions := make(map[string]bool)
+	for _, doc := range w.docs {
+		versions[doc.Trap.Version+"/"+doc.Trap.User] = true
+	}
+
+	return versions
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		packet    *gosnmp.SnmpPacket
+		wantOID   string
+		wantPDU   string
+		wantUp    uint32
+		wantVars  int
+		wantValue string
+	}{
+		{
+			name: "v1 generic linkDown",
+			packet: &gosnmp.SnmpPacket{
+				Version: gosnmp.Version1,
+				Variables: []gosnmp.SnmpPDU{
+					{Name: ".1.3.6.1.2.1.2.2.1.1.3", Type: gosnmp.Integer, Value: 3},
+				},
+				SnmpTrap: gosnmp.SnmpTrap{
+					Enterprise:   ".1.3.6.1.4.1.9",
+					AgentAddress: "10.0.0.1",
+					GenericTrap:  2,
+					Timestamp:    4200,
+				},
+			},
+			wantOID:   ".1.3.6.1.6.3.1.1.5.3",
+			wantPDU:   pduTrap,
+			wantUp:    4200,
+			wantVars:  1,
+			wantValue: "3",
+		},
+		{
+			name: "v1 enterprise specific",
+			packet: &gosnmp.SnmpPacket{
+				Version: gosnmp.Version1,
+				SnmpTrap: gosnmp.SnmpTrap{
+					Enterprise:   "1.3.6.1.4.1.9.9.13",
+					GenericTrap:  genericEnterpriseSpecific,
+					SpecificTrap: 5,
+				},
+			},
+			wantOID: ".1.3.6.1.4.1.9.9.13.0.5",
+			wantPDU: pduTrap,
+		},
+		{
+			name: "v2c inform",
+			packet: &gosnmp.SnmpPacket{
+				Version: gosnmp.Version2c,
+				PDUType: gosnmp.InformRequest,
+				Variables: []gosnmp.SnmpPDU{
+					{Name: oidSysUpTime, Type: gosnmp.TimeTicks, Value: uint32(99)},
+					{Name: oidSnmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9.9.117.2.0.2"},
+					{Name: ".1.3.6.1.2.1.2.2.1.6.1", Type: gosnmp.OctetString, Value: []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}},
+				},
+			},
+			wantOID:   ".1.3.6.1.4.1.9.9.117.2.0.2",
+			wantPDU:   pduInform,
+			wantUp:    99,
+			wantVars:  1,
+			wantValue: "00:1a:2b:3c:4d:5e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trap := convert(tt.packet)
+
+			if trap.OID != tt.wantOID || trap.PDU != tt.wantPDU || trap.Uptime != tt.wantUp {
+				t.Errorf("convert() = oid %s, pdu %s, uptime %d; want %s, %s, %d",
+					trap.OID, trap.PDU, trap.Uptime, tt.wantOID, tt.wantPDU, tt.wantUp)
+			}
+
+			if len(trap.Variables) != tt.wantVars {
+				t.Fatalf("expected %d variables, got %v", tt.wantVars, trap.Variables)
+			}
+
+			if tt.wantVars > 0 && trap.Variables[0].Value != tt.wantValue {
+				t.Errorf("expected variable value %q, got %q", tt.wantValue, trap.Variables[0].Value)
+			}
+		})
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	port := freePort(t)
+
+	configs := cache.New(time.Minute)
+	configs.SetAll([]elasticsearch.Config{{
+		ID:           "switch01",
+		Name:         "Switch 01",
+		SNMPSettings: elasticsearch.SNMPSettings{Host: "127.0.0.1"},
+	}})
+
+	user := snmp.USM{
+		SecurityName:  "trapuser",
+		SecurityLevel: snmp.LevelAuthPriv,
+		AuthProtocol:  "SHA",
+		AuthPassword:  "authpassword",
+		PrivProtocol:  "AES",
+		PrivPassword:  "privpassword",
+	}
+	engineID := "80001f8880e9630000d61ff449"
+
+	var (
+		mu       sync.Mutex
+		outcomes = make(map[string]int)
+	)
+
+	writer := &recordingWriter{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	receiver, err := New(Config{
+		ListenAddress: "127.0.0.1:" + strconv.Itoa(port),
+		Communities:   []string{"traps"},
+		Users:         []User{{USM: user, EngineID: engineID}},
+	}, configs, schema.NewTransformer("collector01", "1.0.0"), writer, logger, WithObserver(func(outcome string) {
+		mu.Lock()
+		defer mu.Unlock()
+		outcomes[outcome]++
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- receiver.Run(ctx)
+	}()
+
+	linkDown := gosnmp.SnmpTrap{Variables: []gosnmp.SnmpPDU{
+		{Name: oidSnmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.3"},
+		{Name: ".1.3.6.1.2.1.2.2.1.1.3", Type: gosnmp.Integer, Value: 3},
+	}}
+
+	params, err := user.SecurityParameters(engineID)
+	if err != nil {
+		t.Fatalf("SecurityParameters() error = %v", err)
+	}
+
+	senders := []*gosnmp.GoSNMP{
+		{Version: gosnmp.Version2c, Community: "traps"},
+		{Version: gosnmp.Version2c, Community: "public"},
+		{
+			Version:            gosnmp.Version3,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			MsgFlags:           gosnmp.AuthPriv,
+			SecurityParameters: params,
+		},
+	}
+
+	// The listener may not be up yet; resend until every trap has been seen.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		for _, sender := range senders {
+			sender.Target = "127.0.0.1"
+			sender.Port = uint16(port)
+			sender.Timeout = time.Second
+
+			if err := sender.Connect(); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+
+			if _, err := sender.SendTrap(linkDown); err != nil {
+				t.Fatalf("SendTrap() error = %v", err)
+			}
+
+			sender.Conn.Close()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		rejected := outcomes[OutcomeRejected]
+		mu.Unlock()
+
+		if rejected >= 1 && len(writer.versions()) == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for traps, outcomes: %v", outcomes)
+		}
+	}
+
+	cancel()
+
+	if err := <-errc; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if versions := writer.versions(); !versions["2c/"] || !versions["3/trapuser"] {
+		t.Errorf("expected v2c and v3 traps to be indexed, got %v", versions)
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	for _, doc := range writer.docs {
+		if doc.Event.Kind != "alert" || doc.Device.ID != "switch01" || doc.Trap.OID != ".1.3.6.1.6.3.1.1.5.3" {
+			t.Errorf("unexpected trap document: %+v", doc)
+		}
+
+		if doc.Source == nil || doc.Source.IP != "127.0.0.1" {
+			t.Errorf("unexpected source: %+v", doc.Source)
+		}
+	}
+}
+
+func TestReceiverUnknownDevice(t *testing.T) {
+	configs := cache.New(time.Minute)
+	configs.SetAll([]elasticsearch.Config{{ID: "switch01", SNMPSettings: elasticsearch.SNMPSettings{Host: "10.0.0.1"}}})
+
+	var outcome string
+
+	writer := &recordingWriter{}
+	receiver, err := New(Config{}, configs, schema.NewTransformer("collector01", "1.0.0"), writer,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), WithObserver(func(o string) { outcome = o }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	receiver.index(context.Background(), &notification{
+		trap:       schema.Trap{OID: ".1.3.6.1.6.3.1.1.5.1"},
+		receivedAt: time.Now(),
+		source:     &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 162},
+	})
+
+	if outcome != OutcomeUnknownDevice || len(writer.docs) != 0 {
+		t.Errorf("expected trap from unknown device to be dropped, got outcome %q and %d documents", outcome, len(writer.docs))
+	}
+
+	// A relayed SNMPv1 trap is resolved by its agent address.
+	receiver.index(context.Background(), &notification{
+		trap:       schema.Trap{OID: ".1.3.6.1.6.3.1.1.5.1", AgentAddress: "10.0.0.1"},
+		receivedAt: time.Now(),
+		source:     &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 162},
+	})
+
+	if outcome != OutcomeIndexed || len(writer.docs) != 1 {
+		t.Errorf("expected relayed trap to be indexed, got outcome %q and %d documents", outcome, len(writer.docs))
+	}
+}
+
+func TestResolverRebuildsInBackground(t *testing.T) {
+	configs := cache.New(time.Minute)
+	configs.SetAll([]elasticsearch.Config{{ID: "switch01", SNMPSettings: elasticsearch.SNMPSettings{Host: "10.0.0.1"}}})
+
+	release := make(chan struct{})
+	lookups := make(chan string, 10)
+
+	r := newResolver(configs, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		lookups <- host
+		<-release
+
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.2")}}, nil
+	}
+
+	ctx := context.Background()
+
+	if cfg, ok := r.resolve(ctx, net.ParseIP("10.0.0.1")); !ok || cfg.ID != "switch01" {
+		t.Fatalf("resolve(10.0.0.1) = %v, %v, want switch01", cfg, ok)
+	}
+
+	// The same configurations are not resolved again.
+	r.resolve(ctx, net.ParseIP("10.0.0.1"))
+
+	configs.Set(&elasticsearch.Config{ID: "switch02", SNMPSettings: elasticsearch.SNMPSettings{Host: "switch02.example"}})
+
+	// Notifications are resolved against the previous index while the host
+	// name lookup is outstanding.
+	if cfg, ok := r.resolve(ctx, net.ParseIP("10.0.0.1")); !ok || cfg.ID != "switch01" {
+		t.Fatalf("resolve(10.0.0.1) during rebuild = %v, %v, want switch01", cfg, ok)
+	}
+
+	<-lookups
+
+	if _, ok := r.resolve(ctx, net.ParseIP("10.0.0.2")); ok {
+		t.Fatal("expected 10.0.0.2 to be unknown until its lookup completes")
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if cfg, ok := r.resolve(ctx, net.ParseIP("10.0.0.2")); ok {
+			if cfg.ID != "switch02" {
+				t.Errorf("resolve(10.0.0.2) = %s, want switch02", cfg.ID)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the rebuilt index")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(lookups) != 0 {
+		t.Errorf("expected a single lookup, got %d more", len(lookups))
+	}
+}
+
+// freePort returns a UDP port that is currently unused.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}